@@ -5,11 +5,14 @@ import (
     "log"
     "net/http"
     "os"
+    "strings"
     "github.com/gin-gonic/gin"
     "github.com/joho/godotenv"
     "task-management/internal/handlers"
     "task-management/internal/middleware"
     "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
 )
 
 func main() {
@@ -23,8 +26,48 @@ func main() {
     // Initialize database
     database.InitDatabase()
 
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        runMigrateCommand(os.Args[2:])
+        return
+    }
+
+    // Set MIGRATE_ON_START=false when migrations run as a separate step
+    if os.Getenv("MIGRATE_ON_START") != "false" {
+        runMigrations()
+    }
+
+    services.EnsureAdmins()
+
+    // Initialize JWT signing keys
+    services.InitTokenService()
+
+    // Start the WebSocket hub
+    go services.WebsocketHub.Run()
+
+    // Initialize mailer and start delivering queued mail
+    services.InitMailer()
+    go services.Mailer.RunOutbox()
+
+    // Permanently remove tasks that have been in the trash too long
+    go services.RunTrashPurge()
+
+    // Select the LLM provider for AI features
+    services.InitAI()
+    if services.AI != nil {
+        go services.RunSuggestionWorker()
+    }
+
+    // Enable single sign-on when an identity provider is configured
+    services.InitOIDC()
+
     // Initialize Gin
     r := gin.Default()
+
+    // ClientIP only honours X-Forwarded-For from these addresses, otherwise
+    // clients could spoof their address past login throttling
+    if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+        log.Fatal("Invalid TRUSTED_PROXIES:", err)
+    }
     
     // Add middleware
     r.Use(middleware.CORSMiddleware())
@@ -34,20 +77,87 @@ func main() {
     {
         api.POST("/register", handlers.Register)
         api.POST("/login", handlers.Login)
+        api.POST("/login/2fa", handlers.LoginTwoFactor)
         api.POST("/logout", handlers.Logout)
-        api.GET("/me", handlers.GetMe)
-        api.GET("/tasks", handlers.GetTasks)
-        api.POST("/tasks", handlers.CreateTask)
-        api.PUT("/tasks/:id", handlers.UpdateTask)
-        api.DELETE("/tasks/:id", handlers.DeleteTask)
-        api.POST("/ai/suggestions", handlers.GetAISuggestions)
+        api.POST("/token/refresh", handlers.RefreshToken)
+        api.POST("/password/forgot", handlers.ForgotPassword)
+        api.POST("/password/reset", handlers.ResetPassword)
+        api.POST("/email/verify", handlers.VerifyEmail)
+        api.POST("/email/change/confirm", handlers.ConfirmEmailChange)
+        api.POST("/account/unlock", handlers.UnlockAccount)
+        api.GET("/avatars/:key", handlers.GetAvatar)
+        api.GET("/auth/oidc/login", handlers.OIDCLogin)
+        api.GET("/auth/oidc/callback", handlers.OIDCCallback)
+        api.POST("/auth/oidc/link/confirm", handlers.ConfirmSSOLink)
     }
 
+    protected := api.Group("")
+    protected.Use(middleware.AuthMiddleware())
+    {
+        protected.GET("/me", handlers.GetMe)
+        protected.GET("/tasks", middleware.RequireScope(models.ScopeTasksRead), handlers.GetTasks)
+        protected.POST("/tasks", middleware.RequireScope(models.ScopeTasksWrite), handlers.CreateTask)
+        protected.POST("/tasks/parse", middleware.RequireScope(models.ScopeTasksWrite), handlers.ParseTask)
+        protected.PUT("/tasks/:id", middleware.RequireScope(models.ScopeTasksWrite), handlers.UpdateTask)
+        protected.DELETE("/tasks/:id", middleware.RequireScope(models.ScopeTasksWrite), handlers.DeleteTask)
+        protected.GET("/tasks/:id/suggestions", middleware.RequireScope(models.ScopeTasksRead), handlers.GetTaskSuggestions)
+        protected.POST("/tasks/:id/ai/suggestions", middleware.RequireScope(models.ScopeAIUse), handlers.RequestTaskSuggestions)
+        protected.POST("/tasks/:id/suggestions/:suggestionId/accept", middleware.RequireScope(models.ScopeTasksWrite), handlers.AcceptTaskSuggestion)
+        protected.GET("/trash", middleware.RequireScope(models.ScopeTasksRead), handlers.GetTrash)
+        protected.POST("/trash/:id/restore", middleware.RequireScope(models.ScopeTasksWrite), handlers.RestoreTask)
+        protected.POST("/ai/suggestions", middleware.RequireScope(models.ScopeAIUse), handlers.GetAISuggestions)
+        protected.POST("/ai/suggestions/stream", middleware.RequireScope(models.ScopeAIUse), handlers.StreamAISuggestions)
+        protected.GET("/ai/plan", middleware.RequireScope(models.ScopeTasksRead), middleware.RequireScope(models.ScopeAIUse), handlers.GetAIPlan)
+        protected.GET("/ai/usage", middleware.RequireScope(models.ScopeAIUse), handlers.GetAIUsage)
+    }
+
+    // Account management is only available to interactive logins
+    account := protected.Group("")
+    account.Use(middleware.RequireSession())
+    {
+        account.PUT("/me", handlers.UpdateProfile)
+        account.DELETE("/me", handlers.DeleteAccount)
+        account.POST("/me/email", handlers.RequestEmailChange)
+        account.PUT("/me/password", handlers.ChangePassword)
+        account.PUT("/me/avatar", handlers.UploadAvatar)
+        account.DELETE("/me/avatar", handlers.DeleteAvatar)
+        account.POST("/email/verify/request", handlers.RequestEmailVerification)
+        account.GET("/2fa", handlers.GetTwoFactorStatus)
+        account.POST("/2fa/enroll", handlers.EnrollTwoFactor)
+        account.POST("/2fa/confirm", handlers.ConfirmTwoFactor)
+        account.POST("/2fa/disable", handlers.DisableTwoFactor)
+        account.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+        account.GET("/sessions", handlers.GetSessions)
+        account.DELETE("/sessions/:id", handlers.RevokeSession)
+        account.GET("/tokens", handlers.GetAPITokens)
+        account.POST("/tokens", handlers.CreateAPIToken)
+        account.DELETE("/tokens/:id", handlers.RevokeAPIToken)
+    }
+
+    admin := protected.Group("/admin")
+    admin.Use(middleware.RequireSession(), middleware.RequireRole(models.RoleAdmin))
+    {
+        admin.GET("/users", handlers.AdminListUsers)
+        admin.PUT("/users/:id/role", handlers.AdminSetUserRole)
+        admin.POST("/users/:id/disable", handlers.AdminDisableUser)
+        admin.POST("/users/:id/enable", handlers.AdminEnableUser)
+        admin.POST("/users/:id/sessions/revoke", handlers.AdminRevokeUserSessions)
+        admin.POST("/users/:id/tasks/reassign", handlers.AdminReassignTasks)
+    }
+
+    r.GET("/ws", middleware.WebSocketAuthMiddleware(), handlers.HandleWebSocket)
+
+    // Public keys for verifying tokens issued by this API
+    r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+        c.JSON(200, services.Tokens.JWKS())
+    })
+
     // Health check endpoint
     r.GET("/", func(c *gin.Context) {
         c.JSON(200, gin.H{
             "status": "healthy",
             "message": "Server is running",
+            "ai": services.AIHealth(),
         })
     })
 
@@ -70,4 +180,17 @@ func main() {
     if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
         log.Fatal("Error starting server:", err)
     }
-}
\ No newline at end of file
+}
+
+// trustedProxies reads the comma-separated addresses or CIDR ranges of the
+// reverse proxies in front of the API from TRUSTED_PROXIES. None are trusted
+// by default.
+func trustedProxies() []string {
+    var proxies []string
+    for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+        if proxy = strings.TrimSpace(proxy); proxy != "" {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
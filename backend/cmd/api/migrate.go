@@ -0,0 +1,78 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "strconv"
+    "time"
+    "task-management/internal/database"
+    "task-management/internal/migrations"
+)
+
+const migrationTimeout = 10 * time.Minute
+
+// runMigrations applies pending migrations during startup.
+func runMigrations() {
+    ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+    defer cancel()
+
+    count, err := database.MigrateUp(ctx, database.DB, migrations.All)
+    if err != nil {
+        log.Fatal("Failed to apply migrations:", err)
+    }
+    if count > 0 {
+        log.Printf("Applied %d migration(s)", count)
+    }
+}
+
+// runMigrateCommand implements "main migrate [up | down [steps] | status]"
+// so migrations can also be run as a separate deploy step.
+func runMigrateCommand(args []string) {
+    command := "up"
+    if len(args) > 0 {
+        command = args[0]
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+    defer cancel()
+
+    switch command {
+    case "up":
+        count, err := database.MigrateUp(ctx, database.DB, migrations.All)
+        if err != nil {
+            log.Fatal("Failed to apply migrations:", err)
+        }
+        fmt.Printf("Applied %d migration(s)\n", count)
+    case "down":
+        steps := 1
+        if len(args) > 1 {
+            n, err := strconv.Atoi(args[1])
+            if err != nil || n <= 0 {
+                log.Fatalf("Invalid number of steps %q", args[1])
+            }
+            steps = n
+        }
+        count, err := database.MigrateDown(ctx, database.DB, migrations.All, steps)
+        if err != nil {
+            log.Fatal("Failed to revert migrations:", err)
+        }
+        fmt.Printf("Reverted %d migration(s)\n", count)
+    case "status":
+        states, err := database.MigrationStatus(ctx, database.DB, migrations.All)
+        if err != nil {
+            log.Fatal("Failed to read migration status:", err)
+        }
+        for _, state := range states {
+            applied := "pending"
+            if state.AppliedAt != nil {
+                applied = state.AppliedAt.Format(time.RFC3339)
+            }
+            fmt.Printf("%4d  %-25s  %s\n", state.Version, applied, state.Description)
+        }
+    default:
+        fmt.Fprintf(os.Stderr, "Usage: %s migrate [up | down [steps] | status]\n", os.Args[0])
+        os.Exit(2)
+    }
+}
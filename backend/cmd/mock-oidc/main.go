@@ -0,0 +1,32 @@
+package main
+
+import (
+    "log"
+    "net/http"
+    "os"
+    "task-management/internal/oidcmock"
+)
+
+// Runs a throwaway OpenID Connect provider for trying out single sign-on
+// locally. Point the API at it with OIDC_ISSUER_URL=http://localhost:9999.
+func main() {
+    addr := os.Getenv("MOCK_OIDC_ADDR")
+    if addr == "" {
+        addr = "localhost:9999"
+    }
+
+    issuer := os.Getenv("MOCK_OIDC_ISSUER")
+    if issuer == "" {
+        issuer = "http://" + addr
+    }
+
+    server, err := oidcmock.NewServer(issuer)
+    if err != nil {
+        log.Fatal("Failed to start mock OIDC provider:", err)
+    }
+
+    log.Printf("Mock OIDC provider listening on %s (issuer %s)", addr, issuer)
+    if err := http.ListenAndServe(addr, server.Handler()); err != nil {
+        log.Fatal("Error starting server:", err)
+    }
+}
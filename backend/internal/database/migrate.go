@@ -0,0 +1,271 @@
+package database
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "sort"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+    migrationCollection     = "schema_migrations"
+    migrationLockCollection = "schema_migrations_lock"
+    migrationLockID         = "migrations"
+
+    // A lock left behind by a crashed pod expires after this long. The holder
+    // renews it while migrations run, so slow migrations don't lose it.
+    migrationLockTTL     = 10 * time.Minute
+    migrationLockRenewal = time.Minute
+    migrationLockRetry   = 2 * time.Second
+)
+
+// Migration is one versioned change to the database. Versions must be
+// unique and are applied in ascending order. Down may be nil for changes
+// that can't be reverted.
+type Migration struct {
+    Version     int
+    Description string
+    Up          func(ctx context.Context, db *mongo.Database) error
+    Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// AppliedMigration is the schema_migrations record of an applied version.
+type AppliedMigration struct {
+    Version     int       `bson:"_id" json:"version"`
+    Description string    `bson:"description" json:"description"`
+    AppliedAt   time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+type MigrationState struct {
+    Version     int        `json:"version"`
+    Description string     `json:"description"`
+    AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrateUp applies every pending migration and returns how many ran. Pods
+// starting at the same time take turns through a lock, so each migration
+// runs exactly once.
+func MigrateUp(ctx context.Context, db *mongo.Database, migrations []Migration) (int, error) {
+    if err := validateMigrations(migrations); err != nil {
+        return 0, err
+    }
+
+    release, err := acquireMigrationLock(ctx, db)
+    if err != nil {
+        return 0, err
+    }
+    defer release()
+
+    applied, err := appliedMigrations(ctx, db)
+    if err != nil {
+        return 0, err
+    }
+
+    count := 0
+    for _, m := range sortedMigrations(migrations) {
+        if _, done := applied[m.Version]; done {
+            continue
+        }
+
+        log.Printf("Applying migration %d: %s", m.Version, m.Description)
+        if err := m.Up(ctx, db); err != nil {
+            return count, fmt.Errorf("migration %d failed: %v", m.Version, err)
+        }
+
+        _, err := db.Collection(migrationCollection).InsertOne(ctx, AppliedMigration{
+            Version:     m.Version,
+            Description: m.Description,
+            AppliedAt:   time.Now(),
+        })
+        if err != nil {
+            return count, fmt.Errorf("error recording migration %d: %v", m.Version, err)
+        }
+        count++
+    }
+    return count, nil
+}
+
+// MigrateDown reverts the most recently applied steps migrations.
+func MigrateDown(ctx context.Context, db *mongo.Database, migrations []Migration, steps int) (int, error) {
+    if err := validateMigrations(migrations); err != nil {
+        return 0, err
+    }
+
+    release, err := acquireMigrationLock(ctx, db)
+    if err != nil {
+        return 0, err
+    }
+    defer release()
+
+    applied, err := appliedMigrations(ctx, db)
+    if err != nil {
+        return 0, err
+    }
+
+    sorted := sortedMigrations(migrations)
+    count := 0
+    for i := len(sorted) - 1; i >= 0 && count < steps; i-- {
+        m := sorted[i]
+        if _, done := applied[m.Version]; !done {
+            continue
+        }
+        if m.Down == nil {
+            return count, fmt.Errorf("migration %d cannot be reverted", m.Version)
+        }
+
+        log.Printf("Reverting migration %d: %s", m.Version, m.Description)
+        if err := m.Down(ctx, db); err != nil {
+            return count, fmt.Errorf("reverting migration %d failed: %v", m.Version, err)
+        }
+
+        if _, err := db.Collection(migrationCollection).DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+            return count, fmt.Errorf("error recording revert of migration %d: %v", m.Version, err)
+        }
+        count++
+    }
+    return count, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied.
+func MigrationStatus(ctx context.Context, db *mongo.Database, migrations []Migration) ([]MigrationState, error) {
+    applied, err := appliedMigrations(ctx, db)
+    if err != nil {
+        return nil, err
+    }
+
+    states := []MigrationState{}
+    for _, m := range sortedMigrations(migrations) {
+        state := MigrationState{Version: m.Version, Description: m.Description}
+        if record, ok := applied[m.Version]; ok {
+            appliedAt := record.AppliedAt
+            state.AppliedAt = &appliedAt
+        }
+        states = append(states, state)
+    }
+    return states, nil
+}
+
+func appliedMigrations(ctx context.Context, db *mongo.Database) (map[int]AppliedMigration, error) {
+    cursor, err := db.Collection(migrationCollection).Find(ctx, bson.M{})
+    if err != nil {
+        return nil, err
+    }
+
+    var records []AppliedMigration
+    if err := cursor.All(ctx, &records); err != nil {
+        return nil, err
+    }
+
+    applied := make(map[int]AppliedMigration, len(records))
+    for _, record := range records {
+        applied[record.Version] = record
+    }
+    return applied, nil
+}
+
+// acquireMigrationLock blocks until this process holds the migration lock
+// or ctx is done, and keeps renewing it until the returned func releases it.
+func acquireMigrationLock(ctx context.Context, db *mongo.Database) (func(), error) {
+    hostname, _ := os.Hostname()
+    owner := fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), time.Now().UnixNano())
+    locks := db.Collection(migrationLockCollection)
+
+    for {
+        now := time.Now()
+        // Matches only a free or expired lock; otherwise the upsert collides
+        // with the existing document and fails with a duplicate key error.
+        _, err := locks.UpdateOne(ctx,
+            bson.M{"_id": migrationLockID, "locked_until": bson.M{"$lt": now}},
+            bson.M{"$set": bson.M{"owner": owner, "locked_until": now.Add(migrationLockTTL)}},
+            options.Update().SetUpsert(true),
+        )
+        if err == nil {
+            break
+        }
+        if !mongo.IsDuplicateKeyError(err) {
+            return nil, fmt.Errorf("error acquiring migration lock: %v", err)
+        }
+
+        log.Println("Waiting for another instance to finish migrating")
+        select {
+        case <-ctx.Done():
+            return nil, fmt.Errorf("timed out waiting for migration lock: %v", ctx.Err())
+        case <-time.After(migrationLockRetry):
+        }
+    }
+
+    stop := make(chan struct{})
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        renewMigrationLock(locks, owner, stop)
+    }()
+
+    return func() {
+        close(stop)
+        <-done
+
+        releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        if _, err := locks.DeleteOne(releaseCtx, bson.M{"_id": migrationLockID, "owner": owner}); err != nil {
+            log.Printf("Error releasing migration lock: %v", err)
+        }
+    }, nil
+}
+
+// renewMigrationLock pushes the lock's expiry forward until stop is closed.
+func renewMigrationLock(locks *mongo.Collection, owner string, stop <-chan struct{}) {
+    ticker := time.NewTicker(migrationLockRenewal)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        result, err := locks.UpdateOne(ctx,
+            bson.M{"_id": migrationLockID, "owner": owner},
+            bson.M{"$set": bson.M{"locked_until": time.Now().Add(migrationLockTTL)}},
+        )
+        cancel()
+        if err != nil {
+            log.Printf("Error renewing migration lock: %v", err)
+            continue
+        }
+        if result.MatchedCount == 0 {
+            log.Printf("Migration lock was lost; another instance may start migrating")
+            return
+        }
+    }
+}
+
+func validateMigrations(migrations []Migration) error {
+    seen := map[int]bool{}
+    for _, m := range migrations {
+        if m.Version <= 0 {
+            return fmt.Errorf("migration %q has invalid version %d", m.Description, m.Version)
+        }
+        if seen[m.Version] {
+            return fmt.Errorf("duplicate migration version %d", m.Version)
+        }
+        if m.Up == nil {
+            return fmt.Errorf("migration %d has no Up step", m.Version)
+        }
+        seen[m.Version] = true
+    }
+    return nil
+}
+
+func sortedMigrations(migrations []Migration) []Migration {
+    sorted := append([]Migration(nil), migrations...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+    return sorted
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase connects to TEST_MONGODB_URI and returns a fresh database,
+// dropped afterwards. Tests needing it are skipped without one.
+func testDatabase(t *testing.T) *mongo.Database {
+    t.Helper()
+    uri := os.Getenv("TEST_MONGODB_URI")
+    if uri == "" {
+        t.Skip("TEST_MONGODB_URI not set")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatalf("connecting to MongoDB: %v", err)
+    }
+    if err := client.Ping(ctx, nil); err != nil {
+        t.Fatalf("pinging MongoDB: %v", err)
+    }
+
+    db := client.Database(fmt.Sprintf("task_management_test_%d", time.Now().UnixNano()))
+    t.Cleanup(func() {
+        db.Drop(context.Background())
+        client.Disconnect(context.Background())
+    })
+    return db
+}
+
+func noop(context.Context, *mongo.Database) error { return nil }
+
+// recorder returns migrations that append their version to a shared log,
+// negated when reverted.
+func recorder(versions ...int) ([]Migration, *[]int) {
+    var mu sync.Mutex
+    var ran []int
+    record := func(v int) func(context.Context, *mongo.Database) error {
+        return func(context.Context, *mongo.Database) error {
+            mu.Lock()
+            defer mu.Unlock()
+            ran = append(ran, v)
+            return nil
+        }
+    }
+
+    migrations := make([]Migration, 0, len(versions))
+    for _, v := range versions {
+        migrations = append(migrations, Migration{Version: v, Description: fmt.Sprint("step ", v), Up: record(v), Down: record(-v)})
+    }
+    return migrations, &ran
+}
+
+func TestValidateMigrations(t *testing.T) {
+    tests := []struct {
+        name       string
+        migrations []Migration
+        valid      bool
+    }{
+        {"empty", nil, true},
+        {"valid", []Migration{{Version: 2, Up: noop}, {Version: 1, Up: noop}}, true},
+        {"zero version", []Migration{{Version: 0, Up: noop}}, false},
+        {"duplicate version", []Migration{{Version: 1, Up: noop}, {Version: 1, Up: noop}}, false},
+        {"missing Up", []Migration{{Version: 1, Down: noop}}, false},
+    }
+    for _, tt := range tests {
+        if err := validateMigrations(tt.migrations); (err == nil) != tt.valid {
+            t.Errorf("%s: got %v", tt.name, err)
+        }
+    }
+}
+
+func TestSortedMigrations(t *testing.T) {
+    migrations, _ := recorder(3, 1, 2)
+    var versions []int
+    for _, m := range sortedMigrations(migrations) {
+        versions = append(versions, m.Version)
+    }
+    if !reflect.DeepEqual(versions, []int{1, 2, 3}) {
+        t.Errorf("got %v", versions)
+    }
+    if migrations[0].Version != 3 {
+        t.Error("the input slice was reordered")
+    }
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+    db := testDatabase(t)
+    ctx := context.Background()
+    migrations, ran := recorder(2, 1, 3)
+
+    if n, err := MigrateUp(ctx, db, migrations[:2]); err != nil || n != 2 {
+        t.Fatalf("first run: %d, %v", n, err)
+    }
+    // Only the new migration runs on the next deploy
+    if n, err := MigrateUp(ctx, db, migrations); err != nil || n != 1 {
+        t.Fatalf("second run: %d, %v", n, err)
+    }
+    if n, err := MigrateUp(ctx, db, migrations); err != nil || n != 0 {
+        t.Fatalf("nothing pending: %d, %v", n, err)
+    }
+
+    if n, err := MigrateDown(ctx, db, migrations, 2); err != nil || n != 2 {
+        t.Fatalf("reverting: %d, %v", n, err)
+    }
+    if want := []int{1, 2, 3, -3, -2}; !reflect.DeepEqual(*ran, want) {
+        t.Errorf("ran %v, want %v", *ran, want)
+    }
+
+    states, err := MigrationStatus(ctx, db, migrations)
+    if err != nil {
+        t.Fatalf("status: %v", err)
+    }
+    if len(states) != 3 || states[0].AppliedAt == nil || states[1].AppliedAt != nil || states[2].AppliedAt != nil {
+        t.Errorf("unexpected status %+v", states)
+    }
+}
+
+func TestMigrateDownStopsAtIrreversibleMigration(t *testing.T) {
+    db := testDatabase(t)
+    ctx := context.Background()
+    migrations := []Migration{{Version: 1, Up: noop}}
+
+    if _, err := MigrateUp(ctx, db, migrations); err != nil {
+        t.Fatalf("migrating: %v", err)
+    }
+    if n, err := MigrateDown(ctx, db, migrations, 1); err == nil || n != 0 {
+        t.Errorf("got %d, %v, want an error", n, err)
+    }
+}
+
+func TestMigrateUpRunsOnceAcrossInstances(t *testing.T) {
+    db := testDatabase(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    migrations, ran := recorder(1, 2)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 3; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if _, err := MigrateUp(ctx, db, migrations); err != nil {
+                t.Errorf("migrating: %v", err)
+            }
+        }()
+    }
+    wg.Wait()
+
+    if want := []int{1, 2}; !reflect.DeepEqual(*ran, want) {
+        t.Errorf("ran %v, want %v", *ran, want)
+    }
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "math"
+    "net/url"
+    "strconv"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "golang.org/x/crypto/bcrypt"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+const (
+    passwordResetTTL     = time.Hour
+    emailVerificationTTL = 48 * time.Hour
+    accountUnlockTTL     = 24 * time.Hour
+)
+
+func ForgotPassword(c *gin.Context) {
+    var input struct {
+        Email string `json:"email" binding:"required,email"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // Respond the same way whether or not the account exists so the
+    // endpoint can't be used to discover registered addresses.
+    response := gin.H{"message": "If that email is registered, a reset link has been sent"}
+
+    var user models.User
+    err := database.GetCollection("users").FindOne(ctx, bson.M{"email": models.NormalizeEmail(input.Email)}).Decode(&user)
+    if err != nil {
+        c.JSON(200, response)
+        return
+    }
+
+    token, err := services.CreateUserToken(ctx, user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+    if err != nil {
+        log.Printf("Error creating password reset token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to start password reset"})
+        return
+    }
+
+    err = services.Mailer.Enqueue(ctx, user.Email, "password_reset", map[string]interface{}{
+        "Name":      user.Name,
+        "ResetURL":  appURL("/reset-password", token),
+        "ExpiresIn": "1 hour",
+    })
+    if err != nil {
+        log.Printf("Error queueing password reset email: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to start password reset"})
+        return
+    }
+
+    c.JSON(200, response)
+}
+
+func ResetPassword(c *gin.Context) {
+    var input struct {
+        Token    string `json:"token" binding:"required"`
+        Password string `json:"password" binding:"required,min=6"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    token, err := services.ConsumeUserToken(ctx, input.Token, models.TokenPurposePasswordReset)
+    if err == services.ErrUserTokenInvalid {
+        c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error consuming password reset token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to reset password"})
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to hash password"})
+        return
+    }
+
+    // Receiving the reset link proves ownership of the address as well
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": token.UserID},
+        bson.M{"$set": bson.M{"password": string(hashedPassword), "email_verified": true}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to reset password"})
+        return
+    }
+    if err := services.PromoteListedAdmin(ctx, token.UserID); err != nil {
+        log.Printf("Error promoting admin user: %v", err)
+    }
+
+    if err := services.RevokeAllUserSessions(ctx, token.UserID, primitive.NilObjectID); err != nil {
+        log.Printf("Error revoking sessions after password reset: %v", err)
+    }
+
+    c.JSON(200, gin.H{"message": "Password reset successfully"})
+}
+
+func RequestEmailVerification(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var user models.User
+    err = database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+    if err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+
+    if user.EmailVerified {
+        c.JSON(200, gin.H{"message": "Email address already verified"})
+        return
+    }
+
+    if err := sendVerificationEmail(ctx, user); err != nil {
+        log.Printf("Error sending verification email: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to send verification email"})
+        return
+    }
+
+    c.JSON(200, gin.H{"message": "Verification email sent"})
+}
+
+func VerifyEmail(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    token, err := services.ConsumeUserToken(ctx, input.Token, models.TokenPurposeEmailVerification)
+    if err == services.ErrUserTokenInvalid {
+        c.JSON(400, gin.H{"error": "Invalid or expired verification token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error consuming verification token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to verify email"})
+        return
+    }
+
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": token.UserID},
+        bson.M{"$set": bson.M{"email_verified": true}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to verify email"})
+        return
+    }
+    if err := services.PromoteListedAdmin(ctx, token.UserID); err != nil {
+        log.Printf("Error promoting admin user: %v", err)
+    }
+
+    c.JSON(200, gin.H{"message": "Email verified successfully"})
+}
+
+func UnlockAccount(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    token, err := services.ConsumeUserToken(ctx, input.Token, models.TokenPurposeAccountUnlock)
+    if err == services.ErrUserTokenInvalid {
+        c.JSON(400, gin.H{"error": "Invalid or expired unlock token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error consuming unlock token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to unlock account"})
+        return
+    }
+
+    var user models.User
+    err = database.GetCollection("users").FindOne(ctx, bson.M{"_id": token.UserID}).Decode(&user)
+    if err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+
+    if err := services.UnlockAccount(ctx, user.Email); err != nil {
+        log.Printf("Error unlocking account: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to unlock account"})
+        return
+    }
+
+    services.RecordAudit(ctx, models.AuditLog{
+        Action: models.AuditActionAccountUnlocked,
+        UserID: &user.ID,
+        IP:     c.ClientIP(),
+    })
+
+    c.JSON(200, gin.H{"message": "Account unlocked successfully"})
+}
+
+// checkLoginAllowed refuses the attempt while the account or client address
+// is locked out or backing off. It writes the response itself when refusing.
+func checkLoginAllowed(c *gin.Context, ctx context.Context, email string) bool {
+    block, err := services.CheckLogin(ctx, email, c.ClientIP())
+    if err != nil {
+        log.Printf("Error checking login attempts: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to log in"})
+        return false
+    }
+    if block == nil {
+        return true
+    }
+
+    c.Header("Retry-After", strconv.Itoa(int(math.Ceil(block.RetryAfter.Seconds()))))
+    if block.Locked {
+        c.JSON(423, gin.H{"error": "Too many failed attempts. Login is temporarily locked; check your email to unlock your account"})
+        return false
+    }
+    c.JSON(429, gin.H{"error": "Too many failed attempts, please try again later"})
+    return false
+}
+
+// recordLoginFailure counts a failed attempt. user is nil when the email is
+// not registered; the attempt is still counted so lockouts don't reveal which
+// addresses exist.
+func recordLoginFailure(c *gin.Context, ctx context.Context, email string, user *models.User) {
+    lockedNow, err := services.RecordLoginFailure(ctx, email, c.ClientIP())
+    if err != nil {
+        log.Printf("Error recording login failure: %v", err)
+        return
+    }
+    if !lockedNow || user == nil {
+        return
+    }
+
+    token, err := services.CreateUserToken(ctx, user.ID, models.TokenPurposeAccountUnlock, accountUnlockTTL)
+    if err != nil {
+        log.Printf("Error creating unlock token: %v", err)
+        return
+    }
+
+    err = services.Mailer.Enqueue(ctx, user.Email, "account_unlock", map[string]interface{}{
+        "Name":      user.Name,
+        "UnlockURL": appURL("/unlock-account", token),
+        "ExpiresIn": "24 hours",
+    })
+    if err != nil {
+        log.Printf("Error queueing unlock email: %v", err)
+    }
+}
+
+func sendVerificationEmail(ctx context.Context, user models.User) error {
+    token, err := services.CreateUserToken(ctx, user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+    if err != nil {
+        return err
+    }
+
+    return services.Mailer.Enqueue(ctx, user.Email, "email_verification", map[string]interface{}{
+        "Name":      user.Name,
+        "Email":     user.Email,
+        "VerifyURL": appURL("/verify-email", token),
+        "ExpiresIn": "48 hours",
+    })
+}
+
+// appURL builds a link into the frontend carrying token as a query parameter.
+func appURL(path string, token string) string {
+    return frontendURL(path) + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "regexp"
+    "strconv"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+func AdminListUsers(c *gin.Context) {
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+    if limit <= 0 || limit > 200 {
+        limit = 50
+    }
+    offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if offset < 0 {
+        offset = 0
+    }
+
+    filter := bson.M{}
+    if q := c.Query("q"); q != "" {
+        pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+        filter["$or"] = []bson.M{{"name": pattern}, {"email": pattern}}
+    }
+    if role := c.Query("role"); role != "" {
+        filter["role"] = role
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    collection := database.GetCollection("users")
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to fetch users"})
+        return
+    }
+
+    cursor, err := collection.Find(ctx, filter, options.Find().
+        SetSort(bson.M{"_id": 1}).
+        SetSkip(int64(offset)).
+        SetLimit(int64(limit)))
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to fetch users"})
+        return
+    }
+
+    var users []models.User
+    if err := cursor.All(ctx, &users); err != nil {
+        c.JSON(500, gin.H{"error": "Failed to decode users"})
+        return
+    }
+
+    response := make([]gin.H, 0, len(users))
+    for _, user := range users {
+        response = append(response, gin.H{
+            "id":                 user.ID.Hex(),
+            "name":               user.Name,
+            "email":              user.Email,
+            "role":               user.EffectiveRole(),
+            "disabled":           user.Disabled,
+            "email_verified":     user.EmailVerified,
+            "two_factor_enabled": user.TwoFactorEnabled,
+        })
+    }
+
+    c.JSON(200, gin.H{
+        "users":  response,
+        "total":  total,
+        "limit":  limit,
+        "offset": offset,
+    })
+}
+
+func AdminSetUserRole(c *gin.Context) {
+    var input struct {
+        Role string `json:"role" binding:"required,oneof=admin user"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    targetID, ok := adminTargetID(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    result, err := database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": targetID},
+        bson.M{"$set": bson.M{"role": input.Role}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to update role"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+
+    recordAdminAudit(c, ctx, models.AuditActionUserRoleChanged, targetID, map[string]interface{}{"role": input.Role})
+    c.JSON(200, gin.H{"message": "Role updated successfully"})
+}
+
+// AdminDisableUser blocks the account and ends all of its sessions.
+func AdminDisableUser(c *gin.Context) {
+    setUserDisabled(c, true)
+}
+
+func AdminEnableUser(c *gin.Context) {
+    setUserDisabled(c, false)
+}
+
+func setUserDisabled(c *gin.Context, disabled bool) {
+    targetID, ok := adminTargetID(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    update := bson.M{"$set": bson.M{"disabled": false}, "$unset": bson.M{"disabled_at": ""}}
+    if disabled {
+        update = bson.M{"$set": bson.M{"disabled": true, "disabled_at": time.Now()}}
+    }
+
+    result, err := database.GetCollection("users").UpdateOne(ctx, bson.M{"_id": targetID}, update)
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to update user"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+
+    action := models.AuditActionUserEnabled
+    if disabled {
+        action = models.AuditActionUserDisabled
+        if err := services.RevokeAllUserSessions(ctx, targetID, primitive.NilObjectID); err != nil {
+            log.Printf("Error revoking sessions for disabled user: %v", err)
+        }
+    }
+
+    recordAdminAudit(c, ctx, action, targetID, nil)
+    c.JSON(200, gin.H{"message": "User updated successfully"})
+}
+
+func AdminRevokeUserSessions(c *gin.Context) {
+    targetID, ok := adminTargetID(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if err := services.RevokeAllUserSessions(ctx, targetID, primitive.NilObjectID); err != nil {
+        log.Printf("Error revoking sessions: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to revoke sessions"})
+        return
+    }
+
+    recordAdminAudit(c, ctx, models.AuditActionUserSessionsRevoked, targetID, nil)
+    c.JSON(200, gin.H{"message": "Sessions revoked successfully"})
+}
+
+// AdminReassignTasks moves every task assigned to or created by the user
+// onto another account, e.g. before the user leaves.
+func AdminReassignTasks(c *gin.Context) {
+    var input struct {
+        ToUserID string `json:"to_user_id" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    targetID, ok := adminTargetID(c)
+    if !ok {
+        return
+    }
+
+    toID, err := primitive.ObjectIDFromHex(input.ToUserID)
+    if err != nil || toID == targetID {
+        c.JSON(400, gin.H{"error": "Invalid destination user"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    if access, err := services.GetUserAccess(ctx, toID); err != nil || access.Disabled {
+        c.JSON(400, gin.H{"error": "Invalid destination user"})
+        return
+    }
+
+    assigned, created, err := reassignUserTasks(ctx, targetID, toID)
+    if err != nil {
+        log.Printf("Error reassigning tasks: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to reassign tasks"})
+        return
+    }
+
+    recordAdminAudit(c, ctx, models.AuditActionUserTasksReassigned, targetID, map[string]interface{}{
+        "to_user_id": toID.Hex(),
+        "assigned":   assigned,
+        "created":    created,
+    })
+
+    c.JSON(200, gin.H{
+        "assigned_reassigned": assigned,
+        "created_reassigned":  created,
+    })
+}
+
+// reassignUserTasks moves the tasks assigned to and created by from onto to,
+// returning how many of each were changed.
+func reassignUserTasks(ctx context.Context, from, to primitive.ObjectID) (int64, int64, error) {
+    tasks := database.GetCollection("tasks")
+    assigned, err := tasks.UpdateMany(ctx,
+        bson.M{"assigned_to": from},
+        bson.M{"$set": bson.M{"assigned_to": to, "updated_at": time.Now()}},
+    )
+    if err != nil {
+        return 0, 0, err
+    }
+    created, err := tasks.UpdateMany(ctx,
+        bson.M{"created_by": from},
+        bson.M{"$set": bson.M{"created_by": to, "updated_at": time.Now()}},
+    )
+    if err != nil {
+        return assigned.ModifiedCount, 0, err
+    }
+    return assigned.ModifiedCount, created.ModifiedCount, nil
+}
+
+// adminTargetID parses the :id route parameter and refuses actions an admin
+// takes against their own account, so nobody can lock themselves out.
+func adminTargetID(c *gin.Context) (primitive.ObjectID, bool) {
+    targetID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Invalid user ID"})
+        return primitive.NilObjectID, false
+    }
+
+    if targetID.Hex() == c.GetString("userId") {
+        c.JSON(400, gin.H{"error": "Admins cannot perform this action on their own account"})
+        return primitive.NilObjectID, false
+    }
+
+    return targetID, true
+}
+
+func recordAdminAudit(c *gin.Context, ctx context.Context, action string, targetID primitive.ObjectID, details map[string]interface{}) {
+    entry := models.AuditLog{
+        Action:  action,
+        UserID:  &targetID,
+        IP:      c.ClientIP(),
+        Details: details,
+    }
+    if actorID, err := primitive.ObjectIDFromHex(c.GetString("userId")); err == nil {
+        entry.ActorID = &actorID
+    }
+    services.RecordAudit(ctx, entry)
+}
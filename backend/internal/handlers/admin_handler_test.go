@@ -0,0 +1,82 @@
+package handlers
+
+import (
+    "context"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+// newAdminRouter serves the admin routes as adminID, skipping the auth
+// middleware.
+func newAdminRouter(adminID primitive.ObjectID) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("userId", adminID.Hex())
+        c.Set("role", models.RoleAdmin)
+    })
+    r.POST("/api/admin/users/:id/tasks/reassign", AdminReassignTasks)
+    return r
+}
+
+func reassign(r *gin.Engine, from primitive.ObjectID, to string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("POST", "/api/admin/users/"+from.Hex()+"/tasks/reassign", strings.NewReader(`{"to_user_id":"`+to+`"}`))
+    req.Header.Set("Content-Type", "application/json")
+    return serve(r, req)
+}
+
+func TestAdminReassignTasksRejectsInvalidTargets(t *testing.T) {
+    adminID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+    r := newAdminRouter(adminID)
+
+    if rec := reassign(r, adminID, userID.Hex()); rec.Code != 400 {
+        t.Errorf("own account: status %d, want 400", rec.Code)
+    }
+    if rec := reassign(r, userID, userID.Hex()); rec.Code != 400 {
+        t.Errorf("same source and destination: status %d, want 400", rec.Code)
+    }
+    if rec := reassign(r, userID, "not-an-id"); rec.Code != 400 {
+        t.Errorf("malformed destination: status %d, want 400", rec.Code)
+    }
+}
+
+func TestAdminReassignTasks(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    adminID := primitive.NewObjectID()
+    r := newAdminRouter(adminID)
+
+    from, active, disabled := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+    database.GetCollection("users").InsertMany(ctx, []interface{}{
+        models.User{ID: from, Email: "from@example.com", Role: models.RoleUser},
+        models.User{ID: active, Email: "active@example.com", Role: models.RoleUser},
+        models.User{ID: disabled, Email: "disabled@example.com", Role: models.RoleUser, Disabled: true},
+    })
+    tasks := database.GetCollection("tasks")
+    tasks.InsertOne(ctx, models.Task{ID: primitive.NewObjectID(), Title: "Handover", CreatedBy: from, AssignedTo: from})
+
+    // Tasks handed to a disabled account would be stranded
+    if rec := reassign(r, from, disabled.Hex()); rec.Code != 400 {
+        t.Errorf("disabled destination: status %d, want 400", rec.Code)
+    }
+    if rec := reassign(r, from, primitive.NewObjectID().Hex()); rec.Code != 400 {
+        t.Errorf("missing destination: status %d, want 400", rec.Code)
+    }
+    if n, _ := tasks.CountDocuments(ctx, bson.M{"created_by": from, "assigned_to": from}); n != 1 {
+        t.Fatalf("a rejected request changed tasks")
+    }
+
+    rec := reassign(r, from, active.Hex())
+    if rec.Code != 200 {
+        t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+    }
+    if n, _ := tasks.CountDocuments(ctx, bson.M{"created_by": active, "assigned_to": active}); n != 1 {
+        t.Errorf("tasks were not moved to the destination user")
+    }
+}
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+    "context"
+    "errors"
     "fmt"    
     "log"
-    "os"
+    "strconv"
+    "strings"
     "time"
     "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
     "task-management/internal/services"
 )
 
@@ -27,27 +34,22 @@ func GetAISuggestions(c *gin.Context) {
     }
 
     
-    apiKey := os.Getenv("OPENAI_API_KEY")
-    if apiKey == "" {
-        log.Printf("OpenAI API key not set")
-        c.JSON(500, gin.H{"error": "OpenAI API key not configured"})
+    if services.AI == nil {
+        c.JSON(503, gin.H{"error": "AI provider not configured"})
         return
     }
 
-    log.Printf("Initializing AI service with key length: %d", len(apiKey))
-
-   
-    aiService, err := services.NewAIService(apiKey)
-    if err != nil {
-        log.Printf("Failed to initialize AI service: %v", err)
-        c.JSON(500, gin.H{"error": "Failed to initialize AI service"})
+    
+    ctx := aiContext(c, c.Request.Context(), models.AIFeatureChat)
+    suggestions, err := services.AI.GenerateResponse(ctx, request.Prompt)
+    if errors.Is(err, services.ErrAIQuotaExceeded) {
+        aiQuotaExceeded(c)
+        return
+    }
+    if errors.Is(err, services.ErrLLMUnavailable) {
+        aiUnavailable(c)
         return
     }
-
-    log.Printf("Generating response for prompt: %s", request.Prompt)
-
-    
-    suggestions, err := aiService.GenerateResponse(request.Prompt)
     if err != nil {
         log.Printf("Failed to generate suggestions: %v", err)
         c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate suggestions: %v", err)})
@@ -60,4 +62,325 @@ func GetAISuggestions(c *gin.Context) {
     }
 
     c.JSON(200, response)
-}
\ No newline at end of file
+}
+
+// StreamAISuggestions is GetAISuggestions as a text/event-stream: "delta"
+// events carry the text as it is generated and a final "done" or "error"
+// event ends the stream. Generation stops when the client disconnects.
+func StreamAISuggestions(c *gin.Context) {
+    var request AIRequest
+    if err := c.ShouldBindJSON(&request); err != nil {
+        c.JSON(400, gin.H{"error": "Invalid request. Prompt is required"})
+        return
+    }
+
+    if services.AI == nil {
+        c.JSON(503, gin.H{"error": "AI provider not configured"})
+        return
+    }
+
+    ctx := aiContext(c, c.Request.Context(), models.AIFeatureChat)
+    // Checked up front so the limit is reported as a status, not an event
+    if services.CheckAIQuota(ctx) != nil {
+        aiQuotaExceeded(c)
+        return
+    }
+
+    c.Header("Content-Type", "text/event-stream")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("Connection", "keep-alive")
+    // Stop nginx from buffering the whole response
+    c.Header("X-Accel-Buffering", "no")
+    c.Status(200)
+
+    suggestions, err := services.AI.StreamResponse(ctx, request.Prompt, func(delta string) error {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        c.SSEvent("delta", gin.H{"text": delta})
+        c.Writer.Flush()
+        return nil
+    })
+    if ctx.Err() != nil {
+        return
+    }
+    if err != nil {
+        log.Printf("Failed to stream suggestions: %v", err)
+        c.SSEvent("error", gin.H{"error": fmt.Sprintf("Failed to generate suggestions: %v", err)})
+        c.Writer.Flush()
+        return
+    }
+
+    c.SSEvent("done", AIResponse{
+        Suggestions: suggestions,
+        Timestamp:   time.Now(),
+    })
+    c.Writer.Flush()
+}
+
+// GetTaskSuggestions returns the task's AI suggestions, newest first. Each
+// one is pending until the background worker has generated it.
+func GetTaskSuggestions(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    task, ok := loadAccessibleTask(c, ctx)
+    if !ok {
+        return
+    }
+
+    suggestions, err := services.ListTaskSuggestions(ctx, task.ID)
+    if err != nil {
+        log.Printf("Error listing suggestions: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to fetch suggestions"})
+        return
+    }
+
+    c.JSON(200, gin.H{"suggestions": suggestions})
+}
+
+// RequestTaskSuggestions queues a new version of the task's suggestions,
+// built from the full task including its tags, due date and subtasks.
+func RequestTaskSuggestions(c *gin.Context) {
+    if services.AI == nil {
+        c.JSON(503, gin.H{"error": "AI provider not configured"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    task, ok := loadAccessibleTask(c, ctx)
+    if !ok {
+        return
+    }
+
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if services.CheckAIQuota(aiContext(c, ctx, models.AIFeatureTaskSuggestions)) != nil {
+        aiQuotaExceeded(c)
+        return
+    }
+
+    suggestion, err := services.EnqueueTaskSuggestion(ctx, task.ID, userID)
+    if err != nil {
+        log.Printf("Error queueing suggestions: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to request suggestions"})
+        return
+    }
+
+    c.JSON(202, gin.H{"suggestion": suggestion})
+}
+
+// AcceptTaskSuggestion creates child tasks from the chosen subtasks of a
+// suggestion's analysis. Each subtask can only be accepted once.
+func AcceptTaskSuggestion(c *gin.Context) {
+    var input struct {
+        Subtasks []int `json:"subtasks" binding:"required,min=1"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    suggestionID, err := primitive.ObjectIDFromHex(c.Param("suggestionId"))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Invalid suggestion ID"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    task, ok := loadAccessibleTask(c, ctx)
+    if !ok {
+        return
+    }
+
+    suggestions := database.GetCollection("ai_suggestions")
+    var suggestion models.AITaskSuggestion
+    err = suggestions.FindOne(ctx, bson.M{"_id": suggestionID, "task_id": task.ID}).Decode(&suggestion)
+    if err != nil {
+        c.JSON(404, gin.H{"error": "Suggestion not found"})
+        return
+    }
+    if suggestion.Status != models.SuggestionStatusReady || suggestion.Analysis == nil {
+        c.JSON(409, gin.H{"error": "Suggestion has no subtasks to accept"})
+        return
+    }
+
+    seen := map[int]bool{}
+    indexes := make([]int, 0, len(input.Subtasks))
+    for _, i := range input.Subtasks {
+        if i < 0 || i >= len(suggestion.Analysis.Subtasks) {
+            c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid subtask index %d", i)})
+            return
+        }
+        if !seen[i] {
+            seen[i] = true
+            indexes = append(indexes, i)
+        }
+    }
+
+    // Claiming the indexes first means two concurrent requests can't both
+    // create the same subtask
+    result, err := suggestions.UpdateOne(ctx,
+        bson.M{"_id": suggestion.ID, "accepted_subtasks": bson.M{"$nin": indexes}},
+        bson.M{"$addToSet": bson.M{"accepted_subtasks": bson.M{"$each": indexes}}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to accept subtasks"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(409, gin.H{"error": "Some of these subtasks have already been accepted"})
+        return
+    }
+
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+    now := time.Now()
+    created := make([]models.Task, 0, len(indexes))
+    docs := make([]interface{}, 0, len(indexes))
+    for _, i := range indexes {
+        subtask := suggestion.Analysis.Subtasks[i]
+        child := models.Task{
+            ID:              primitive.NewObjectID(),
+            Title:           subtask.Title,
+            Description:     subtask.Description,
+            Status:          "todo",
+            Priority:        subtask.Priority,
+            CreatedBy:       userID,
+            CreatedAt:       now,
+            UpdatedAt:       now,
+            ParentID:        &task.ID,
+            EstimateMinutes: subtask.EstimateMinutes,
+        }
+        created = append(created, child)
+        docs = append(docs, child)
+    }
+
+    if _, err := database.GetCollection("tasks").InsertMany(ctx, docs); err != nil {
+        log.Printf("Error creating subtasks: %v", err)
+        // Release the claim so the user can try again
+        if _, err := suggestions.UpdateOne(ctx,
+            bson.M{"_id": suggestion.ID},
+            bson.M{"$pullAll": bson.M{"accepted_subtasks": indexes}},
+        ); err != nil {
+            log.Printf("Error releasing accepted subtasks: %v", err)
+        }
+        c.JSON(500, gin.H{"error": "Failed to create subtasks"})
+        return
+    }
+
+    c.JSON(201, gin.H{"tasks": created})
+}
+
+// GetAIPlan ranks the caller's open tasks into a plan for today and the rest
+// of the week. ?refresh=true generates a new plan even if today's is still
+// current.
+func GetAIPlan(c *gin.Context) {
+    if services.AI == nil {
+        c.JSON(503, gin.H{"error": "AI provider not configured"})
+        return
+    }
+
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 90*time.Second)
+    defer cancel()
+    refresh := c.Query("refresh") == "true"
+    ctx = aiContext(c, ctx, models.AIFeaturePlan)
+    if refresh {
+        ctx = services.WithoutAICache(ctx)
+    }
+
+    var user models.User
+    if err := database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+
+    plan, cached, err := services.GetDailyPlan(ctx, userID, userLocation(user), refresh)
+    if errors.Is(err, services.ErrAIQuotaExceeded) {
+        aiQuotaExceeded(c)
+        return
+    }
+    if errors.Is(err, services.ErrLLMUnavailable) {
+        aiUnavailable(c)
+        return
+    }
+    if err != nil {
+        log.Printf("Error generating plan: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to generate plan"})
+        return
+    }
+
+    c.JSON(200, gin.H{"plan": plan, "cached": cached})
+}
+
+// GetAIUsage reports the caller's AI usage today against their quota, and
+// their daily usage over the last ?days=30 days (at most 90).
+func GetAIUsage(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if days <= 0 || days > 90 {
+        days = 30
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    today, err := services.GetAIQuotaStatus(ctx, userID)
+    if err != nil {
+        log.Printf("Error loading AI usage: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to fetch usage"})
+        return
+    }
+    history, err := services.ListAIUsage(ctx, userID, days)
+    if err != nil {
+        log.Printf("Error loading AI usage: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to fetch usage"})
+        return
+    }
+
+    c.JSON(200, gin.H{"today": today, "history": history})
+}
+
+// aiContext attributes AI calls to the caller for quotas and usage. A
+// "Cache-Control: no-cache" request header skips the AI response cache.
+func aiContext(c *gin.Context, ctx context.Context, feature string) context.Context {
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+    ctx = services.WithAIUsage(ctx, userID, feature)
+    if strings.Contains(strings.ToLower(c.GetHeader("Cache-Control")), "no-cache") {
+        ctx = services.WithoutAICache(ctx)
+    }
+    return ctx
+}
+
+// aiUnavailable answers 503 while the provider's circuit breaker is open,
+// with the time it will let a request through again.
+func aiUnavailable(c *gin.Context) {
+    if resilient, ok := services.AI.Provider().(*services.ResilientProvider); ok {
+        if retryAt := resilient.Breaker().RetryAt; retryAt != nil && retryAt.After(time.Now()) {
+            c.Header("Retry-After", strconv.Itoa(int(time.Until(*retryAt).Seconds())+1))
+        }
+    }
+    c.JSON(503, gin.H{"error": "AI provider is temporarily unavailable"})
+}
+
+// aiQuotaExceeded answers 429 with the time until the quota resets.
+func aiQuotaExceeded(c *gin.Context) {
+    now := time.Now().UTC()
+    reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+    c.Header("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+    c.JSON(429, gin.H{"error": "Daily AI quota exceeded"})
+}
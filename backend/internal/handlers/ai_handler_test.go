@@ -0,0 +1,112 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http/httptest"
+    "testing"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+// newSuggestionRouter serves the task suggestion routes as userID, skipping
+// the auth middleware.
+func newSuggestionRouter(userID primitive.ObjectID) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("userId", userID.Hex())
+    })
+    r.GET("/api/tasks/:id/suggestions", GetTaskSuggestions)
+    r.POST("/api/tasks/:id/ai/suggestions", RequestTaskSuggestions)
+    r.POST("/api/tasks/:id/suggestions/:suggestionId/accept", AcceptTaskSuggestion)
+    return r
+}
+
+func TestRequestTaskSuggestions(t *testing.T) {
+    useTestDatabase(t)
+    services.AI = services.NewAIService(services.NewFakeProvider(""))
+    t.Cleanup(func() { services.AI = nil })
+    ctx := context.Background()
+
+    owner, stranger := primitive.NewObjectID(), primitive.NewObjectID()
+    taskID := primitive.NewObjectID()
+    database.GetCollection("tasks").InsertOne(ctx, models.Task{ID: taskID, Title: "Launch beta", CreatedBy: owner})
+    path := "/api/tasks/" + taskID.Hex()
+
+    if rec := serve(newSuggestionRouter(stranger), httptest.NewRequest("POST", path+"/ai/suggestions", nil)); rec.Code != 404 {
+        t.Errorf("another user's task: status %d, want 404", rec.Code)
+    }
+
+    r := newSuggestionRouter(owner)
+    for want := 1; want <= 2; want++ {
+        rec := serve(r, httptest.NewRequest("POST", path+"/ai/suggestions", nil))
+        if rec.Code != 202 {
+            t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+        }
+        var body struct {
+            Suggestion models.AITaskSuggestion `json:"suggestion"`
+        }
+        json.Unmarshal(rec.Body.Bytes(), &body)
+        if body.Suggestion.Version != want || body.Suggestion.Status != models.SuggestionStatusPending {
+            t.Errorf("request %d queued %+v", want, body.Suggestion)
+        }
+    }
+
+    rec := serve(r, httptest.NewRequest("GET", path+"/suggestions", nil))
+    var list struct {
+        Suggestions []models.AITaskSuggestion `json:"suggestions"`
+    }
+    json.Unmarshal(rec.Body.Bytes(), &list)
+    if rec.Code != 200 || len(list.Suggestions) != 2 || list.Suggestions[0].Version != 2 {
+        t.Errorf("status %d, suggestions %+v", rec.Code, list.Suggestions)
+    }
+}
+
+func TestAcceptTaskSuggestion(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    owner := primitive.NewObjectID()
+    r := newSuggestionRouter(owner)
+
+    taskID, suggestionID := primitive.NewObjectID(), primitive.NewObjectID()
+    database.GetCollection("tasks").InsertOne(ctx, models.Task{ID: taskID, Title: "Launch beta", CreatedBy: owner})
+    database.GetCollection("ai_suggestions").InsertOne(ctx, models.AITaskSuggestion{
+        ID:      suggestionID,
+        TaskID:  taskID,
+        Version: 1,
+        Status:  models.SuggestionStatusReady,
+        Analysis: &models.TaskAnalysis{Subtasks: []models.SuggestedSubtask{
+            {Title: "Write announcement", Priority: "high", EstimateMinutes: 60},
+            {Title: "Invite first cohort", Priority: "medium", EstimateMinutes: 30},
+        }},
+    })
+    path := "/api/tasks/" + taskID.Hex() + "/suggestions/" + suggestionID.Hex() + "/accept"
+
+    if rec := sendJSON(r, "POST", path, `{"subtasks":[5]}`); rec.Code != 400 {
+        t.Errorf("out of range index: status %d, want 400", rec.Code)
+    }
+
+    rec := sendJSON(r, "POST", path, `{"subtasks":[1,1]}`)
+    if rec.Code != 201 {
+        t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+    }
+    var child models.Task
+    if err := database.GetCollection("tasks").FindOne(ctx, bson.M{"parent_id": taskID}).Decode(&child); err != nil {
+        t.Fatalf("subtask not created: %v", err)
+    }
+    if child.Title != "Invite first cohort" || child.EstimateMinutes != 30 || child.CreatedBy != owner {
+        t.Errorf("unexpected subtask %+v", child)
+    }
+    if n, _ := database.GetCollection("tasks").CountDocuments(ctx, bson.M{"parent_id": taskID}); n != 1 {
+        t.Errorf("a repeated index created %d subtasks", n)
+    }
+
+    if rec := sendJSON(r, "POST", path, `{"subtasks":[0,1]}`); rec.Code != 409 {
+        t.Errorf("accepting a subtask twice: status %d, want 409", rec.Code)
+    }
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "log"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/services"
+)
+
+func GetAPITokens(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    tokens, err := services.ListAPITokens(ctx, userID)
+    if err != nil {
+        log.Printf("Error listing API tokens: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to fetch API tokens"})
+        return
+    }
+
+    c.JSON(200, tokens)
+}
+
+func CreateAPIToken(c *gin.Context) {
+    var input struct {
+        Name          string   `json:"name" binding:"required,max=100"`
+        Scopes        []string `json:"scopes" binding:"required,min=1"`
+        ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    // Zero means the token never expires
+    var expiresAt *time.Time
+    if input.ExpiresInDays > 0 {
+        t := time.Now().AddDate(0, 0, input.ExpiresInDays)
+        expiresAt = &t
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    token, raw, err := services.CreateAPIToken(ctx, userID, input.Name, input.Scopes, expiresAt)
+    if errors.Is(err, services.ErrUnknownScope) {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        log.Printf("Error creating API token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to create API token"})
+        return
+    }
+
+    // The raw token is only ever returned here
+    c.JSON(201, gin.H{
+        "token":     raw,
+        "api_token": token,
+    })
+}
+
+func RevokeAPIToken(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    tokenID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Invalid token ID"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    err = services.RevokeAPIToken(ctx, tokenID, userID)
+    if err == services.ErrAPITokenNotFound {
+        c.JSON(404, gin.H{"error": "API token not found"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error revoking API token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to revoke API token"})
+        return
+    }
+
+    c.JSON(200, gin.H{"message": "API token revoked successfully"})
+}
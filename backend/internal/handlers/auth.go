@@ -3,22 +3,19 @@ package handlers
 
 import (
     "context"
+    "log"
     "time"
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
     "golang.org/x/crypto/bcrypt"
     "task-management/internal/database"
     "task-management/internal/middleware"
+    "task-management/internal/models"
+    "task-management/internal/services"
 )
 
-type User struct {
-    ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Name     string            `bson:"name" json:"name"`
-    Email    string            `bson:"email" json:"email"`
-    Password string            `bson:"password" json:"-"`
-}
-
 func Register(c *gin.Context) {
     var input struct {
         Name     string `json:"name" binding:"required"`
@@ -36,13 +33,6 @@ func Register(c *gin.Context) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    var existingUser User
-    err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&existingUser)
-    if err == nil {
-        c.JSON(400, gin.H{"error": "Email already registered"})
-        return
-    }
-
     
     hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
     if err != nil {
@@ -51,34 +41,31 @@ func Register(c *gin.Context) {
     }
 
     
-    user := User{
+    user := models.User{
         ID:       primitive.NewObjectID(),
         Name:     input.Name,
-        Email:    input.Email,
+        Email:    models.NormalizeEmail(input.Email),
         Password: string(hashedPassword),
+        Role:     models.RoleUser,
     }
 
+    // The unique email index decides between concurrent registrations
     _, err = collection.InsertOne(ctx, user)
+    if mongo.IsDuplicateKeyError(err) {
+        c.JSON(409, gin.H{"error": "Email already registered"})
+        return
+    }
     if err != nil {
         c.JSON(500, gin.H{"error": "Failed to create user"})
         return
     }
 
-   
-    token, err := middleware.GenerateToken(user.ID.Hex())
-    if err != nil {
-        c.JSON(500, gin.H{"error": "Failed to generate token"})
-        return
+    if err := sendVerificationEmail(ctx, user); err != nil {
+        log.Printf("Error sending verification email: %v", err)
     }
 
-    c.JSON(200, gin.H{
-        "token": token,
-        "user": gin.H{
-            "id":    user.ID.Hex(),
-            "name":  user.Name,
-            "email": user.Email,
-        },
-    })
+   
+    respondWithTokens(c, ctx, user)
 }
 
 func Login(c *gin.Context) {
@@ -96,32 +83,52 @@ func Login(c *gin.Context) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    var user User
+    input.Email = models.NormalizeEmail(input.Email)
+    if !checkLoginAllowed(c, ctx, input.Email) {
+        return
+    }
+
+    var user models.User
     err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
     if err != nil {
+        recordLoginFailure(c, ctx, input.Email, nil)
         c.JSON(401, gin.H{"error": "Invalid email or password"})
         return
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+        recordLoginFailure(c, ctx, input.Email, &user)
         c.JSON(401, gin.H{"error": "Invalid email or password"})
         return
     }
 
-    token, err := middleware.GenerateToken(user.ID.Hex())
-    if err != nil {
-        c.JSON(500, gin.H{"error": "Failed to generate token"})
+    if user.Disabled {
+        c.JSON(403, gin.H{"error": "Account disabled"})
         return
     }
 
-    c.JSON(200, gin.H{
-        "token": token,
-        "user": gin.H{
-            "id":    user.ID.Hex(),
-            "name":  user.Name,
-            "email": user.Email,
-        },
-    })
+    // The failure count is only cleared once the second factor has been
+    // checked too, otherwise knowing the password would allow unlimited
+    // guesses at the code.
+    if user.TwoFactorEnabled {
+        challengeToken, err := middleware.GenerateChallengeToken(user.ID.Hex())
+        if err != nil {
+            c.JSON(500, gin.H{"error": "Failed to generate token"})
+            return
+        }
+
+        c.JSON(200, gin.H{
+            "two_factor_required": true,
+            "challenge_token":     challengeToken,
+        })
+        return
+    }
+
+    if err := services.RecordLoginSuccess(ctx, user.Email); err != nil {
+        log.Printf("Error clearing login failures: %v", err)
+    }
+
+    respondWithTokens(c, ctx, user)
 }
 
 func GetMe(c *gin.Context) {
@@ -141,7 +148,7 @@ func GetMe(c *gin.Context) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    var user User
+    var user models.User
     err = collection.FindOne(ctx, bson.M{"_id": objectId}).Decode(&user)
     if err != nil {
         c.JSON(404, gin.H{"error": "User not found"})
@@ -149,16 +156,133 @@ func GetMe(c *gin.Context) {
     }
 
     c.JSON(200, gin.H{
-        "user": gin.H{
-            "id":    user.ID.Hex(),
-            "name":  user.Name,
-            "email": user.Email,
-        },
+        "user": userPayload(user),
+    })
+}
+
+func RefreshToken(c *gin.Context) {
+    var input struct {
+        RefreshToken string `json:"refresh_token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    current, refreshToken, err := services.RotateRefreshToken(ctx, input.RefreshToken)
+    if err == services.ErrRefreshTokenInvalid || err == services.ErrRefreshTokenReused {
+        c.JSON(401, gin.H{"error": "Invalid refresh token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error rotating refresh token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to refresh token"})
+        return
+    }
+
+    if err := services.ExtendSession(ctx, current.FamilyID); err != nil {
+        log.Printf("Error extending session: %v", err)
+    }
+
+    token, err := middleware.GenerateToken(current.UserID.Hex(), current.FamilyID.Hex())
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to generate token"})
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "token":         token,
+        "refresh_token": refreshToken,
+        "expires_in":    int(middleware.AccessTokenTTL().Seconds()),
     })
 }
 
 func Logout(c *gin.Context) {
+    var input struct {
+        RefreshToken string `json:"refresh_token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // Unknown tokens are treated as already logged out
+    token, err := services.LookupRefreshToken(ctx, input.RefreshToken)
+    if err == nil {
+        err = services.RevokeSession(ctx, token.FamilyID)
+    }
+    if err != nil && err != services.ErrRefreshTokenInvalid {
+        log.Printf("Error revoking refresh tokens: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to log out"})
+        return
+    }
+
     c.JSON(200, gin.H{
         "message": "Logged out successfully",
     })
-}
\ No newline at end of file
+}
+
+// issueTokenPair records a new session for a fresh login and returns a
+// short-lived access token together with the first refresh token of the
+// session's family.
+func issueTokenPair(c *gin.Context, ctx context.Context, userID primitive.ObjectID) (string, string, error) {
+    session, err := services.CreateSession(ctx, userID, c.ClientIP(), c.Request.UserAgent())
+    if err != nil {
+        return "", "", err
+    }
+
+    token, err := middleware.GenerateToken(userID.Hex(), session.ID.Hex())
+    if err != nil {
+        return "", "", err
+    }
+
+    refreshToken, err := services.IssueRefreshToken(ctx, userID, session.ID)
+    if err != nil {
+        return "", "", err
+    }
+
+    return token, refreshToken, nil
+}
+
+func respondWithTokens(c *gin.Context, ctx context.Context, user models.User) {
+    token, refreshToken, err := issueTokenPair(c, ctx, user.ID)
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to generate token"})
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "token":         token,
+        "refresh_token": refreshToken,
+        "expires_in":    int(middleware.AccessTokenTTL().Seconds()),
+        "user":          userPayload(user),
+    })
+}
+
+// userPayload is how the signed-in user's own account is returned to them.
+func userPayload(user models.User) gin.H {
+    payload := gin.H{
+        "id":                 user.ID.Hex(),
+        "name":               user.Name,
+        "email":              user.Email,
+        "email_verified":     user.EmailVerified,
+        "two_factor_enabled": user.TwoFactorEnabled,
+        "role":               user.EffectiveRole(),
+        "timezone":           user.Timezone,
+        "locale":             user.Locale,
+        "avatar_url":         avatarURL(user),
+    }
+    if user.PendingEmail != "" {
+        payload["pending_email"] = user.PendingEmail
+    }
+    return payload
+}
+
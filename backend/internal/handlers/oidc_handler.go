@@ -0,0 +1,327 @@
+package handlers
+
+import (
+    "context"
+    "crypto/subtle"
+    "errors"
+    "log"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/middleware"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+// oidcStateCookie ties a login round trip to the browser that started it, so
+// a callback URL planted by someone else can't sign the victim in to the
+// attacker's account.
+const (
+    oidcStateCookie     = "oidc_state"
+    oidcStateCookiePath = "/api/auth/oidc"
+)
+
+const ssoLinkTTL = time.Hour
+
+var (
+    errSSONotAllowed  = errors.New("no account is linked to this identity and its email domain is not allowed")
+    errSSOLinkPending = errors.New("linking this identity to an existing account needs confirmation by email")
+)
+
+func OIDCLogin(c *gin.Context) {
+    if services.OIDC == nil {
+        c.JSON(404, gin.H{"error": "Single sign-on is not configured"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    authURL, state, err := services.OIDC.StartLogin(ctx)
+    if err != nil {
+        log.Printf("Error starting OIDC login: %v", err)
+        c.JSON(502, gin.H{"error": "Failed to contact identity provider"})
+        return
+    }
+
+    // Lax still sends the cookie on the provider's top-level redirect back
+    setOIDCStateCookie(c, services.HashToken(state), int(services.OIDCStateTTL.Seconds()))
+    c.Redirect(302, authURL)
+}
+
+// OIDCCallback finishes the provider round trip and hands the tokens to the
+// frontend in the URL fragment, which browsers never send to servers.
+// Second factors are left to the identity provider for SSO logins.
+func OIDCCallback(c *gin.Context) {
+    if services.OIDC == nil {
+        c.JSON(404, gin.H{"error": "Single sign-on is not configured"})
+        return
+    }
+
+    cookie, _ := c.Cookie(oidcStateCookie)
+    setOIDCStateCookie(c, "", -1)
+
+    if providerErr := c.Query("error"); providerErr != "" {
+        log.Printf("OIDC provider returned error: %s %s", providerErr, c.Query("error_description"))
+        redirectSSOError(c, "sso_failed")
+        return
+    }
+
+    state, code := c.Query("state"), c.Query("code")
+    if state == "" || code == "" {
+        redirectSSOError(c, "sso_failed")
+        return
+    }
+    if subtle.ConstantTimeCompare([]byte(cookie), []byte(services.HashToken(state))) != 1 {
+        log.Printf("OIDC callback state does not match the browser that started the login")
+        redirectSSOError(c, "sso_failed")
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+    defer cancel()
+
+    claims, err := services.OIDC.CompleteLogin(ctx, state, code)
+    if err != nil {
+        log.Printf("Error completing OIDC login: %v", err)
+        redirectSSOError(c, "sso_failed")
+        return
+    }
+
+    user, err := findOrProvisionSSOUser(ctx, claims)
+    if err == errSSONotAllowed {
+        redirectSSOError(c, "sso_not_allowed")
+        return
+    }
+    if err == errSSOLinkPending {
+        redirectSSOError(c, "sso_link_sent")
+        return
+    }
+    if err != nil {
+        log.Printf("Error resolving SSO user: %v", err)
+        redirectSSOError(c, "sso_failed")
+        return
+    }
+    if user.Disabled {
+        redirectSSOError(c, "account_disabled")
+        return
+    }
+
+    token, refreshToken, err := issueTokenPair(c, ctx, user.ID)
+    if err != nil {
+        log.Printf("Error issuing tokens for SSO login: %v", err)
+        redirectSSOError(c, "sso_failed")
+        return
+    }
+
+    fragment := url.Values{}
+    fragment.Set("token", token)
+    fragment.Set("refresh_token", refreshToken)
+    fragment.Set("expires_in", strconv.Itoa(int(middleware.AccessTokenTTL().Seconds())))
+    c.Redirect(302, frontendURL("/auth/callback")+"#"+fragment.Encode())
+}
+
+// ConfirmSSOLink completes linking an identity provider account to the
+// existing account whose owner followed the emailed link.
+func ConfirmSSOLink(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    token, err := services.ConsumeUserToken(ctx, input.Token, models.TokenPurposeSSOLink)
+    if err == services.ErrUserTokenInvalid {
+        c.JSON(400, gin.H{"error": "Invalid or expired link token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error consuming SSO link token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to link single sign-on"})
+        return
+    }
+
+    var identity models.ExternalIdentity
+    err = database.GetCollection("external_identities").FindOneAndUpdate(ctx,
+        bson.M{"user_id": token.UserID, "pending": true},
+        bson.M{"$unset": bson.M{"pending": ""}},
+    ).Decode(&identity)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(400, gin.H{"error": "Invalid or expired link token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error confirming SSO link: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to link single sign-on"})
+        return
+    }
+
+    services.RecordAudit(ctx, models.AuditLog{
+        Action:  models.AuditActionSSOLinked,
+        UserID:  &token.UserID,
+        IP:      c.ClientIP(),
+        Details: map[string]interface{}{"issuer": identity.Issuer, "email": identity.Email},
+    })
+
+    c.JSON(200, gin.H{"message": "Single sign-on linked successfully"})
+}
+
+// findOrProvisionSSOUser resolves the local user for an external identity.
+// Unlinked identities get a new account when the email domain is allowed.
+// If an account already uses the verified email, the owner has to confirm
+// the link by email first so an identity provider account can't take over a
+// local one just by claiming its address.
+func findOrProvisionSSOUser(ctx context.Context, claims *services.OIDCClaims) (*models.User, error) {
+    identities := database.GetCollection("external_identities")
+    users := database.GetCollection("users")
+    issuer := services.OIDC.Issuer()
+    now := time.Now()
+
+    var identity models.ExternalIdentity
+    err := identities.FindOneAndUpdate(ctx,
+        bson.M{"issuer": issuer, "subject": claims.Subject, "pending": bson.M{"$ne": true}},
+        bson.M{"$set": bson.M{"last_login_at": now, "email": claims.Email}},
+    ).Decode(&identity)
+    if err == nil {
+        var user models.User
+        if err := users.FindOne(ctx, bson.M{"_id": identity.UserID}).Decode(&user); err != nil {
+            return nil, err
+        }
+        return &user, nil
+    }
+    if err != mongo.ErrNoDocuments {
+        return nil, err
+    }
+
+    if claims.Email == "" || !claims.EmailVerified {
+        return nil, errSSONotAllowed
+    }
+
+    email := models.NormalizeEmail(claims.Email)
+    if !services.OIDC.DomainAllowed(email) {
+        return nil, errSSONotAllowed
+    }
+
+    var user models.User
+    err = users.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+    if err == nil {
+        return nil, requestSSOLink(ctx, user, issuer, claims)
+    }
+    if err != mongo.ErrNoDocuments {
+        return nil, err
+    }
+
+    name := claims.Name
+    if name == "" {
+        name = strings.Split(email, "@")[0]
+    }
+    // No password is set, so the account can only sign in through SSO
+    // until the user resets one.
+    user = models.User{
+        ID:            primitive.NewObjectID(),
+        Name:          name,
+        Email:         email,
+        EmailVerified: true,
+        Role:          models.RoleUser,
+    }
+    if _, err := users.InsertOne(ctx, user); err != nil {
+        return nil, err
+    }
+    log.Printf("Provisioned user %s from SSO login", user.ID.Hex())
+    // The identity provider has verified the address
+    if err := services.PromoteListedAdmin(ctx, user.ID); err != nil {
+        log.Printf("Error promoting admin user: %v", err)
+    }
+
+    // A link requested under the identity's previous email is superseded
+    if _, err := identities.DeleteOne(ctx, bson.M{"issuer": issuer, "subject": claims.Subject, "pending": true}); err != nil {
+        return nil, err
+    }
+    _, err = identities.InsertOne(ctx, models.ExternalIdentity{
+        ID:          primitive.NewObjectID(),
+        UserID:      user.ID,
+        Issuer:      issuer,
+        Subject:     claims.Subject,
+        Email:       claims.Email,
+        CreatedAt:   now,
+        LastLoginAt: now,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return &user, nil
+}
+
+// requestSSOLink records a pending link from the identity to user and emails
+// the account owner a link to confirm it.
+func requestSSOLink(ctx context.Context, user models.User, issuer string, claims *services.OIDCClaims) error {
+    identities := database.GetCollection("external_identities")
+    now := time.Now()
+
+    // Only the most recent request can be confirmed, like the emailed token
+    _, err := identities.DeleteMany(ctx, bson.M{"user_id": user.ID, "pending": true})
+    if err != nil {
+        return err
+    }
+    _, err = identities.UpdateOne(ctx,
+        bson.M{"issuer": issuer, "subject": claims.Subject, "pending": true},
+        bson.M{"$set": bson.M{
+            "user_id":       user.ID,
+            "email":         claims.Email,
+            "created_at":    now,
+            "last_login_at": now,
+        }},
+        options.Update().SetUpsert(true),
+    )
+    if err != nil {
+        return err
+    }
+
+    token, err := services.CreateUserToken(ctx, user.ID, models.TokenPurposeSSOLink, ssoLinkTTL)
+    if err != nil {
+        return err
+    }
+    err = services.Mailer.Enqueue(ctx, user.Email, "sso_link", map[string]interface{}{
+        "Name":       user.Name,
+        "Email":      user.Email,
+        "ConfirmURL": appURL("/link-sso", token),
+        "ExpiresIn":  "1 hour",
+    })
+    if err != nil {
+        return err
+    }
+    return errSSOLinkPending
+}
+
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(oidcStateCookie, value, maxAge, oidcStateCookiePath, "", services.OIDC.SecureCookies(), true)
+}
+
+func redirectSSOError(c *gin.Context, code string) {
+    c.Redirect(302, frontendURL("/login")+"?error="+url.QueryEscape(code))
+}
+
+func frontendURL(path string) string {
+    base := os.Getenv("APP_URL")
+    if base == "" {
+        base = "http://localhost:3000"
+    }
+    return strings.TrimSuffix(base, "/") + path
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/oidcmock"
+    "task-management/internal/services"
+)
+
+const testRedirectURL = "http://api.test/api/auth/oidc/callback"
+
+// useMockOIDC points services.OIDC at a fresh oidcmock provider that allows
+// automatic accounts for example.com.
+func useMockOIDC(t *testing.T) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    t.Setenv("APP_URL", "http://app.test")
+
+    var handler http.Handler
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        handler.ServeHTTP(w, r)
+    }))
+    t.Cleanup(server.Close)
+
+    mock, err := oidcmock.NewServer(server.URL)
+    if err != nil {
+        t.Fatalf("starting mock provider: %v", err)
+    }
+    handler = mock.Handler()
+
+    provider, err := services.NewOIDCProvider(server.URL, "taskai", "", testRedirectURL, []string{"example.com"})
+    if err != nil {
+        t.Fatalf("creating provider: %v", err)
+    }
+    services.OIDC = provider
+    t.Cleanup(func() { services.OIDC = nil })
+}
+
+// useTestDatabase connects to TEST_MONGODB_URI and gives the test its own
+// database, dropped afterwards. Tests needing it are skipped without one.
+func useTestDatabase(t *testing.T) {
+    t.Helper()
+    uri := os.Getenv("TEST_MONGODB_URI")
+    if uri == "" {
+        t.Skip("TEST_MONGODB_URI not set")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatalf("connecting to MongoDB: %v", err)
+    }
+    if err := client.Ping(ctx, nil); err != nil {
+        t.Fatalf("pinging MongoDB: %v", err)
+    }
+
+    previous := database.DB
+    database.DB = client.Database(fmt.Sprintf("task_management_test_%d", time.Now().UnixNano()))
+    t.Cleanup(func() {
+        database.DB.Drop(context.Background())
+        client.Disconnect(context.Background())
+        database.DB = previous
+    })
+
+    tokens, err := services.NewTokenService(&services.SigningKey{ID: "test", Algorithm: "HS256", Private: []byte("test-secret"), Public: []byte("test-secret")}, nil)
+    if err != nil {
+        t.Fatalf("creating token service: %v", err)
+    }
+    mailer, err := services.NewMailService(services.NewMemoryMailBackend(), "TaskAI <no-reply@example.com>")
+    if err != nil {
+        t.Fatalf("creating mailer: %v", err)
+    }
+    previousTokens, previousMailer := services.Tokens, services.Mailer
+    services.Tokens, services.Mailer = tokens, mailer
+    t.Cleanup(func() { services.Tokens, services.Mailer = previousTokens, previousMailer })
+}
+
+func newOIDCRouter() *gin.Engine {
+    r := gin.New()
+    r.GET("/api/auth/oidc/login", OIDCLogin)
+    r.GET("/api/auth/oidc/callback", OIDCCallback)
+    r.POST("/api/auth/oidc/link/confirm", ConfirmSSOLink)
+    return r
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+    rec := httptest.NewRecorder()
+    r.ServeHTTP(rec, req)
+    return rec
+}
+
+// startLogin begins a login and signs in at the mock provider as email. It
+// returns the callback URL the provider redirected to and the state cookie.
+func startLogin(t *testing.T, r *gin.Engine, email string) (*url.URL, *http.Cookie) {
+    t.Helper()
+    rec := serve(r, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+    if rec.Code != 302 {
+        t.Fatalf("login: status %d, body %s", rec.Code, rec.Body.String())
+    }
+
+    var cookie *http.Cookie
+    for _, c := range rec.Result().Cookies() {
+        if c.Name == oidcStateCookie {
+            cookie = c
+        }
+    }
+    if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+        t.Fatalf("login didn't set an HttpOnly, SameSite=Lax state cookie: %+v", cookie)
+    }
+
+    authURL, err := url.Parse(rec.Header().Get("Location"))
+    if err != nil {
+        t.Fatalf("parsing authorization URL: %v", err)
+    }
+    form := authURL.Query()
+    form.Set("email", email)
+    authURL.RawQuery = ""
+
+    client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+    resp, err := client.PostForm(authURL.String(), form)
+    if err != nil {
+        t.Fatalf("signing in at the provider: %v", err)
+    }
+    resp.Body.Close()
+
+    callback, err := url.Parse(resp.Header.Get("Location"))
+    if err != nil || !strings.HasPrefix(callback.String(), testRedirectURL) {
+        t.Fatalf("provider redirected to %q", resp.Header.Get("Location"))
+    }
+    return callback, cookie
+}
+
+func callback(r *gin.Engine, callbackURL *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("GET", "/api/auth/oidc/callback?"+callbackURL.RawQuery, nil)
+    if cookie != nil {
+        req.AddCookie(cookie)
+    }
+    return serve(r, req)
+}
+
+func assertSSOError(t *testing.T, rec *httptest.ResponseRecorder, code string) {
+    t.Helper()
+    want := "http://app.test/login?error=" + code
+    if rec.Code != 302 || rec.Header().Get("Location") != want {
+        t.Fatalf("got %d redirect to %q, want %q", rec.Code, rec.Header().Get("Location"), want)
+    }
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+    useMockOIDC(t)
+    r := newOIDCRouter()
+    callbackURL, _ := url.Parse(testRedirectURL + "?state=attacker-state&code=attacker-code")
+
+    t.Run("missing cookie", func(t *testing.T) {
+        assertSSOError(t, callback(r, callbackURL, nil), "sso_failed")
+    })
+
+    t.Run("cookie from another login", func(t *testing.T) {
+        cookie := &http.Cookie{Name: oidcStateCookie, Value: services.HashToken("victim-state")}
+        rec := callback(r, callbackURL, cookie)
+        assertSSOError(t, rec, "sso_failed")
+
+        // The cookie is cleared whatever the outcome
+        cleared := false
+        for _, c := range rec.Result().Cookies() {
+            cleared = cleared || (c.Name == oidcStateCookie && c.MaxAge < 0)
+        }
+        if !cleared {
+            t.Error("state cookie was not cleared")
+        }
+    })
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+    useMockOIDC(t)
+    useTestDatabase(t)
+    r := newOIDCRouter()
+
+    callbackURL, cookie := startLogin(t, r, "new.user@example.com")
+    rec := callback(r, callbackURL, cookie)
+    location := rec.Header().Get("Location")
+    if rec.Code != 302 || !strings.HasPrefix(location, "http://app.test/auth/callback#") {
+        t.Fatalf("got %d redirect to %q", rec.Code, location)
+    }
+    fragment, _ := url.ParseQuery(strings.SplitN(location, "#", 2)[1])
+    if fragment.Get("token") == "" || fragment.Get("refresh_token") == "" {
+        t.Fatalf("tokens missing from %q", location)
+    }
+
+    ctx := context.Background()
+    var user models.User
+    if err := database.GetCollection("users").FindOne(ctx, bson.M{"email": "new.user@example.com"}).Decode(&user); err != nil {
+        t.Fatalf("user was not provisioned: %v", err)
+    }
+    if !user.EmailVerified || user.Password != "" {
+        t.Errorf("provisioned user should be verified and password-less: %+v", user)
+    }
+    n, _ := database.GetCollection("external_identities").CountDocuments(ctx, bson.M{"user_id": user.ID, "pending": bson.M{"$ne": true}})
+    if n != 1 {
+        t.Errorf("expected one linked identity, found %d", n)
+    }
+
+    // The state is single use
+    assertSSOError(t, callback(r, callbackURL, cookie), "sso_failed")
+}
+
+func TestOIDCLoginRejectsDisallowedDomain(t *testing.T) {
+    useMockOIDC(t)
+    useTestDatabase(t)
+    r := newOIDCRouter()
+
+    callbackURL, cookie := startLogin(t, r, "someone@elsewhere.test")
+    assertSSOError(t, callback(r, callbackURL, cookie), "sso_not_allowed")
+}
+
+func TestOIDCLoginLinksExistingAccountAfterConfirmation(t *testing.T) {
+    useMockOIDC(t)
+    useTestDatabase(t)
+    r := newOIDCRouter()
+    ctx := context.Background()
+
+    existing := models.User{Name: "Dev", Email: "dev@example.com", Password: "hash", EmailVerified: true, Role: models.RoleUser}
+    result, err := database.GetCollection("users").InsertOne(ctx, existing)
+    if err != nil {
+        t.Fatalf("inserting user: %v", err)
+    }
+
+    // Matching the email alone doesn't sign anyone in to the account
+    callbackURL, cookie := startLogin(t, r, "dev@example.com")
+    assertSSOError(t, callback(r, callbackURL, cookie), "sso_link_sent")
+
+    var outbox models.OutboxMessage
+    if err := database.GetCollection("mail_outbox").FindOne(ctx, bson.M{"template": "sso_link"}).Decode(&outbox); err != nil {
+        t.Fatalf("no link confirmation email was queued: %v", err)
+    }
+    if len(outbox.Message.To) != 1 || outbox.Message.To[0] != "dev@example.com" {
+        t.Errorf("confirmation sent to %v", outbox.Message.To)
+    }
+    match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(outbox.Message.Text)
+    if match == nil {
+        t.Fatalf("no token in confirmation email: %s", outbox.Message.Text)
+    }
+
+    req := httptest.NewRequest("POST", "/api/auth/oidc/link/confirm", strings.NewReader(`{"token":"`+match[1]+`"}`))
+    req.Header.Set("Content-Type", "application/json")
+    if rec := serve(r, req); rec.Code != 200 {
+        t.Fatalf("confirm: status %d, body %s", rec.Code, rec.Body.String())
+    }
+
+    callbackURL, cookie = startLogin(t, r, "dev@example.com")
+    rec := callback(r, callbackURL, cookie)
+    if !strings.HasPrefix(rec.Header().Get("Location"), "http://app.test/auth/callback#") {
+        t.Fatalf("login after confirming the link redirected to %q", rec.Header().Get("Location"))
+    }
+
+    var identity models.ExternalIdentity
+    if err := database.GetCollection("external_identities").FindOne(ctx, bson.M{"subject": "mock|dev@example.com"}).Decode(&identity); err != nil {
+        t.Fatalf("identity not stored: %v", err)
+    }
+    if identity.UserID != result.InsertedID || identity.Pending {
+        t.Errorf("identity not linked to the existing account: %+v", identity)
+    }
+}
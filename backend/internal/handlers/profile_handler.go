@@ -0,0 +1,683 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "regexp"
+    "strings"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/crypto/bcrypt"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+const (
+    emailChangeTTL = 48 * time.Hour
+    maxAvatarSize  = 2 << 20
+
+    // How recently a password-less account must have signed in through SSO
+    // to make a sensitive change without a two-factor code
+    ssoReauthWindow = 10 * time.Minute
+)
+
+var (
+    localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+    avatarContentTypes = map[string]bool{
+        "image/png":  true,
+        "image/jpeg": true,
+        "image/gif":  true,
+        "image/webp": true,
+    }
+)
+
+// UpdateProfile changes the name, timezone and locale. Fields left out of
+// the request are kept; an empty timezone or locale clears it.
+func UpdateProfile(c *gin.Context) {
+    var input struct {
+        Name     *string `json:"name" binding:"omitempty,min=1,max=100"`
+        Timezone *string `json:"timezone"`
+        Locale   *string `json:"locale"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    set := bson.M{}
+    unset := bson.M{}
+    if input.Name != nil {
+        name := strings.TrimSpace(*input.Name)
+        if name == "" {
+            c.JSON(400, gin.H{"error": "Name cannot be empty"})
+            return
+        }
+        set["name"] = name
+    }
+    if input.Timezone != nil {
+        if *input.Timezone == "" {
+            unset["timezone"] = ""
+        } else if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "Local" {
+            c.JSON(400, gin.H{"error": "Invalid timezone"})
+            return
+        } else {
+            set["timezone"] = *input.Timezone
+        }
+    }
+    if input.Locale != nil {
+        if *input.Locale == "" {
+            unset["locale"] = ""
+        } else if !localePattern.MatchString(*input.Locale) {
+            c.JSON(400, gin.H{"error": "Invalid locale"})
+            return
+        } else {
+            set["locale"] = *input.Locale
+        }
+    }
+
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    update := bson.M{}
+    if len(set) > 0 {
+        update["$set"] = set
+    }
+    if len(unset) > 0 {
+        update["$unset"] = unset
+    }
+
+    var user models.User
+    if len(update) == 0 {
+        err = database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+    } else {
+        err = database.GetCollection("users").FindOneAndUpdate(ctx,
+            bson.M{"_id": userID},
+            update,
+            options.FindOneAndUpdate().SetReturnDocument(options.After),
+        ).Decode(&user)
+    }
+    if err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+
+    c.JSON(200, gin.H{"user": userPayload(user)})
+}
+
+// RequestEmailChange emails a confirmation link to the new address. The
+// account keeps its current email until the link is used.
+func RequestEmailChange(c *gin.Context) {
+    var input struct {
+        Email    string `json:"email" binding:"required,email"`
+        Password string `json:"password"`
+        Code     string `json:"code"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !reauthenticate(c, user, input.Password, input.Code) {
+        return
+    }
+
+    input.Email = models.NormalizeEmail(input.Email)
+    if input.Email == user.Email {
+        c.JSON(400, gin.H{"error": "That is already your email address"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    users := database.GetCollection("users")
+    n, err := users.CountDocuments(ctx, bson.M{"email": input.Email})
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to change email"})
+        return
+    }
+    if n > 0 {
+        c.JSON(409, gin.H{"error": "Email already registered"})
+        return
+    }
+
+    _, err = users.UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"pending_email": input.Email}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to change email"})
+        return
+    }
+
+    token, err := services.CreateUserToken(ctx, user.ID, models.TokenPurposeEmailChange, emailChangeTTL)
+    if err != nil {
+        log.Printf("Error creating email change token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to change email"})
+        return
+    }
+
+    err = services.Mailer.Enqueue(ctx, input.Email, "email_change", map[string]interface{}{
+        "Name":       user.Name,
+        "Email":      input.Email,
+        "ConfirmURL": appURL("/confirm-email", token),
+        "ExpiresIn":  "48 hours",
+    })
+    if err != nil {
+        log.Printf("Error queueing email change confirmation: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to change email"})
+        return
+    }
+
+    c.JSON(200, gin.H{"message": "Confirmation email sent to the new address"})
+}
+
+func ConfirmEmailChange(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    token, err := services.ConsumeUserToken(ctx, input.Token, models.TokenPurposeEmailChange)
+    if err == services.ErrUserTokenInvalid {
+        c.JSON(400, gin.H{"error": "Invalid or expired confirmation token"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error consuming email change token: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to change email"})
+        return
+    }
+
+    users := database.GetCollection("users")
+    var user models.User
+    if err := users.FindOne(ctx, bson.M{"_id": token.UserID}).Decode(&user); err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+    if user.PendingEmail == "" {
+        c.JSON(400, gin.H{"error": "No email change is pending"})
+        return
+    }
+
+    result, err := users.UpdateOne(ctx,
+        bson.M{"_id": user.ID, "pending_email": user.PendingEmail},
+        bson.M{
+            "$set":   bson.M{"email": user.PendingEmail, "email_verified": true},
+            "$unset": bson.M{"pending_email": ""},
+        },
+    )
+    // The address may have been registered since the change was requested
+    if mongo.IsDuplicateKeyError(err) {
+        c.JSON(409, gin.H{"error": "Email already registered"})
+        return
+    }
+    if err != nil || result.MatchedCount == 0 {
+        c.JSON(500, gin.H{"error": "Failed to change email"})
+        return
+    }
+    if err := services.PromoteListedAdmin(ctx, user.ID); err != nil {
+        log.Printf("Error promoting admin user: %v", err)
+    }
+
+    // Let the previous address know in case the account was taken over
+    err = services.Mailer.Enqueue(ctx, user.Email, "email_changed", map[string]interface{}{
+        "Name":     user.Name,
+        "NewEmail": user.PendingEmail,
+    })
+    if err != nil {
+        log.Printf("Error queueing email changed notice: %v", err)
+    }
+
+    services.RecordAudit(ctx, models.AuditLog{
+        Action:  models.AuditActionEmailChanged,
+        UserID:  &user.ID,
+        IP:      c.ClientIP(),
+        Details: map[string]interface{}{"from": user.Email, "to": user.PendingEmail},
+    })
+
+    c.JSON(200, gin.H{"message": "Email changed successfully"})
+}
+
+// ChangePassword sets a new password and signs out every other session.
+func ChangePassword(c *gin.Context) {
+    var input struct {
+        CurrentPassword string `json:"current_password"`
+        NewPassword     string `json:"new_password" binding:"required,min=6"`
+        Code            string `json:"code"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !reauthenticate(c, user, input.CurrentPassword, input.Code) {
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to hash password"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"password": string(hashedPassword)}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to change password"})
+        return
+    }
+
+    sessionID, _ := primitive.ObjectIDFromHex(c.GetString("sessionId"))
+    if err := services.RevokeAllUserSessions(ctx, user.ID, sessionID); err != nil {
+        log.Printf("Error revoking sessions after password change: %v", err)
+    }
+
+    services.RecordAudit(ctx, models.AuditLog{
+        Action: models.AuditActionPasswordChanged,
+        UserID: &user.ID,
+        IP:     c.ClientIP(),
+    })
+
+    c.JSON(200, gin.H{"message": "Password changed successfully"})
+}
+
+// UploadAvatar accepts a PNG, JPEG, GIF or WebP image of up to 2 MB in the
+// "avatar" field of a multipart form.
+func UploadAvatar(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize+1<<20)
+    header, err := c.FormFile("avatar")
+    if err != nil {
+        c.JSON(400, gin.H{"error": "An image is required in the avatar field"})
+        return
+    }
+    if header.Size > maxAvatarSize {
+        c.JSON(413, gin.H{"error": "Avatar must be 2 MB or smaller"})
+        return
+    }
+
+    file, err := header.Open()
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Failed to read avatar"})
+        return
+    }
+    defer file.Close()
+
+    data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Failed to read avatar"})
+        return
+    }
+    if len(data) > maxAvatarSize {
+        c.JSON(413, gin.H{"error": "Avatar must be 2 MB or smaller"})
+        return
+    }
+
+    // Trust the bytes rather than the type the client declared
+    contentType := http.DetectContentType(data)
+    if !avatarContentTypes[contentType] {
+        c.JSON(415, gin.H{"error": "Avatar must be a PNG, JPEG, GIF or WebP image"})
+        return
+    }
+
+    key, err := services.GenerateOpaqueToken()
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to store avatar"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    now := time.Now()
+    _, err = database.GetCollection("avatars").ReplaceOne(ctx,
+        bson.M{"_id": userID},
+        models.Avatar{UserID: userID, Key: key, ContentType: contentType, Data: data, UpdatedAt: now},
+        options.Replace().SetUpsert(true),
+    )
+    if err != nil {
+        log.Printf("Error storing avatar: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to store avatar"})
+        return
+    }
+
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": userID},
+        bson.M{"$set": bson.M{"avatar_updated_at": now, "avatar_key": key}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to store avatar"})
+        return
+    }
+
+    user := models.User{ID: userID, AvatarUpdatedAt: &now, AvatarKey: key}
+    c.JSON(200, gin.H{"avatar_url": avatarURL(user)})
+}
+
+func DeleteAvatar(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if err := deleteAvatar(ctx, userID); err != nil {
+        log.Printf("Error deleting avatar: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to delete avatar"})
+        return
+    }
+
+    c.JSON(200, gin.H{"message": "Avatar deleted successfully"})
+}
+
+// GetAvatar is public so avatar URLs work in <img> tags; the unguessable
+// key in the URL stands in for authentication.
+func GetAvatar(c *gin.Context) {
+    key := c.Param("key")
+    if key == "" {
+        c.JSON(404, gin.H{"error": "Avatar not found"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var avatar models.Avatar
+    if err := database.GetCollection("avatars").FindOne(ctx, bson.M{"key": key}).Decode(&avatar); err != nil {
+        c.JSON(404, gin.H{"error": "Avatar not found"})
+        return
+    }
+
+    // The key changes with every upload, so the image never goes stale
+    c.Header("Cache-Control", "public, max-age=31536000, immutable")
+    c.Header("X-Content-Type-Options", "nosniff")
+    c.Data(200, avatar.ContentType, avatar.Data)
+}
+
+// DeleteAccount removes the signed-in user's account. With "reassign" their
+// tasks move to another user and the account is deleted outright. With
+// "anonymize" tasks shared with other people are kept, the user's private
+// tasks are deleted and the account is reduced to a nameless tombstone so
+// existing references to it still resolve.
+func DeleteAccount(c *gin.Context) {
+    var input struct {
+        Password   string `json:"password"`
+        Code       string `json:"code"`
+        Tasks      string `json:"tasks" binding:"required,oneof=reassign anonymize"`
+        ReassignTo string `json:"reassign_to"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !reauthenticate(c, user, input.Password, input.Code) {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    users := database.GetCollection("users")
+    if user.EffectiveRole() == models.RoleAdmin {
+        n, err := users.CountDocuments(ctx, bson.M{
+            "_id":      bson.M{"$ne": user.ID},
+            "role":     models.RoleAdmin,
+            "disabled": bson.M{"$ne": true},
+        })
+        if err != nil {
+            c.JSON(500, gin.H{"error": "Failed to delete account"})
+            return
+        }
+        if n == 0 {
+            c.JSON(409, gin.H{"error": "The last administrator cannot delete their account"})
+            return
+        }
+    }
+
+    details := map[string]interface{}{"tasks": input.Tasks}
+    if input.Tasks == "reassign" {
+        toID, err := primitive.ObjectIDFromHex(input.ReassignTo)
+        if err != nil || toID == user.ID {
+            c.JSON(400, gin.H{"error": "Invalid reassign_to user"})
+            return
+        }
+        if access, err := services.GetUserAccess(ctx, toID); err != nil || access.Disabled {
+            c.JSON(400, gin.H{"error": "Invalid reassign_to user"})
+            return
+        }
+        // Work can only be handed to someone the user already shares tasks with
+        collaborators, err := taskCollaborators(ctx, user.ID)
+        if err != nil {
+            log.Printf("Error loading task collaborators: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to delete account"})
+            return
+        }
+        if !containsID(collaborators, toID) {
+            c.JSON(400, gin.H{"error": "Invalid reassign_to user"})
+            return
+        }
+
+        assigned, created, err := reassignUserTasks(ctx, user.ID, toID)
+        if err != nil {
+            log.Printf("Error reassigning tasks of deleted account: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to delete account"})
+            return
+        }
+        details["reassign_to"] = toID.Hex()
+        details["assigned"] = assigned
+        details["created"] = created
+    } else {
+        removed, err := anonymizeUserTasks(ctx, user.ID)
+        if err != nil {
+            log.Printf("Error anonymizing tasks of deleted account: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to delete account"})
+            return
+        }
+        details["deleted_tasks"] = removed
+    }
+
+    if err := services.RevokeAllUserSessions(ctx, user.ID, primitive.NilObjectID); err != nil {
+        log.Printf("Error revoking sessions of deleted account: %v", err)
+    }
+    if err := services.RevokeAllAPITokens(ctx, user.ID); err != nil {
+        log.Printf("Error revoking API tokens of deleted account: %v", err)
+    }
+    if err := deleteAvatar(ctx, user.ID); err != nil {
+        log.Printf("Error deleting avatar of deleted account: %v", err)
+    }
+    for _, name := range []string{"external_identities", "user_tokens"} {
+        if _, err := database.GetCollection(name).DeleteMany(ctx, bson.M{"user_id": user.ID}); err != nil {
+            log.Printf("Error deleting %s of deleted account: %v", name, err)
+        }
+    }
+
+    var err error
+    if input.Tasks == "reassign" {
+        _, err = users.DeleteOne(ctx, bson.M{"_id": user.ID})
+    } else {
+        _, err = users.ReplaceOne(ctx, bson.M{"_id": user.ID}, models.User{
+            ID:        user.ID,
+            Name:      "Deleted user",
+            Email:     fmt.Sprintf("deleted-%s@deleted.invalid", user.ID.Hex()),
+            Role:      models.RoleUser,
+            Disabled:  true,
+            DeletedAt: timePtr(time.Now()),
+        })
+    }
+    if err != nil {
+        log.Printf("Error deleting account: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to delete account"})
+        return
+    }
+
+    services.RecordAudit(ctx, models.AuditLog{
+        Action:  models.AuditActionAccountDeleted,
+        UserID:  &user.ID,
+        IP:      c.ClientIP(),
+        Details: details,
+    })
+
+    c.JSON(200, gin.H{"message": "Account deleted successfully"})
+}
+
+// anonymizeUserTasks unassigns the user from other people's tasks and
+// deletes the tasks nobody else is involved in, with their subtasks and
+// suggestions. Tasks the user created for someone else are left in place.
+// It returns the number of deleted tasks.
+func anonymizeUserTasks(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+    _, err := services.TrashTasks(ctx, bson.M{
+        "created_by": userID,
+        "$or": []bson.M{
+            {"assigned_to": bson.M{"$exists": false}},
+            {"assigned_to": userID},
+        },
+    }, userID)
+    if err != nil {
+        return 0, err
+    }
+
+    // Nobody can restore from the account's trash any more, so it's
+    // emptied straight away
+    deleted, err := services.PurgeTasks(ctx, bson.M{"created_by": userID, "deleted_at": bson.M{"$ne": nil}})
+    if err != nil {
+        return deleted, err
+    }
+
+    _, err = database.GetCollection("tasks").UpdateMany(ctx,
+        bson.M{"assigned_to": userID},
+        bson.M{"$unset": bson.M{"assigned_to": ""}, "$set": bson.M{"updated_at": time.Now()}},
+    )
+    return deleted, err
+}
+
+func containsID(ids []interface{}, id primitive.ObjectID) bool {
+    for _, candidate := range ids {
+        if candidate == id {
+            return true
+        }
+    }
+    return false
+}
+
+func deleteAvatar(ctx context.Context, userID primitive.ObjectID) error {
+    if _, err := database.GetCollection("avatars").DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+        return err
+    }
+    _, err := database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": userID},
+        bson.M{"$unset": bson.M{"avatar_updated_at": "", "avatar_key": ""}},
+    )
+    return err
+}
+
+// reauthenticate confirms a sensitive change with the current password.
+// Accounts provisioned by single sign-on have none, so they confirm with a
+// two-factor code or by having signed in through the identity provider
+// within ssoReauthWindow. It writes the response itself when refusing.
+func reauthenticate(c *gin.Context, user *models.User, password, code string) bool {
+    if user.Password != "" {
+        if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+            c.JSON(401, gin.H{"error": "Invalid password"})
+            return false
+        }
+        return true
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if user.TwoFactorEnabled && code != "" {
+        ok, err := verifySecondFactor(ctx, user, code)
+        if err != nil {
+            log.Printf("Error verifying second factor: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to verify code"})
+            return false
+        }
+        if !ok {
+            c.JSON(401, gin.H{"error": "Invalid authentication code"})
+            return false
+        }
+        return true
+    }
+
+    // Refreshing tokens keeps the session's creation time, so only a new
+    // SSO login counts as fresh
+    sessionID, _ := primitive.ObjectIDFromHex(c.GetString("sessionId"))
+    session, err := services.GetActiveSession(ctx, sessionID, user.ID)
+    if err == nil && time.Since(session.CreatedAt) < ssoReauthWindow {
+        return true
+    }
+    if err != nil && err != services.ErrSessionNotFound {
+        log.Printf("Error loading session for reauthentication: %v", err)
+    }
+    c.JSON(401, gin.H{"error": "Sign in again with single sign-on to confirm this change", "reauth_required": true})
+    return false
+}
+
+// avatarURL changes with every upload so clients refetch after a change.
+func avatarURL(user models.User) string {
+    if user.AvatarKey == "" {
+        return ""
+    }
+    return "/api/avatars/" + user.AvatarKey
+}
+
+func timePtr(t time.Time) *time.Time {
+    return &t
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/services"
+)
+
+func GetSessions(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    sessions, err := services.ListSessions(ctx, userID)
+    if err != nil {
+        log.Printf("Error listing sessions: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to fetch sessions"})
+        return
+    }
+
+    currentID := c.GetString("sessionId")
+    response := make([]gin.H, 0, len(sessions))
+    for _, session := range sessions {
+        response = append(response, gin.H{
+            "id":           session.ID.Hex(),
+            "device":       session.Device,
+            "ip":           session.IP,
+            "user_agent":   session.UserAgent,
+            "created_at":   session.CreatedAt,
+            "last_seen_at": session.LastSeenAt,
+            "current":      session.ID.Hex() == currentID,
+        })
+    }
+
+    c.JSON(200, response)
+}
+
+func RevokeSession(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Invalid session ID"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    err = services.RevokeUserSession(ctx, sessionID, userID)
+    if err == services.ErrSessionNotFound {
+        c.JSON(404, gin.H{"error": "Session not found"})
+        return
+    }
+    if err != nil {
+        log.Printf("Error revoking session: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to revoke session"})
+        return
+    }
+
+    c.JSON(200, gin.H{"message": "Session revoked successfully"})
+}
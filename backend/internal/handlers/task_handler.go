@@ -20,33 +20,36 @@ func CreateTask(c *gin.Context) {
         return
     }
 
-    userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+    if !checkAssignee(c, task.AssignedTo) {
+        return
+    }
+
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if task.ParentID != nil && !checkParentTask(c, *task.ParentID, userID) {
+        return
+    }
+
     task.ID = primitive.NewObjectID()
     task.CreatedBy = userID
     task.CreatedAt = time.Now()
     task.UpdatedAt = time.Now()
 
-    collection := database.Client.Database("taskmanagement").Collection("tasks")
+    collection := database.GetCollection("tasks")
     _, err := collection.InsertOne(context.Background(), task)
     if err != nil {
         c.JSON(500, gin.H{"error": "Failed to create task"})
         return
     }
 
-  
-    aiService, err := services.NewAIService(os.Getenv("OPENAI_API_KEY"))
-    if err == nil {
-        suggestions, err := aiService.GenerateResponse(task.Title + ": " + task.Description)
-        if err != nil {
-            log.Printf("Error generating AI suggestions: %v", err)
-        } else {
-            
-            suggCollection := database.Client.Database("taskmanagement").Collection("ai_suggestions")
-            suggCollection.InsertOne(context.Background(), models.AITaskSuggestion{
-                TaskID:      task.ID,
-                Suggestion:  suggestions,
-                GeneratedAt: time.Now(),
-            })
+
+    // Suggestions are generated in the background and pushed to the
+    // creator over WebSocket; GET /api/tasks/:id/suggestions returns them.
+    // Users over their AI quota and API tokens without the AI scope just
+    // don't get them
+    usageCtx := services.WithAIUsage(context.Background(), userID, models.AIFeatureTaskSuggestions)
+    if services.AI != nil && callerHasScope(c, models.ScopeAIUse) && services.CheckAIQuota(usageCtx) == nil {
+        if _, err := services.EnqueueTaskSuggestion(context.Background(), task.ID, userID); err != nil {
+            log.Printf("Error queueing AI suggestions: %v", err)
         }
     }
 
@@ -54,14 +57,15 @@ func CreateTask(c *gin.Context) {
 }
 
 func GetTasks(c *gin.Context) {
-    userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
     
-    collection := database.Client.Database("taskmanagement").Collection("tasks")
+    collection := database.GetCollection("tasks")
     cursor, err := collection.Find(context.Background(), bson.M{
         "$or": []bson.M{
             {"created_by": userID},
             {"assigned_to": userID},
         },
+        "deleted_at": nil,
     })
     
     if err != nil {
@@ -80,20 +84,78 @@ func GetTasks(c *gin.Context) {
 
 func UpdateTask(c *gin.Context) {
     taskID, _ := primitive.ObjectIDFromHex(c.Param("id"))
-    var updateData models.Task
-    
-    if err := c.ShouldBindJSON(&updateData); err != nil {
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+
+    // Only the fields the client sent are written, so ownership and
+    // timestamps can't be overwritten through the request body
+    var input struct {
+        Title           *string             `json:"title"`
+        Description     *string             `json:"description"`
+        Status          *string             `json:"status"`
+        Priority        *string             `json:"priority"`
+        DueDate         *time.Time          `json:"due_date"`
+        AssignedTo      *primitive.ObjectID `json:"assigned_to"`
+        Tags            *[]string           `json:"tags"`
+        ParentID        *primitive.ObjectID `json:"parent_id"`
+        EstimateMinutes *int                `json:"estimate_minutes"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
         c.JSON(400, gin.H{"error": err.Error()})
         return
     }
 
-    updateData.UpdatedAt = time.Now()
+    set := bson.M{"updated_at": time.Now()}
+    if input.Title != nil {
+        set["title"] = *input.Title
+    }
+    if input.Description != nil {
+        set["description"] = *input.Description
+    }
+    if input.Status != nil {
+        set["status"] = *input.Status
+    }
+    if input.Priority != nil {
+        set["priority"] = *input.Priority
+    }
+    if input.DueDate != nil {
+        set["due_date"] = *input.DueDate
+    }
+    if input.AssignedTo != nil {
+        if !checkAssignee(c, *input.AssignedTo) {
+            return
+        }
+        set["assigned_to"] = *input.AssignedTo
+    }
+    if input.Tags != nil {
+        set["tags"] = *input.Tags
+    }
+    if input.ParentID != nil {
+        if *input.ParentID == taskID {
+            c.JSON(400, gin.H{"error": "A task cannot be its own parent"})
+            return
+        }
+        if !checkParentTask(c, *input.ParentID, userID) {
+            return
+        }
+        set["parent_id"] = *input.ParentID
+    }
+    if input.EstimateMinutes != nil {
+        set["estimate_minutes"] = *input.EstimateMinutes
+    }
 
-    collection := database.Client.Database("taskmanagement").Collection("tasks")
+    collection := database.GetCollection("tasks")
     result, err := collection.UpdateOne(
         context.Background(),
-        bson.M{"_id": taskID},
-        bson.M{"$set": updateData},
+        bson.M{
+            "_id": taskID,
+            "$or": []bson.M{
+                {"created_by": userID},
+                {"assigned_to": userID},
+            },
+            "deleted_at": nil,
+        },
+        bson.M{"$set": set},
     )
 
     if err != nil {
@@ -101,7 +163,7 @@ func UpdateTask(c *gin.Context) {
         return
     }
 
-    if result.ModifiedCount == 0 {
+    if result.MatchedCount == 0 {
         c.JSON(404, gin.H{"error": "Task not found"})
         return
     }
@@ -109,25 +171,108 @@ func UpdateTask(c *gin.Context) {
     c.JSON(200, gin.H{"message": "Task updated successfully"})
 }
 
+// DeleteTask moves the task and its subtasks to the trash, where they can
+// be restored until the purge job removes them for good.
 func DeleteTask(c *gin.Context) {
     taskID, _ := primitive.ObjectIDFromHex(c.Param("id"))
-    userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+    userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
 
-    collection := database.Client.Database("taskmanagement").Collection("tasks")
-    result, err := collection.DeleteOne(context.Background(), bson.M{
+    trashed, err := services.TrashTasks(context.Background(), bson.M{
         "_id": taskID,
         "created_by": userID,
-    })
+    }, userID)
 
     if err != nil {
         c.JSON(500, gin.H{"error": "Failed to delete task"})
         return
     }
 
-    if result.DeletedCount == 0 {
+    if trashed == 0 {
         c.JSON(404, gin.H{"error": "Task not found or unauthorized"})
         return
     }
 
-    c.JSON(200, gin.H{"message": "Task deleted successfully"})
-}
\ No newline at end of file
+    c.JSON(200, gin.H{"message": "Task moved to trash"})
+}
+
+// loadAccessibleTask fetches the :id task if the caller created it or is
+// assigned to it. Trashed tasks are treated as missing. It writes the error
+// response itself when the task can't be used.
+func loadAccessibleTask(c *gin.Context, ctx context.Context) (*models.Task, bool) {
+    taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Invalid task ID"})
+        return nil, false
+    }
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return nil, false
+    }
+
+    var task models.Task
+    err = database.GetCollection("tasks").FindOne(ctx, bson.M{
+        "_id": taskID,
+        "$or": []bson.M{
+            {"created_by": userID},
+            {"assigned_to": userID},
+        },
+        "deleted_at": nil,
+    }).Decode(&task)
+    if err != nil {
+        c.JSON(404, gin.H{"error": "Task not found"})
+        return nil, false
+    }
+    return &task, true
+}
+
+// checkParentTask makes sure a subtask is only attached to a task the user
+// can see. It writes the error response itself.
+func checkParentTask(c *gin.Context, parentID primitive.ObjectID, userID primitive.ObjectID) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    count, err := database.GetCollection("tasks").CountDocuments(ctx, bson.M{
+        "_id": parentID,
+        "$or": []bson.M{
+            {"created_by": userID},
+            {"assigned_to": userID},
+        },
+        "deleted_at": nil,
+    })
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to check parent task"})
+        return false
+    }
+    if count == 0 {
+        c.JSON(400, gin.H{"error": "Parent task not found"})
+        return false
+    }
+    return true
+}
+
+// checkAssignee enforces REQUIRE_VERIFIED_ASSIGNEE, rejecting assignment to
+// users who have not verified their email address. It writes the error
+// response itself and reports whether the handler may continue.
+func checkAssignee(c *gin.Context, assigneeID primitive.ObjectID) bool {
+    if assigneeID.IsZero() || os.Getenv("REQUIRE_VERIFIED_ASSIGNEE") != "true" {
+        return true
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var assignee models.User
+    err := database.GetCollection("users").FindOne(ctx, bson.M{"_id": assigneeID}).Decode(&assignee)
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Assignee not found"})
+        return false
+    }
+
+    if !assignee.EmailVerified {
+        c.JSON(422, gin.H{"error": "Assignee has not verified their email address"})
+        return false
+    }
+
+    return true
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+    "context"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+// newTaskRouter serves the task and trash routes as userID, skipping the
+// auth middleware.
+func newTaskRouter(userID primitive.ObjectID) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("userId", userID.Hex())
+    })
+    r.PUT("/api/tasks/:id", UpdateTask)
+    r.DELETE("/api/tasks/:id", DeleteTask)
+    r.POST("/api/trash/:id/restore", RestoreTask)
+    return r
+}
+
+func sendJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    return serve(r, req)
+}
+
+func TestUpdateTask(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    owner, stranger := primitive.NewObjectID(), primitive.NewObjectID()
+
+    taskID := primitive.NewObjectID()
+    tasks := database.GetCollection("tasks")
+    tasks.InsertOne(ctx, models.Task{ID: taskID, Title: "Draft", Description: "Keep me", Status: "todo", CreatedBy: owner, Tags: []string{"a"}})
+    path := "/api/tasks/" + taskID.Hex()
+
+    if rec := sendJSON(newTaskRouter(stranger), "PUT", path, `{"title":"Hijacked"}`); rec.Code != 404 {
+        t.Errorf("another user's task: status %d, want 404", rec.Code)
+    }
+
+    // Fields that weren't sent, including ownership, are left alone
+    body := `{"status":"done","created_by":"` + stranger.Hex() + `"}`
+    if rec := sendJSON(newTaskRouter(owner), "PUT", path, body); rec.Code != 200 {
+        t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+    }
+    var task models.Task
+    tasks.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task)
+    if task.Status != "done" || task.Title != "Draft" || task.Description != "Keep me" || len(task.Tags) != 1 || task.CreatedBy != owner {
+        t.Errorf("unexpected task after update: %+v", task)
+    }
+
+    if rec := sendJSON(newTaskRouter(owner), "PUT", path, `{"parent_id":"`+taskID.Hex()+`"}`); rec.Code != 400 {
+        t.Errorf("self parent: status %d, want 400", rec.Code)
+    }
+}
+
+func TestDeleteAndRestoreTask(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    owner := primitive.NewObjectID()
+    r := newTaskRouter(owner)
+
+    parent, child := primitive.NewObjectID(), primitive.NewObjectID()
+    tasks := database.GetCollection("tasks")
+    tasks.InsertMany(ctx, []interface{}{
+        models.Task{ID: parent, Title: "Parent", CreatedBy: owner},
+        models.Task{ID: child, Title: "Child", CreatedBy: owner, ParentID: &parent},
+    })
+
+    if rec := serve(r, httptest.NewRequest("DELETE", "/api/tasks/"+parent.Hex(), nil)); rec.Code != 200 {
+        t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body.String())
+    }
+    if n, _ := tasks.CountDocuments(ctx, bson.M{"deleted_at": bson.M{"$ne": nil}}); n != 2 {
+        t.Fatalf("want the task and its subtask in the trash, found %d", n)
+    }
+    if rec := sendJSON(r, "PUT", "/api/tasks/"+child.Hex(), `{"title":"Edited"}`); rec.Code != 404 {
+        t.Errorf("updating a trashed subtask: status %d, want 404", rec.Code)
+    }
+
+    if rec := serve(r, httptest.NewRequest("POST", "/api/trash/"+parent.Hex()+"/restore", nil)); rec.Code != 200 {
+        t.Fatalf("restore: status %d, body %s", rec.Code, rec.Body.String())
+    }
+    if n, _ := tasks.CountDocuments(ctx, bson.M{"deleted_at": nil}); n != 2 {
+        t.Errorf("want the task and its subtask restored, found %d live", n)
+    }
+}
+
+func TestCallerHasScope(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    if !callerHasScope(c, models.ScopeAIUse) {
+        t.Error("session logins have every scope")
+    }
+
+    c.Set("apiTokenId", "t1")
+    c.Set("scopes", []string{models.ScopeTasksWrite})
+    if callerHasScope(c, models.ScopeAIUse) {
+        t.Error("token without ai:use should not get AI suggestions")
+    }
+    c.Set("scopes", []string{models.ScopeTasksWrite, models.ScopeAIUse})
+    if !callerHasScope(c, models.ScopeAIUse) {
+        t.Error("token with ai:use was refused")
+    }
+}
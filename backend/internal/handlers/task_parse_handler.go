@@ -0,0 +1,153 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "regexp"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+type assigneeMatch struct {
+    ID   string `json:"id"`
+    Name string `json:"name"`
+}
+
+// ParseTask turns a sentence into a draft task without saving it. The client
+// shows the draft for the user to confirm or edit and then creates it with
+// POST /api/tasks. Due dates are resolved in the user's timezone. The AI
+// service is used when configured and allowed for the caller; otherwise a
+// rule-based parser handles common phrasings.
+func ParseTask(c *gin.Context) {
+    var input struct {
+        Text string `json:"text" binding:"required,max=1000"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer cancel()
+    ctx = aiContext(c, ctx, models.AIFeatureTaskParse)
+
+    var user models.User
+    if err := database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return
+    }
+    draft := services.ParseTaskText(ctx, input.Text, userLocation(user), callerHasScope(c, models.ScopeAIUse))
+
+    response := gin.H{
+        "task":   draft.Task,
+        "source": draft.Source,
+    }
+    if draft.Assignee != "" {
+        matches, err := findAssignees(ctx, userID, draft.Assignee)
+        if err != nil {
+            log.Printf("Error looking up assignee: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to parse task"})
+            return
+        }
+        // Only a single match is assigned; otherwise the user picks one
+        if len(matches) == 1 {
+            draft.Task.AssignedTo, _ = primitive.ObjectIDFromHex(matches[0].ID)
+            response["task"] = draft.Task
+        }
+        response["assignee"] = gin.H{"query": draft.Assignee, "matches": matches}
+    }
+
+    c.JSON(200, response)
+}
+
+// findAssignees matches active users whose name starts with the given word.
+// Only the caller and people they already share tasks with are considered,
+// so the endpoint can't be used to discover other accounts.
+func findAssignees(ctx context.Context, callerID primitive.ObjectID, name string) ([]assigneeMatch, error) {
+    collaborators, err := taskCollaborators(ctx, callerID)
+    if err != nil {
+        return nil, err
+    }
+
+    quoted := regexp.QuoteMeta(name)
+    cursor, err := database.GetCollection("users").Find(ctx, bson.M{
+        "_id":        bson.M{"$in": collaborators},
+        "name":       primitive.Regex{Pattern: "^" + quoted + `(\s|$)`, Options: "i"},
+        "disabled":   bson.M{"$ne": true},
+        "deleted_at": nil,
+    }, options.Find().SetLimit(5))
+    if err != nil {
+        return nil, err
+    }
+
+    var users []models.User
+    if err := cursor.All(ctx, &users); err != nil {
+        return nil, err
+    }
+
+    matches := make([]assigneeMatch, 0, len(users))
+    for _, user := range users {
+        matches = append(matches, assigneeMatch{ID: user.ID.Hex(), Name: user.Name})
+    }
+    return matches, nil
+}
+
+// taskCollaborators returns the caller and everyone who created or is
+// assigned a task the caller also created or is assigned.
+func taskCollaborators(ctx context.Context, callerID primitive.ObjectID) ([]interface{}, error) {
+    tasks := database.GetCollection("tasks")
+    filter := bson.M{
+        "$or": []bson.M{
+            {"created_by": callerID},
+            {"assigned_to": callerID},
+        },
+        "deleted_at": nil,
+    }
+
+    ids := []interface{}{callerID}
+    for _, field := range []string{"created_by", "assigned_to"} {
+        values, err := tasks.Distinct(ctx, field, filter)
+        if err != nil {
+            return nil, err
+        }
+        ids = append(ids, values...)
+    }
+    return ids, nil
+}
+
+// userLocation is the user's configured timezone, UTC by default.
+func userLocation(user models.User) *time.Location {
+    if user.Timezone != "" {
+        if loc, err := time.LoadLocation(user.Timezone); err == nil {
+            return loc
+        }
+    }
+    return time.UTC
+}
+
+// callerHasScope reports whether the request may use scope. Interactive
+// sessions have every scope; API tokens only those they were granted.
+func callerHasScope(c *gin.Context, scope string) bool {
+    if _, ok := c.Get("apiTokenId"); !ok {
+        return true
+    }
+    for _, granted := range c.GetStringSlice("scopes") {
+        if granted == scope {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+// GetTrash lists the caller's deleted tasks, most recently deleted first,
+// with the time each one will be purged.
+func GetTrash(c *gin.Context) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    cursor, err := database.GetCollection("tasks").Find(ctx,
+        bson.M{"created_by": userID, "deleted_at": bson.M{"$ne": nil}},
+        options.Find().SetSort(bson.M{"deleted_at": -1}),
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to fetch trash"})
+        return
+    }
+
+    var tasks []models.Task
+    if err := cursor.All(ctx, &tasks); err != nil {
+        c.JSON(500, gin.H{"error": "Failed to decode tasks"})
+        return
+    }
+
+    retention := services.TrashRetention()
+    response := make([]gin.H, 0, len(tasks))
+    for _, task := range tasks {
+        response = append(response, gin.H{
+            "task":     task,
+            "purge_at": task.DeletedAt.Add(retention),
+        })
+    }
+
+    c.JSON(200, response)
+}
+
+// RestoreTask takes a task out of the trash, along with the subtasks that
+// were trashed with it.
+func RestoreTask(c *gin.Context) {
+    taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{"error": "Invalid task ID"})
+        return
+    }
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // The update returns the task as it was, so its deleted_at identifies
+    // the subtasks that went to the trash with it
+    now := time.Now()
+    var task models.Task
+    err = database.GetCollection("tasks").FindOneAndUpdate(ctx,
+        bson.M{"_id": taskID, "created_by": userID, "deleted_at": bson.M{"$ne": nil}},
+        bson.M{
+            "$set":   bson.M{"updated_at": now},
+            "$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+        },
+    ).Decode(&task)
+    if err != nil {
+        c.JSON(404, gin.H{"error": "Task not found in trash"})
+        return
+    }
+
+    if err := services.RestoreSubtasks(ctx, task.ID, *task.DeletedAt); err != nil {
+        log.Printf("Error restoring subtasks: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to restore subtasks"})
+        return
+    }
+    task.UpdatedAt = now
+    task.DeletedAt = nil
+    task.DeletedBy = nil
+
+    c.JSON(200, task)
+}
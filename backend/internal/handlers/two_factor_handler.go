@@ -0,0 +1,365 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "os"
+    "time"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/middleware"
+    "task-management/internal/models"
+    "task-management/internal/services"
+)
+
+// LoginTwoFactor completes a login that Login answered with a challenge
+// token. The second factor is either a TOTP code or an unused recovery code.
+func LoginTwoFactor(c *gin.Context) {
+    var input struct {
+        ChallengeToken string `json:"challenge_token" binding:"required"`
+        Code           string `json:"code" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    claims, err := middleware.ValidateChallengeToken(input.ChallengeToken)
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Invalid or expired challenge"})
+        return
+    }
+
+    userID, err := primitive.ObjectIDFromHex(claims.UserId)
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Invalid or expired challenge"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var user models.User
+    err = database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+    if err != nil || !user.TwoFactorEnabled || user.Disabled {
+        c.JSON(401, gin.H{"error": "Invalid or expired challenge"})
+        return
+    }
+
+    if !checkLoginAllowed(c, ctx, user.Email) {
+        return
+    }
+
+    ok, err := verifySecondFactor(ctx, &user, input.Code)
+    if err != nil {
+        log.Printf("Error verifying second factor: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to verify code"})
+        return
+    }
+    if !ok {
+        recordLoginFailure(c, ctx, user.Email, &user)
+        c.JSON(401, gin.H{"error": "Invalid authentication code"})
+        return
+    }
+
+    if err := services.RecordLoginSuccess(ctx, user.Email); err != nil {
+        log.Printf("Error clearing login failures: %v", err)
+    }
+
+    respondWithTokens(c, ctx, user)
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "enabled":                  user.TwoFactorEnabled,
+        "recovery_codes_remaining": len(user.RecoveryCodes),
+    })
+}
+
+// EnrollTwoFactor generates a pending secret. Two-factor login is only
+// switched on once ConfirmTwoFactor sees a valid code for it.
+func EnrollTwoFactor(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if user.TwoFactorEnabled {
+        c.JSON(409, gin.H{"error": "Two-factor authentication is already enabled"})
+        return
+    }
+
+    secret, err := services.GenerateTOTPSecret()
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to generate secret"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"totp_pending_secret": secret}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to start enrollment"})
+        return
+    }
+
+    issuer := os.Getenv("TOTP_ISSUER")
+    if issuer == "" {
+        issuer = "TaskAI"
+    }
+
+    c.JSON(200, gin.H{
+        "secret":      secret,
+        "otpauth_uri": services.TOTPURI(issuer, user.Email, secret),
+    })
+}
+
+func ConfirmTwoFactor(c *gin.Context) {
+    var input struct {
+        Code string `json:"code" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if user.TOTPPendingSecret == "" {
+        c.JSON(400, gin.H{"error": "No two-factor enrollment in progress"})
+        return
+    }
+
+    step, valid := services.ValidateTOTP(user.TOTPPendingSecret, input.Code, time.Now())
+    if !valid {
+        c.JSON(400, gin.H{"error": "Invalid authentication code"})
+        return
+    }
+
+    codes, hashes, err := services.GenerateRecoveryCodes()
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to generate recovery codes"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{
+            "$set": bson.M{
+                "two_factor_enabled": true,
+                "totp_secret":        user.TOTPPendingSecret,
+                "totp_last_step":     step,
+                "recovery_codes":     hashes,
+            },
+            "$unset": bson.M{"totp_pending_secret": ""},
+        },
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to enable two-factor authentication"})
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "message":        "Two-factor authentication enabled",
+        "recovery_codes": codes,
+    })
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking the
+// password and a current code. Accounts without a password, which signed up
+// through SSO, confirm with the code alone.
+func DisableTwoFactor(c *gin.Context) {
+    var input struct {
+        Password string `json:"password"`
+        Code     string `json:"code" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !user.TwoFactorEnabled {
+        c.JSON(400, gin.H{"error": "Two-factor authentication is not enabled"})
+        return
+    }
+
+    if !reauthenticate(c, user, input.Password, input.Code) {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // Without a password, reauthenticate has already checked (and used up)
+    // the code
+    if user.Password != "" {
+        valid, err := verifySecondFactor(ctx, user, input.Code)
+        if err != nil {
+            log.Printf("Error verifying second factor: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to verify code"})
+            return
+        }
+        if !valid {
+            c.JSON(401, gin.H{"error": "Invalid authentication code"})
+            return
+        }
+    }
+
+    _, err := database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{
+            "$set": bson.M{"two_factor_enabled": false},
+            "$unset": bson.M{
+                "totp_secret":         "",
+                "totp_pending_secret": "",
+                "totp_last_step":      "",
+                "recovery_codes":      "",
+            },
+        },
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to disable two-factor authentication"})
+        return
+    }
+
+    c.JSON(200, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+    var input struct {
+        Code string `json:"code" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(400, gin.H{"error": err.Error()})
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !user.TwoFactorEnabled {
+        c.JSON(400, gin.H{"error": "Two-factor authentication is not enabled"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // Recovery codes can't be used to mint new recovery codes
+    step, valid := services.ValidateTOTP(user.TOTPSecret, input.Code, time.Now())
+    if valid {
+        var err error
+        valid, err = consumeTOTPStep(ctx, user.ID, step)
+        if err != nil {
+            log.Printf("Error verifying second factor: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to verify code"})
+            return
+        }
+    }
+    if !valid {
+        c.JSON(401, gin.H{"error": "Invalid authentication code"})
+        return
+    }
+
+    codes, hashes, err := services.GenerateRecoveryCodes()
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to generate recovery codes"})
+        return
+    }
+
+    _, err = database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"recovery_codes": hashes}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Failed to generate recovery codes"})
+        return
+    }
+
+    c.JSON(200, gin.H{"recovery_codes": codes})
+}
+
+// verifySecondFactor accepts either a current TOTP code or one of the user's
+// recovery codes, consuming whichever was used.
+func verifySecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+    if step, ok := services.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+        return consumeTOTPStep(ctx, user.ID, step)
+    }
+
+    hash := services.HashRecoveryCode(code)
+    result, err := database.GetCollection("users").UpdateOne(ctx,
+        bson.M{"_id": user.ID, "recovery_codes": hash},
+        bson.M{"$pull": bson.M{"recovery_codes": hash}},
+    )
+    if err != nil {
+        return false, err
+    }
+    return result.ModifiedCount == 1, nil
+}
+
+// consumeTOTPStep records step as the last accepted code so the same code
+// can't be replayed within its validity window.
+func consumeTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) (bool, error) {
+    result, err := database.GetCollection("users").UpdateOne(ctx,
+        bson.M{
+            "_id": userID,
+            "$or": []bson.M{
+                {"totp_last_step": bson.M{"$lt": step}},
+                {"totp_last_step": bson.M{"$exists": false}},
+            },
+        },
+        bson.M{"$set": bson.M{"totp_last_step": step}},
+    )
+    if err != nil {
+        return false, err
+    }
+    return result.ModifiedCount == 1, nil
+}
+
+// loadCurrentUser fetches the authenticated user, writing an error response
+// and returning false if that isn't possible.
+func loadCurrentUser(c *gin.Context) (*models.User, bool) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Unauthorized"})
+        return nil, false
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var user models.User
+    if err := database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+        c.JSON(404, gin.H{"error": "User not found"})
+        return nil, false
+    }
+    return &user, true
+}
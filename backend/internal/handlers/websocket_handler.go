@@ -2,12 +2,11 @@ package handlers
 
 import (
     "log"
-	"os"
     "net/http"
     
     "github.com/gin-gonic/gin"
     "github.com/gorilla/websocket"
-    "github.com/golang-jwt/jwt/v4"
+    "task-management/internal/models"
     "task-management/internal/services"
 )
 
@@ -19,32 +18,12 @@ var upgrader = websocket.Upgrader{
     },
 }
 
+// HandleWebSocket upgrades an authenticated request; the token has already
+// been checked by middleware.WebSocketAuthMiddleware.
 func HandleWebSocket(c *gin.Context) {
-    
-    token := c.Query("token")
-    if token == "" {
-        log.Printf("No token provided")
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "No token provided"})
-        return
-    }
-
-    
-    claims := jwt.MapClaims{}
-    _, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-        return []byte(os.Getenv("JWT_SECRET")), nil
-    })
-
-    if err != nil {
-        log.Printf("Invalid token: %v", err)
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-        return
-    }
-
-    // Get user ID from claims
-    userID, ok := claims["user_id"].(string)
-    if !ok {
-        log.Printf("User ID not found in token")
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+    userID := c.GetString("userId")
+    if userID == "" {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
         return
     }
 
@@ -59,10 +38,11 @@ func HandleWebSocket(c *gin.Context) {
 
     // Create client
     client := &services.Client{
-        Hub:  services.WebsocketHub,
-        ID:   userID,
-        Conn: conn,
-        Send: make(chan []byte, 256),
+        Hub:     services.WebsocketHub,
+        ID:      userID,
+        Conn:    conn,
+        Send:    make(chan []byte, 256),
+        AllowAI: callerHasScope(c, models.ScopeAIUse),
     }
 
     // Register client
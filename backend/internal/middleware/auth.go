@@ -2,17 +2,23 @@
 package middleware
 
 import (
+    "context"
     "fmt"
+    "log"
     "os"
     "strings"
     "time"
     "github.com/gin-gonic/gin"
-    "github.com/golang-jwt/jwt"
+    "github.com/golang-jwt/jwt/v4"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/services"
 )
 
 type Claims struct {
-    UserId string `json:"user_id"`
-    jwt.StandardClaims
+    UserId    string `json:"user_id"`
+    SessionId string `json:"sid"`
+    Purpose   string `json:"purpose,omitempty"`
+    jwt.RegisteredClaims
 }
 
 func CORSMiddleware() gin.HandlerFunc {
@@ -31,36 +37,81 @@ func CORSMiddleware() gin.HandlerFunc {
     }
 }
 
-func GenerateToken(userId string) (string, error) {
-    secret := os.Getenv("JWT_SECRET")
-    if secret == "" {
-        return "", fmt.Errorf("JWT_SECRET not set")
+// AccessTokenTTL keeps access tokens short-lived; clients renew them with a
+// refresh token rather than holding a long-lived bearer token.
+func AccessTokenTTL() time.Duration {
+    if ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+        return ttl
     }
+    return 15 * time.Minute
+}
+
+const (
+    challengeTokenTTL     = 5 * time.Minute
+    purposeTwoFactorLogin = "2fa"
+)
 
-    claims := Claims{
-        UserId: userId,
-        StandardClaims: jwt.StandardClaims{
-            ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
-            IssuedAt:  time.Now().Unix(),
+func GenerateToken(userId string, sessionId string) (string, error) {
+    return signToken(Claims{
+        UserId:    userId,
+        SessionId: sessionId,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
+            IssuedAt:  jwt.NewNumericDate(time.Now()),
         },
-    }
+    })
+}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(secret))
+// GenerateChallengeToken issues the intermediate token handed out after a
+// correct password when the account still needs a second factor. It can only
+// be exchanged at the two-factor login endpoint, never used as an access token.
+func GenerateChallengeToken(userId string) (string, error) {
+    return signToken(Claims{
+        UserId:  userId,
+        Purpose: purposeTwoFactorLogin,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeTokenTTL)),
+            IssuedAt:  jwt.NewNumericDate(time.Now()),
+        },
+    })
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-    secret := os.Getenv("JWT_SECRET")
-    if secret == "" {
-        return nil, fmt.Errorf("JWT_SECRET not set")
+    claims, err := parseToken(tokenString)
+    if err != nil {
+        return nil, err
+    }
+    if claims.Purpose != "" {
+        return nil, fmt.Errorf("invalid token")
+    }
+    return claims, nil
+}
+
+func ValidateChallengeToken(tokenString string) (*Claims, error) {
+    claims, err := parseToken(tokenString)
+    if err != nil {
+        return nil, err
     }
+    if claims.Purpose != purposeTwoFactorLogin {
+        return nil, fmt.Errorf("invalid token")
+    }
+    return claims, nil
+}
 
-    claims := &Claims{}
-    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-        return []byte(secret), nil
-    })
+func signToken(claims Claims) (string, error) {
+    if services.Tokens == nil {
+        return "", fmt.Errorf("token service not initialized")
+    }
+    return services.Tokens.Sign(claims)
+}
 
-    if err != nil || !token.Valid {
+func parseToken(tokenString string) (*Claims, error) {
+    if services.Tokens == nil {
+        return nil, fmt.Errorf("token service not initialized")
+    }
+
+    claims := &Claims{}
+    if err := services.Tokens.Parse(tokenString, claims); err != nil {
         return nil, fmt.Errorf("invalid token")
     }
 
@@ -83,14 +134,179 @@ func AuthMiddleware() gin.HandlerFunc {
             return
         }
 
-        claims, err := ValidateToken(tokenString)
-        if err != nil {
+        if authenticate(c, tokenString) {
+            c.Next()
+        }
+    }
+}
+
+// WebSocketAuthMiddleware authenticates WebSocket upgrades, which browsers
+// can't attach an Authorization header to, from the token query parameter.
+func WebSocketAuthMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        tokenString := c.Query("token")
+        if tokenString == "" {
+            c.JSON(401, gin.H{"error": "No token provided"})
+            c.Abort()
+            return
+        }
+
+        if authenticate(c, tokenString) {
+            c.Next()
+        }
+    }
+}
+
+// authenticate validates an access token or API token and stores the caller
+// on the context. On failure it writes the response, aborts and returns false.
+func authenticate(c *gin.Context, tokenString string) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if services.IsAPIToken(tokenString) {
+        token, err := services.AuthenticateAPIToken(ctx, tokenString, c.ClientIP())
+        if err == services.ErrAPITokenInvalid {
             c.JSON(401, gin.H{"error": "Invalid token"})
             c.Abort()
+            return false
+        }
+        if err != nil {
+            log.Printf("Error loading API token: %v", err)
+            c.JSON(500, gin.H{"error": "Failed to verify token"})
+            c.Abort()
+            return false
+        }
+
+        if !authorizeUser(c, ctx, token.UserID) {
+            return false
+        }
+
+        c.Set("userId", token.UserID.Hex())
+        c.Set("apiTokenId", token.ID.Hex())
+        c.Set("scopes", token.Scopes)
+        return true
+    }
+
+    claims, err := ValidateToken(tokenString)
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Invalid token"})
+        c.Abort()
+        return false
+    }
+
+    userID, err := primitive.ObjectIDFromHex(claims.UserId)
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Invalid token"})
+        c.Abort()
+        return false
+    }
+    sessionID, err := primitive.ObjectIDFromHex(claims.SessionId)
+    if err != nil {
+        c.JSON(401, gin.H{"error": "Invalid token"})
+        c.Abort()
+        return false
+    }
+
+    // Access tokens outlive a logout, so the session is checked on every request
+    session, err := services.GetActiveSession(ctx, sessionID, userID)
+    if err == services.ErrSessionNotFound {
+        c.JSON(401, gin.H{"error": "Session expired or revoked"})
+        c.Abort()
+        return false
+    }
+    if err != nil {
+        log.Printf("Error loading session: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to verify session"})
+        c.Abort()
+        return false
+    }
+
+    if err := services.TouchSession(ctx, session, c.ClientIP(), c.Request.UserAgent()); err != nil {
+        log.Printf("Error updating session activity: %v", err)
+    }
+
+    if !authorizeUser(c, ctx, userID) {
+        return false
+    }
+
+    c.Set("userId", claims.UserId)
+    c.Set("sessionId", claims.SessionId)
+    return true
+}
+
+// authorizeUser loads the caller's role and blocks disabled accounts. Both
+// are read on every request so admin changes apply immediately.
+func authorizeUser(c *gin.Context, ctx context.Context, userID primitive.ObjectID) bool {
+    access, err := services.GetUserAccess(ctx, userID)
+    if err == services.ErrUserNotFound {
+        c.JSON(401, gin.H{"error": "Invalid token"})
+        c.Abort()
+        return false
+    }
+    if err != nil {
+        log.Printf("Error loading user access: %v", err)
+        c.JSON(500, gin.H{"error": "Failed to verify user"})
+        c.Abort()
+        return false
+    }
+
+    if access.Disabled {
+        c.JSON(403, gin.H{"error": "Account disabled"})
+        c.Abort()
+        return false
+    }
+
+    c.Set("role", access.Role)
+    return true
+}
+
+// RequireRole allows the request through only if the caller has one of
+// roles. It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        role := c.GetString("role")
+        for _, allowed := range roles {
+            if role == allowed {
+                c.Next()
+                return
+            }
+        }
+
+        c.JSON(403, gin.H{"error": "Insufficient permissions"})
+        c.Abort()
+    }
+}
+
+// RequireScope limits API token requests to tokens granted scope. Requests
+// authenticated with a login session are not restricted.
+func RequireScope(scope string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if _, ok := c.Get("apiTokenId"); !ok {
+            c.Next()
             return
         }
 
-        c.Set("userId", claims.UserId)
+        for _, granted := range c.GetStringSlice("scopes") {
+            if granted == scope {
+                c.Next()
+                return
+            }
+        }
+
+        c.JSON(403, gin.H{"error": fmt.Sprintf("API token is missing the %s scope", scope)})
+        c.Abort()
+    }
+}
+
+// RequireSession rejects API tokens on account management routes, so a
+// leaked token can't be used to mint more tokens or change security settings.
+func RequireSession() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if c.GetString("sessionId") == "" {
+            c.JSON(403, gin.H{"error": "This endpoint requires an interactive login"})
+            c.Abort()
+            return
+        }
         c.Next()
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+    "net/http/httptest"
+    "testing"
+    "github.com/gin-gonic/gin"
+    "task-management/internal/models"
+)
+
+// run sends a request through handler after setting the given context
+// values, the way AuthMiddleware would, and returns the status code.
+func run(handler gin.HandlerFunc, values gin.H) int {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.GET("/", func(c *gin.Context) {
+        for k, v := range values {
+            c.Set(k, v)
+        }
+        c.Next()
+    }, handler, func(c *gin.Context) {
+        c.Status(204)
+    })
+
+    rec := httptest.NewRecorder()
+    r.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+    return rec.Code
+}
+
+func TestRequireRole(t *testing.T) {
+    handler := RequireRole(models.RoleAdmin)
+    if got := run(handler, gin.H{"role": models.RoleAdmin}); got != 204 {
+        t.Errorf("admin: status %d, want 204", got)
+    }
+    if got := run(handler, gin.H{"role": models.RoleUser}); got != 403 {
+        t.Errorf("user: status %d, want 403", got)
+    }
+    if got := run(handler, gin.H{}); got != 403 {
+        t.Errorf("no role: status %d, want 403", got)
+    }
+}
+
+func TestRequireScope(t *testing.T) {
+    tests := []struct {
+        name   string
+        values gin.H
+        want   int
+    }{
+        {"session login", gin.H{"sessionId": "abc"}, 204},
+        {"token with scope", gin.H{"apiTokenId": "t1", "scopes": []string{models.ScopeTasksRead, models.ScopeAIUse}}, 204},
+        {"token without scope", gin.H{"apiTokenId": "t1", "scopes": []string{models.ScopeTasksRead}}, 403},
+        {"token without scopes", gin.H{"apiTokenId": "t1"}, 403},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := run(RequireScope(models.ScopeAIUse), tt.values); got != tt.want {
+                t.Errorf("status %d, want %d", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRequireSession(t *testing.T) {
+    if got := run(RequireSession(), gin.H{"sessionId": "abc"}); got != 204 {
+        t.Errorf("session login: status %d, want 204", got)
+    }
+    if got := run(RequireSession(), gin.H{"apiTokenId": "t1"}); got != 403 {
+        t.Errorf("API token: status %d, want 403", got)
+    }
+}
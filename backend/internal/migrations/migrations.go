@@ -0,0 +1,550 @@
+package migrations
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+)
+
+// All lists every migration in version order. Append new ones at the end
+// and never change a migration once it has been released.
+var All = []database.Migration{
+    {
+        Version:     1,
+        Description: "Normalize user emails and add a unique case-insensitive email index",
+        Up:          normalizeUserEmails,
+        Down:        dropIndexes("users", "email_unique"),
+    },
+    {
+        Version:     2,
+        Description: "Add task indexes on created_by, assigned_to and due_date",
+        Up: createIndexes("tasks",
+            index("created_by_1", bson.D{{Key: "created_by", Value: 1}}),
+            index("assigned_to_1", bson.D{{Key: "assigned_to", Value: 1}}),
+            index("due_date_1", bson.D{{Key: "due_date", Value: 1}}),
+        ),
+        Down: dropIndexes("tasks", "created_by_1", "assigned_to_1", "due_date_1"),
+    },
+    {
+        Version:     3,
+        Description: "Add indexes for sessions, tokens and login attempts",
+        Up:          createAuthIndexes,
+        Down:        dropAuthIndexes,
+    },
+    {
+        Version:     4,
+        Description: "Move tasks and AI suggestions out of the legacy taskmanagement database",
+        Up:          moveLegacyTaskData,
+    },
+    {
+        Version:     5,
+        Description: "Add a task index on deleted_at for the trash",
+        Up:          createIndexes("tasks", index("deleted_at_1", bson.D{{Key: "deleted_at", Value: 1}})),
+        Down:        dropIndexes("tasks", "deleted_at_1"),
+    },
+    {
+        Version:     6,
+        Description: "Add AI suggestion indexes for the job queue and per-task lookups",
+        Up: createIndexes("ai_suggestions",
+            index("status_1_next_attempt_at_1", bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}),
+            index("task_id_1_created_at_-1", bson.D{{Key: "task_id", Value: 1}, {Key: "created_at", Value: -1}}),
+        ),
+        Down: dropIndexes("ai_suggestions", "status_1_next_attempt_at_1", "task_id_1_created_at_-1"),
+    },
+    {
+        Version:     7,
+        Description: "Add unique suggestion versions per task and a subtask index",
+        Up:          createSuggestionVersionIndexes,
+        Down: func(ctx context.Context, db *mongo.Database) error {
+            if err := dropIndexes("ai_suggestions", "task_id_1_version_1")(ctx, db); err != nil {
+                return err
+            }
+            return dropIndexes("tasks", "parent_id_1")(ctx, db)
+        },
+    },
+    {
+        Version:     8,
+        Description: "Add a unique per-day index and expiry for AI plans",
+        Up:          createPlanIndexes,
+        Down:        dropIndexes("ai_plans", "user_id_1_date_1", "generated_at_ttl"),
+    },
+    {
+        Version:     9,
+        Description: "Add a unique per-day index for AI usage",
+        Up:          createAIUsageIndexes,
+        Down:        dropIndexes("ai_usage", "user_id_1_date_-1"),
+    },
+    {
+        Version:     10,
+        Description: "Expire AI cache entries",
+        Up:          createAICacheIndexes,
+        Down:        dropIndexes("ai_cache", "expires_at_ttl"),
+    },
+    {
+        Version:     11,
+        Description: "Replace the case-insensitive email index with a plain unique index",
+        Up:          replaceEmailIndex,
+        Down:        restoreCollatedEmailIndex,
+    },
+    {
+        Version:     12,
+        Description: "Expire auth records and make token hashes and external identities unique",
+        Up:          createAuthExpiryIndexes,
+        Down:        dropAuthExpiryIndexes,
+    },
+    {
+        Version:     13,
+        Description: "Give avatars random keys for public URLs",
+        Up:          createAvatarKeys,
+        Down:        dropIndexes("avatars", "key_1"),
+    },
+    {
+        Version:     14,
+        Description: "Make login attempt keys unique",
+        Up:          uniqueLoginAttemptKeys,
+        Down: func(ctx context.Context, db *mongo.Database) error {
+            if err := dropIndexes("login_attempts", "key_1")(ctx, db); err != nil {
+                return err
+            }
+            return createIndexes("login_attempts", index("key_1", bson.D{{Key: "key", Value: 1}}))(ctx, db)
+        },
+    },
+}
+
+// Concurrent failed logins could each upsert a document for the same key,
+// splitting the failure count. Duplicates are merged into one document that
+// keeps their combined failures and the latest of each time before the
+// index is rebuilt as unique.
+func uniqueLoginAttemptKeys(ctx context.Context, db *mongo.Database) error {
+    attempts := db.Collection("login_attempts")
+    cursor, err := attempts.Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$group", Value: bson.M{
+            "_id":             "$key",
+            "ids":             bson.M{"$push": "$_id"},
+            "failures":        bson.M{"$sum": "$failures"},
+            "last_failure_at": bson.M{"$max": "$last_failure_at"},
+            "next_allowed_at": bson.M{"$max": "$next_allowed_at"},
+            "locked_until":    bson.M{"$max": "$locked_until"},
+        }}},
+        {{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+    })
+    if err != nil {
+        return err
+    }
+    defer cursor.Close(ctx)
+
+    for cursor.Next(ctx) {
+        var group struct {
+            IDs           []primitive.ObjectID `bson:"ids"`
+            Failures      int                  `bson:"failures"`
+            LastFailureAt primitive.DateTime   `bson:"last_failure_at"`
+            NextAllowedAt *primitive.DateTime  `bson:"next_allowed_at"`
+            LockedUntil   *primitive.DateTime  `bson:"locked_until"`
+        }
+        if err := cursor.Decode(&group); err != nil {
+            return err
+        }
+
+        set := bson.M{"failures": group.Failures, "last_failure_at": group.LastFailureAt}
+        if group.NextAllowedAt != nil {
+            set["next_allowed_at"] = *group.NextAllowedAt
+        }
+        if group.LockedUntil != nil {
+            set["locked_until"] = *group.LockedUntil
+        }
+        if _, err := attempts.UpdateOne(ctx, bson.M{"_id": group.IDs[0]}, bson.M{"$set": set}); err != nil {
+            return err
+        }
+        if _, err := attempts.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+            return err
+        }
+    }
+    if err := cursor.Err(); err != nil {
+        return err
+    }
+
+    if err := dropIndexes("login_attempts", "key_1")(ctx, db); err != nil {
+        return err
+    }
+    model := index("key_1", bson.D{{Key: "key", Value: 1}})
+    model.Options.SetUnique(true)
+    return createIndexes("login_attempts", model)(ctx, db)
+}
+
+// Avatars uploaded before keys existed get one here. The index is sparse
+// so an avatar written by an older instance mid-rollout doesn't collide.
+func createAvatarKeys(ctx context.Context, db *mongo.Database) error {
+    avatars, users := db.Collection("avatars"), db.Collection("users")
+    cursor, err := avatars.Find(ctx, bson.M{"key": bson.M{"$exists": false}}, options.Find().SetProjection(bson.M{"_id": 1}))
+    if err != nil {
+        return err
+    }
+    defer cursor.Close(ctx)
+
+    for cursor.Next(ctx) {
+        var avatar struct {
+            UserID primitive.ObjectID `bson:"_id"`
+        }
+        if err := cursor.Decode(&avatar); err != nil {
+            return err
+        }
+        b := make([]byte, 32)
+        if _, err := rand.Read(b); err != nil {
+            return err
+        }
+        key := base64.RawURLEncoding.EncodeToString(b)
+
+        if _, err := avatars.UpdateOne(ctx, bson.M{"_id": avatar.UserID}, bson.M{"$set": bson.M{"key": key}}); err != nil {
+            return err
+        }
+        if _, err := users.UpdateOne(ctx, bson.M{"_id": avatar.UserID}, bson.M{"$set": bson.M{"avatar_key": key}}); err != nil {
+            return err
+        }
+    }
+    if err := cursor.Err(); err != nil {
+        return err
+    }
+
+    model := index("key_1", bson.D{{Key: "key", Value: 1}})
+    model.Options.SetUnique(true).SetSparse(true)
+    return createIndexes("avatars", model)(ctx, db)
+}
+
+// authExpiryIndexes removes sessions, tokens and login state once they can
+// no longer be used. Login attempts only matter within the failure window
+// and lockout, both well under a day unless configured otherwise.
+var authExpiryIndexes = map[string]mongo.IndexModel{
+    "sessions":       ttlIndex("expires_at_ttl", "expires_at", 0),
+    "refresh_tokens": ttlIndex("expires_at_ttl", "expires_at", 0),
+    "user_tokens":    ttlIndex("expires_at_ttl", "expires_at", 0),
+    "oidc_states":    ttlIndex("expires_at_ttl", "expires_at", 0),
+    "login_attempts": ttlIndex("last_failure_at_ttl", "last_failure_at", 24*60*60),
+}
+
+// authUniqueIndexes replace plain indexes from migration 3. An index can't
+// be made unique in place, so each is dropped and rebuilt.
+var authUniqueIndexes = map[string]mongo.IndexModel{
+    "refresh_tokens":      index("token_hash_1", bson.D{{Key: "token_hash", Value: 1}}),
+    "user_tokens":         index("token_hash_1", bson.D{{Key: "token_hash", Value: 1}}),
+    "api_tokens":          index("token_hash_1", bson.D{{Key: "token_hash", Value: 1}}),
+    "external_identities": index("issuer_1_subject_1", bson.D{{Key: "issuer", Value: 1}, {Key: "subject", Value: 1}}),
+}
+
+func createAuthExpiryIndexes(ctx context.Context, db *mongo.Database) error {
+    for collection, model := range authExpiryIndexes {
+        if err := createIndexes(collection, model)(ctx, db); err != nil {
+            return err
+        }
+    }
+    for collection, model := range authUniqueIndexes {
+        if err := dropIndexes(collection, *model.Options.Name)(ctx, db); err != nil {
+            return err
+        }
+        unique := index(*model.Options.Name, model.Keys.(bson.D))
+        unique.Options.SetUnique(true)
+        if err := createIndexes(collection, unique)(ctx, db); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func dropAuthExpiryIndexes(ctx context.Context, db *mongo.Database) error {
+    for collection, model := range authExpiryIndexes {
+        if err := dropIndexes(collection, *model.Options.Name)(ctx, db); err != nil {
+            return err
+        }
+    }
+    for collection, model := range authUniqueIndexes {
+        if err := dropIndexes(collection, *model.Options.Name)(ctx, db); err != nil {
+            return err
+        }
+        if err := createIndexes(collection, model)(ctx, db); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Queries only use an index with a collation when they specify the same
+// one, so lookups by email never used email_unique. Emails are stored
+// normalized, which makes a plain index just as strict. The new index is
+// built before the old one goes so uniqueness is enforced throughout.
+func replaceEmailIndex(ctx context.Context, db *mongo.Database) error {
+    model := index("email_1", bson.D{{Key: "email", Value: 1}})
+    model.Options.SetUnique(true)
+    if err := createIndexes("users", model)(ctx, db); err != nil {
+        return err
+    }
+    return dropIndexes("users", "email_unique")(ctx, db)
+}
+
+func restoreCollatedEmailIndex(ctx context.Context, db *mongo.Database) error {
+    model := index("email_unique", bson.D{{Key: "email", Value: 1}})
+    model.Options.SetUnique(true).SetCollation(&options.Collation{Locale: "en", Strength: 2})
+    if err := createIndexes("users", model)(ctx, db); err != nil {
+        return err
+    }
+    return dropIndexes("users", "email_1")(ctx, db)
+}
+
+func createAICacheIndexes(ctx context.Context, db *mongo.Database) error {
+    model := index("expires_at_ttl", bson.D{{Key: "expires_at", Value: 1}})
+    model.Options.SetExpireAfterSeconds(0)
+    return createIndexes("ai_cache", model)(ctx, db)
+}
+
+func createAIUsageIndexes(ctx context.Context, db *mongo.Database) error {
+    model := index("user_id_1_date_-1", bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: -1}})
+    model.Options.SetUnique(true)
+    return createIndexes("ai_usage", model)(ctx, db)
+}
+
+// Plans are only read on the day they were made, so they expire after a week.
+func createPlanIndexes(ctx context.Context, db *mongo.Database) error {
+    unique := index("user_id_1_date_1", bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: 1}})
+    unique.Options.SetUnique(true)
+    ttl := index("generated_at_ttl", bson.D{{Key: "generated_at", Value: 1}})
+    ttl.Options.SetExpireAfterSeconds(7 * 24 * 60 * 60)
+    return createIndexes("ai_plans", unique, ttl)(ctx, db)
+}
+
+// Suggestions stored before versioning have no version, so they are left
+// out of the unique index.
+func createSuggestionVersionIndexes(ctx context.Context, db *mongo.Database) error {
+    model := index("task_id_1_version_1", bson.D{{Key: "task_id", Value: 1}, {Key: "version", Value: 1}})
+    model.Options.SetUnique(true).SetPartialFilterExpression(bson.M{"version": bson.M{"$exists": true}})
+    if err := createIndexes("ai_suggestions", model)(ctx, db); err != nil {
+        return err
+    }
+    return createIndexes("tasks", index("parent_id_1", bson.D{{Key: "parent_id", Value: 1}}))(ctx, db)
+}
+
+// The unique index rejects addresses differing only in case, matching how
+// models.NormalizeEmail stores them. Accounts that would collide once
+// normalized are reported before any email is rewritten, since picking which
+// one to keep is up to an operator.
+func normalizeUserEmails(ctx context.Context, db *mongo.Database) error {
+    users := db.Collection("users")
+    normalized := bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}
+
+    cursor, err := users.Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$group", Value: bson.M{
+            "_id":   normalized,
+            "users": bson.M{"$push": bson.M{"id": "$_id", "email": "$email"}},
+            "count": bson.M{"$sum": 1},
+        }}},
+        {{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+    })
+    if err != nil {
+        return err
+    }
+    var conflicts []struct {
+        Email string `bson:"_id"`
+        Users []struct {
+            ID    primitive.ObjectID `bson:"id"`
+            Email string             `bson:"email"`
+        } `bson:"users"`
+    }
+    if err := cursor.All(ctx, &conflicts); err != nil {
+        return err
+    }
+    if len(conflicts) > 0 {
+        lines := make([]string, 0, len(conflicts))
+        for _, conflict := range conflicts {
+            accounts := make([]string, 0, len(conflict.Users))
+            for _, user := range conflict.Users {
+                accounts = append(accounts, fmt.Sprintf("%s (%q)", user.ID.Hex(), user.Email))
+            }
+            lines = append(lines, fmt.Sprintf("  %s: %s", conflict.Email, strings.Join(accounts, ", ")))
+        }
+        return fmt.Errorf("%d email address(es) are used by more than one account once lowercased; merge or rename them and run the migration again:\n%s",
+            len(conflicts), strings.Join(lines, "\n"))
+    }
+
+    _, err = users.UpdateMany(ctx,
+        bson.M{"$expr": bson.M{"$ne": bson.A{"$email", normalized}}},
+        mongo.Pipeline{{{Key: "$set", Value: bson.M{"email": normalized}}}},
+    )
+    if err != nil {
+        return err
+    }
+
+    model := index("email_unique", bson.D{{Key: "email", Value: 1}})
+    model.Options.SetUnique(true).SetCollation(&options.Collation{Locale: "en", Strength: 2})
+    return createIndexes("users", model)(ctx, db)
+}
+
+// Tasks used to be written to a hardcoded "taskmanagement" database while
+// everything else used DB_NAME. moveLegacyTaskData copies them over without
+// touching documents that already exist in the configured database, and
+// leaves the old collections in place so they can be checked and dropped by
+// hand. LEGACY_DB_NAME overrides the old database name.
+func moveLegacyTaskData(ctx context.Context, db *mongo.Database) error {
+    legacyName := os.Getenv("LEGACY_DB_NAME")
+    if legacyName == "" {
+        legacyName = "taskmanagement"
+    }
+    if legacyName == db.Name() {
+        return nil
+    }
+
+    legacy := db.Client().Database(legacyName)
+    for _, collection := range []string{"tasks", "ai_suggestions"} {
+        copied, err := copyCollection(ctx, legacy.Collection(collection), db.Collection(collection))
+        if err != nil {
+            return fmt.Errorf("error moving %s.%s: %v", legacyName, collection, err)
+        }
+        if copied > 0 {
+            log.Printf("Moved %d document(s) from %s.%s to %s.%s", copied, legacyName, collection, db.Name(), collection)
+        }
+    }
+    return nil
+}
+
+func copyCollection(ctx context.Context, from, to *mongo.Collection) (int64, error) {
+    cursor, err := from.Find(ctx, bson.M{})
+    if err != nil {
+        return 0, err
+    }
+    defer cursor.Close(ctx)
+
+    var copied int64
+    flush := func(batch []mongo.WriteModel) error {
+        if len(batch) == 0 {
+            return nil
+        }
+        result, err := to.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+        if err != nil {
+            return err
+        }
+        copied += result.UpsertedCount
+        return nil
+    }
+
+    batch := make([]mongo.WriteModel, 0, 500)
+    for cursor.Next(ctx) {
+        var doc bson.M
+        if err := cursor.Decode(&doc); err != nil {
+            return copied, err
+        }
+        id := doc["_id"]
+        delete(doc, "_id")
+        batch = append(batch, mongo.NewUpdateOneModel().
+            SetFilter(bson.M{"_id": id}).
+            SetUpdate(bson.M{"$setOnInsert": doc}).
+            SetUpsert(true))
+
+        if len(batch) == cap(batch) {
+            if err := flush(batch); err != nil {
+                return copied, err
+            }
+            batch = batch[:0]
+        }
+    }
+    if err := cursor.Err(); err != nil {
+        return copied, err
+    }
+    return copied, flush(batch)
+}
+
+var authIndexes = map[string][]mongo.IndexModel{
+    "sessions": {
+        index("user_id_1", bson.D{{Key: "user_id", Value: 1}}),
+    },
+    "refresh_tokens": {
+        index("token_hash_1", bson.D{{Key: "token_hash", Value: 1}}),
+        index("family_id_1", bson.D{{Key: "family_id", Value: 1}}),
+    },
+    "user_tokens": {
+        index("token_hash_1", bson.D{{Key: "token_hash", Value: 1}}),
+        index("user_id_1_purpose_1", bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}),
+    },
+    "api_tokens": {
+        index("token_hash_1", bson.D{{Key: "token_hash", Value: 1}}),
+        index("user_id_1", bson.D{{Key: "user_id", Value: 1}}),
+    },
+    "login_attempts": {
+        index("key_1", bson.D{{Key: "key", Value: 1}}),
+    },
+    "mail_outbox": {
+        index("status_1_next_attempt_at_1", bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}),
+    },
+    "external_identities": {
+        index("issuer_1_subject_1", bson.D{{Key: "issuer", Value: 1}, {Key: "subject", Value: 1}}),
+    },
+    "audit_logs": {
+        index("user_id_1_created_at_-1", bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}),
+    },
+}
+
+func createAuthIndexes(ctx context.Context, db *mongo.Database) error {
+    for collection, models := range authIndexes {
+        if err := createIndexes(collection, models...)(ctx, db); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func dropAuthIndexes(ctx context.Context, db *mongo.Database) error {
+    for collection, models := range authIndexes {
+        names := make([]string, 0, len(models))
+        for _, model := range models {
+            names = append(names, *model.Options.Name)
+        }
+        if err := dropIndexes(collection, names...)(ctx, db); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func index(name string, keys bson.D) mongo.IndexModel {
+    return mongo.IndexModel{Keys: keys, Options: options.Index().SetName(name)}
+}
+
+func ttlIndex(name string, field string, expireAfterSeconds int32) mongo.IndexModel {
+    model := index(name, bson.D{{Key: field, Value: 1}})
+    model.Options.SetExpireAfterSeconds(expireAfterSeconds)
+    return model
+}
+
+func createIndexes(collection string, models ...mongo.IndexModel) func(context.Context, *mongo.Database) error {
+    return func(ctx context.Context, db *mongo.Database) error {
+        _, err := db.Collection(collection).Indexes().CreateMany(ctx, models)
+        return err
+    }
+}
+
+// dropIndexes ignores indexes that are already gone so a partly reverted
+// migration can be reverted again.
+func dropIndexes(collection string, names ...string) func(context.Context, *mongo.Database) error {
+    return func(ctx context.Context, db *mongo.Database) error {
+        for _, name := range names {
+            _, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+            if err != nil && !isIndexNotFound(err) {
+                return err
+            }
+        }
+        return nil
+    }
+}
+
+// isIndexNotFound matches IndexNotFound and NamespaceNotFound, the latter
+// when the whole collection is missing.
+func isIndexNotFound(err error) bool {
+    if cmdErr, ok := err.(mongo.CommandError); ok {
+        return cmdErr.Code == 27 || cmdErr.Code == 26
+    }
+    return false
+}
@@ -0,0 +1,149 @@
+package migrations
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase connects to TEST_MONGODB_URI and returns a fresh database,
+// dropped afterwards. Tests needing it are skipped without one.
+func testDatabase(t *testing.T) *mongo.Database {
+    t.Helper()
+    uri := os.Getenv("TEST_MONGODB_URI")
+    if uri == "" {
+        t.Skip("TEST_MONGODB_URI not set")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatalf("connecting to MongoDB: %v", err)
+    }
+    if err := client.Ping(ctx, nil); err != nil {
+        t.Fatalf("pinging MongoDB: %v", err)
+    }
+
+    db := client.Database(fmt.Sprintf("task_management_test_%d", time.Now().UnixNano()))
+    t.Cleanup(func() {
+        db.Drop(context.Background())
+        client.Disconnect(context.Background())
+    })
+    return db
+}
+
+// Released migrations are never renumbered, so versions must run 1..n with
+// no gaps, every one with an Up step.
+func TestAllMigrationsAreOrdered(t *testing.T) {
+    for i, m := range All {
+        if m.Version != i+1 {
+            t.Errorf("migration %d has version %d", i+1, m.Version)
+        }
+        if m.Up == nil || m.Description == "" {
+            t.Errorf("migration %d needs an Up step and a description", m.Version)
+        }
+    }
+}
+
+func TestUniqueLoginAttemptKeysMergesDuplicates(t *testing.T) {
+    db := testDatabase(t)
+    ctx := context.Background()
+    attempts := db.Collection("login_attempts")
+
+    earlier := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+    later := time.Now().Truncate(time.Millisecond)
+    locked := later.Add(15 * time.Minute)
+    _, err := attempts.InsertMany(ctx, []interface{}{
+        bson.M{"key": "account:sam@example.com", "failures": 3, "last_failure_at": earlier},
+        bson.M{"key": "account:sam@example.com", "failures": 7, "last_failure_at": later, "locked_until": locked},
+        bson.M{"key": "ip:10.0.0.1", "failures": 2, "last_failure_at": earlier},
+    })
+    if err != nil {
+        t.Fatalf("inserting attempts: %v", err)
+    }
+
+    if err := uniqueLoginAttemptKeys(ctx, db); err != nil {
+        t.Fatalf("migrating: %v", err)
+    }
+
+    var merged []struct {
+        Failures      int       `bson:"failures"`
+        LastFailureAt time.Time `bson:"last_failure_at"`
+        LockedUntil   time.Time `bson:"locked_until"`
+    }
+    cursor, err := attempts.Find(ctx, bson.M{"key": "account:sam@example.com"})
+    if err != nil {
+        t.Fatalf("loading attempts: %v", err)
+    }
+    if err := cursor.All(ctx, &merged); err != nil {
+        t.Fatalf("decoding attempts: %v", err)
+    }
+    if len(merged) != 1 {
+        t.Fatalf("want one document for the key, got %d", len(merged))
+    }
+    if merged[0].Failures != 10 || !merged[0].LastFailureAt.Equal(later) || !merged[0].LockedUntil.Equal(locked) {
+        t.Errorf("duplicates merged wrongly: %+v", merged[0])
+    }
+    if n, _ := attempts.CountDocuments(ctx, bson.M{"key": "ip:10.0.0.1"}); n != 1 {
+        t.Errorf("unrelated key was touched, %d documents left", n)
+    }
+
+    _, err = attempts.InsertOne(ctx, bson.M{"key": "ip:10.0.0.1", "failures": 1})
+    if !mongo.IsDuplicateKeyError(err) {
+        t.Errorf("key index should be unique, insert returned %v", err)
+    }
+}
+
+func TestNormalizeUserEmails(t *testing.T) {
+    db := testDatabase(t)
+    ctx := context.Background()
+    users := db.Collection("users")
+    users.InsertMany(ctx, []interface{}{
+        bson.M{"email": " Sam@Example.com"},
+        bson.M{"email": "ops@example.com"},
+    })
+
+    if err := normalizeUserEmails(ctx, db); err != nil {
+        t.Fatalf("migrating: %v", err)
+    }
+    if n, _ := users.CountDocuments(ctx, bson.M{"email": "sam@example.com"}); n != 1 {
+        t.Error("email was not normalized")
+    }
+
+    // The index is case-insensitive, so differently cased copies are rejected
+    _, err := users.InsertOne(ctx, bson.M{"email": "OPS@example.com"})
+    if !mongo.IsDuplicateKeyError(err) {
+        t.Errorf("insert of a case variant returned %v", err)
+    }
+}
+
+func TestNormalizeUserEmailsReportsConflicts(t *testing.T) {
+    db := testDatabase(t)
+    ctx := context.Background()
+    users := db.Collection("users")
+    users.InsertMany(ctx, []interface{}{
+        bson.M{"email": "sam@example.com"},
+        bson.M{"email": "Sam@Example.com "},
+        bson.M{"email": "Ops@Example.com"},
+    })
+
+    err := normalizeUserEmails(ctx, db)
+    if err == nil {
+        t.Fatal("conflicting accounts should fail the migration")
+    }
+    if !strings.Contains(err.Error(), "sam@example.com") || !strings.Contains(err.Error(), `"Sam@Example.com "`) {
+        t.Errorf("error should list the conflicting accounts: %v", err)
+    }
+
+    // Nothing is changed until the conflicts are resolved
+    if n, _ := users.CountDocuments(ctx, bson.M{"email": "Ops@Example.com"}); n != 1 {
+        t.Error("emails were modified despite the conflict")
+    }
+}
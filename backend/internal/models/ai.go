@@ -0,0 +1,80 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaskAnalysis is the structured form of an AI suggestion. Subtask
+// dependencies refer to other subtasks by their index in Subtasks.
+type TaskAnalysis struct {
+    Summary              string             `bson:"summary" json:"summary"`
+    Subtasks             []SuggestedSubtask `bson:"subtasks" json:"subtasks"`
+    Risks                []TaskRisk         `bson:"risks" json:"risks"`
+    TotalEstimateMinutes int                `bson:"total_estimate_minutes" json:"total_estimate_minutes"`
+}
+
+type SuggestedSubtask struct {
+    Title           string `bson:"title" json:"title"`
+    Description     string `bson:"description" json:"description"`
+    Priority        string `bson:"priority" json:"priority"`
+    EstimateMinutes int    `bson:"estimate_minutes" json:"estimate_minutes"`
+    DependsOn       []int  `bson:"depends_on" json:"depends_on"`
+}
+
+type TaskRisk struct {
+    Description string `bson:"description" json:"description"`
+    Severity    string `bson:"severity" json:"severity"`
+    Mitigation  string `bson:"mitigation" json:"mitigation"`
+}
+
+// DailyPlan is a user's AI-ranked task plan for one day in their timezone.
+// It is reused until the day ends or TasksFingerprint no longer matches the
+// user's open tasks.
+type DailyPlan struct {
+    ID               primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+    UserID           primitive.ObjectID `bson:"user_id" json:"-"`
+    Date             string             `bson:"date" json:"date"`
+    TasksFingerprint string             `bson:"tasks_fingerprint" json:"-"`
+    Summary          string             `bson:"summary" json:"summary"`
+    Today            []PlanItem         `bson:"today" json:"today"`
+    ThisWeek         []PlanItem         `bson:"this_week" json:"this_week"`
+    Model            string             `bson:"model,omitempty" json:"model,omitempty"`
+    GeneratedAt      time.Time          `bson:"generated_at" json:"generated_at"`
+}
+
+// PlanItem is one ranked task. Title is filled in from the task when the
+// plan is returned.
+type PlanItem struct {
+    TaskID    primitive.ObjectID `bson:"task_id" json:"task_id"`
+    Title     string             `bson:"-" json:"title"`
+    Rationale string             `bson:"rationale" json:"rationale"`
+}
+
+// AIUsage is one user's AI consumption on one UTC day.
+type AIUsage struct {
+    ID           primitive.ObjectID        `bson:"_id,omitempty" json:"-"`
+    UserID       primitive.ObjectID        `bson:"user_id" json:"-"`
+    Date         string                    `bson:"date" json:"date"`
+    Requests     int64                     `bson:"requests" json:"requests"`
+    InputTokens  int64                     `bson:"input_tokens" json:"input_tokens"`
+    OutputTokens int64                     `bson:"output_tokens" json:"output_tokens"`
+    CostUSD      float64                   `bson:"cost_usd" json:"cost_usd"`
+    Features     map[string]AIFeatureUsage `bson:"features,omitempty" json:"features,omitempty"`
+}
+
+// AIFeatureUsage breaks a day's usage down by the feature that made the
+// calls, such as task suggestions or the daily plan.
+type AIFeatureUsage struct {
+    Requests     int64   `bson:"requests" json:"requests"`
+    InputTokens  int64   `bson:"input_tokens" json:"input_tokens"`
+    OutputTokens int64   `bson:"output_tokens" json:"output_tokens"`
+    CostUSD      float64 `bson:"cost_usd" json:"cost_usd"`
+}
+
+const (
+    AIFeatureChat            = "chat"
+    AIFeatureTaskSuggestions = "task_suggestions"
+    AIFeatureTaskParse       = "task_parse"
+    AIFeaturePlan            = "plan"
+)
@@ -0,0 +1,44 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    AuditActionAccountLocked   = "account_locked"
+    AuditActionAccountUnlocked = "account_unlocked"
+    AuditActionIPBlocked       = "ip_blocked"
+
+    AuditActionUserRoleChanged     = "user_role_changed"
+    AuditActionUserDisabled        = "user_disabled"
+    AuditActionUserEnabled         = "user_enabled"
+    AuditActionUserSessionsRevoked = "user_sessions_revoked"
+    AuditActionUserTasksReassigned = "user_tasks_reassigned"
+
+    AuditActionEmailChanged    = "email_changed"
+    AuditActionPasswordChanged = "password_changed"
+    AuditActionAccountDeleted  = "account_deleted"
+    AuditActionSSOLinked       = "sso_linked"
+)
+
+type AuditLog struct {
+    ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+    Action    string                 `bson:"action" json:"action"`
+    UserID    *primitive.ObjectID    `bson:"user_id,omitempty" json:"user_id,omitempty"`
+    ActorID   *primitive.ObjectID    `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+    IP        string                 `bson:"ip,omitempty" json:"ip,omitempty"`
+    Details   map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+    CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// LoginAttempt tracks recent failed logins for one key, either an account
+// ("account:<email>") or a client address ("ip:<addr>").
+type LoginAttempt struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Key           string            `bson:"key" json:"key"`
+    Failures      int               `bson:"failures" json:"failures"`
+    LastFailureAt time.Time         `bson:"last_failure_at" json:"last_failure_at"`
+    NextAllowedAt *time.Time        `bson:"next_allowed_at,omitempty" json:"next_allowed_at,omitempty"`
+    LockedUntil   *time.Time        `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+}
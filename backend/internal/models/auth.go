@@ -0,0 +1,82 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is one link in a rotation chain. Every token issued from the
+// same login shares a FamilyID so the whole chain can be revoked at once.
+type RefreshToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+    FamilyID  primitive.ObjectID `bson:"family_id" json:"family_id"`
+    TokenHash string            `bson:"token_hash" json:"-"`
+    ExpiresAt time.Time         `bson:"expires_at" json:"expires_at"`
+    CreatedAt time.Time         `bson:"created_at" json:"created_at"`
+    UsedAt    *time.Time        `bson:"used_at,omitempty" json:"used_at,omitempty"`
+    RevokedAt *time.Time        `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// Session records one login. Its ID doubles as the refresh token family ID
+// and is carried in access tokens so revocation takes effect immediately.
+type Session struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Device     string            `bson:"device" json:"device"`
+    IP         string            `bson:"ip" json:"ip"`
+    UserAgent  string            `bson:"user_agent" json:"user_agent"`
+    CreatedAt  time.Time         `bson:"created_at" json:"created_at"`
+    LastSeenAt time.Time         `bson:"last_seen_at" json:"last_seen_at"`
+    ExpiresAt  time.Time         `bson:"expires_at" json:"expires_at"`
+    RevokedAt  *time.Time        `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+const (
+    TokenPurposePasswordReset     = "password_reset"
+    TokenPurposeEmailVerification = "email_verification"
+    TokenPurposeAccountUnlock     = "account_unlock"
+    TokenPurposeEmailChange       = "email_change"
+    TokenPurposeSSOLink           = "sso_link"
+)
+
+// UserToken is a single-use token emailed to a user, such as a password
+// reset link. Only the hash of the token is stored.
+type UserToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Purpose   string            `bson:"purpose" json:"purpose"`
+    TokenHash string            `bson:"token_hash" json:"-"`
+    ExpiresAt time.Time         `bson:"expires_at" json:"expires_at"`
+    CreatedAt time.Time         `bson:"created_at" json:"created_at"`
+    UsedAt    *time.Time        `bson:"used_at,omitempty" json:"used_at,omitempty"`
+}
+
+const (
+    ScopeTasksRead  = "tasks:read"
+    ScopeTasksWrite = "tasks:write"
+    ScopeAIUse      = "ai:use"
+)
+
+var APITokenScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeAIUse}
+
+// APIToken is a long-lived personal access token for scripts and
+// integrations. Prefix is kept in clear so users can tell tokens apart.
+type APIToken struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Name       string            `bson:"name" json:"name"`
+    Prefix     string            `bson:"prefix" json:"prefix"`
+    TokenHash  string            `bson:"token_hash" json:"-"`
+    Scopes     []string          `bson:"scopes" json:"scopes"`
+    ExpiresAt  *time.Time        `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+    LastUsedAt *time.Time        `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+    LastUsedIP string            `bson:"last_used_ip,omitempty" json:"last_used_ip,omitempty"`
+    CreatedAt  time.Time         `bson:"created_at" json:"created_at"`
+    RevokedAt  *time.Time        `bson:"revoked_at,omitempty" json:"-"`
+}
+
+const (
+    RoleAdmin = "admin"
+    RoleUser  = "user"
+)
@@ -0,0 +1,32 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExternalIdentity links an account at an OpenID Connect provider, keyed by
+// issuer and subject, to a local user. Links to accounts that existed before
+// the first SSO login stay pending until confirmed from the account's email.
+type ExternalIdentity struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Issuer      string            `bson:"issuer" json:"issuer"`
+    Subject     string            `bson:"subject" json:"subject"`
+    Email       string            `bson:"email" json:"email"`
+    Pending     bool              `bson:"pending,omitempty" json:"pending,omitempty"`
+    CreatedAt   time.Time         `bson:"created_at" json:"created_at"`
+    LastLoginAt time.Time         `bson:"last_login_at" json:"last_login_at"`
+}
+
+// OIDCState holds the per-login values that must survive the round trip to
+// the identity provider. It is stored rather than kept in memory so the
+// callback can land on any replica.
+type OIDCState struct {
+    ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    StateHash    string            `bson:"state_hash" json:"-"`
+    Nonce        string            `bson:"nonce" json:"-"`
+    CodeVerifier string            `bson:"code_verifier" json:"-"`
+    ExpiresAt    time.Time         `bson:"expires_at" json:"expires_at"`
+    CreatedAt    time.Time         `bson:"created_at" json:"created_at"`
+}
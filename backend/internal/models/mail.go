@@ -0,0 +1,36 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    OutboxStatusPending = "pending"
+    OutboxStatusSending = "sending"
+    OutboxStatusSent    = "sent"
+    OutboxStatusFailed  = "failed"
+)
+
+type MailMessage struct {
+    To      []string `bson:"to" json:"to"`
+    Subject string   `bson:"subject" json:"subject"`
+    Text    string   `bson:"text" json:"text"`
+    HTML    string   `bson:"html" json:"html"`
+}
+
+// OutboxMessage is a rendered email waiting in the mail_outbox collection.
+// Messages are written before delivery is attempted so a crash between the
+// two never loses a send.
+type OutboxMessage struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Template      string            `bson:"template" json:"template"`
+    Message       MailMessage       `bson:"message" json:"message"`
+    Status        string            `bson:"status" json:"status"`
+    Attempts      int               `bson:"attempts" json:"attempts"`
+    LastError     string            `bson:"last_error,omitempty" json:"last_error,omitempty"`
+    NextAttemptAt time.Time         `bson:"next_attempt_at" json:"next_attempt_at"`
+    LockedUntil   *time.Time        `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+    CreatedAt     time.Time         `bson:"created_at" json:"created_at"`
+    SentAt        *time.Time        `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+}
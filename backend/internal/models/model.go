@@ -1,14 +1,47 @@
 package models
 
 import (
+    "strings"
     "time"
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is an account. Email is always stored normalized, see NormalizeEmail.
 type User struct {
-    ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Email    string            `bson:"email" json:"email"`
-    Password string            `bson:"password" json:"-"`
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Name          string            `bson:"name" json:"name"`
+    Email         string            `bson:"email" json:"email"`
+    Password      string            `bson:"password" json:"-"`
+    EmailVerified bool              `bson:"email_verified" json:"email_verified"`
+    Role          string            `bson:"role" json:"role"`
+    Disabled      bool              `bson:"disabled" json:"disabled"`
+
+    PendingEmail    string     `bson:"pending_email,omitempty" json:"pending_email,omitempty"`
+    Timezone        string     `bson:"timezone,omitempty" json:"timezone,omitempty"`
+    Locale          string     `bson:"locale,omitempty" json:"locale,omitempty"`
+    AvatarUpdatedAt *time.Time `bson:"avatar_updated_at,omitempty" json:"-"`
+    AvatarKey       string     `bson:"avatar_key,omitempty" json:"-"`
+    DeletedAt       *time.Time `bson:"deleted_at,omitempty" json:"-"`
+
+    TwoFactorEnabled  bool     `bson:"two_factor_enabled" json:"two_factor_enabled"`
+    TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+    TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"`
+    TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`
+    RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`
+}
+
+// EffectiveRole treats accounts created before roles existed as regular users.
+func (u User) EffectiveRole() string {
+    if u.Role == "" {
+        return RoleUser
+    }
+    return u.Role
+}
+
+// NormalizeEmail is applied to every address before it is stored or looked
+// up, so the same mailbox can't be registered twice with different casing.
+func NormalizeEmail(email string) string {
+    return strings.ToLower(strings.TrimSpace(email))
 }
 
 type Task struct {
@@ -23,12 +56,39 @@ type Task struct {
     CreatedAt   time.Time         `bson:"created_at" json:"created_at"`
     UpdatedAt   time.Time         `bson:"updated_at" json:"updated_at"`
     Tags        []string          `bson:"tags,omitempty" json:"tags,omitempty"`
+    ParentID    *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+    EstimateMinutes int             `bson:"estimate_minutes,omitempty" json:"estimate_minutes,omitempty"`
+
+    // Set while the task is in the trash
+    DeletedAt *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+    DeletedBy *primitive.ObjectID `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
 }
 
+const (
+    SuggestionStatusPending = "pending"
+    SuggestionStatusReady   = "ready"
+    SuggestionStatusFailed  = "failed"
+)
+
+// AITaskSuggestion is generated in the background. It doubles as the job:
+// pending suggestions are claimed by the worker and retried with backoff.
 type AITaskSuggestion struct {
-    TaskID      primitive.ObjectID `bson:"task_id" json:"task_id"`
-    Suggestion  string            `bson:"suggestion" json:"suggestion"`
-    GeneratedAt time.Time         `bson:"generated_at" json:"generated_at"`
+    ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    TaskID           primitive.ObjectID `bson:"task_id" json:"task_id"`
+    Version          int                `bson:"version,omitempty" json:"version,omitempty"`
+    Model            string             `bson:"model,omitempty" json:"model,omitempty"`
+    RequestedBy      primitive.ObjectID `bson:"requested_by,omitempty" json:"requested_by,omitempty"`
+    Status           string             `bson:"status,omitempty" json:"status"`
+    Suggestion       string             `bson:"suggestion" json:"suggestion"`
+    Analysis         *TaskAnalysis      `bson:"analysis,omitempty" json:"analysis,omitempty"`
+    // Indexes of analysis subtasks already turned into child tasks
+    AcceptedSubtasks []int              `bson:"accepted_subtasks,omitempty" json:"accepted_subtasks,omitempty"`
+    Error            string             `bson:"error,omitempty" json:"error,omitempty"`
+    Attempts         int                `bson:"attempts" json:"attempts"`
+    NextAttemptAt    time.Time          `bson:"next_attempt_at,omitempty" json:"-"`
+    LockedUntil      *time.Time         `bson:"locked_until,omitempty" json:"-"`
+    CreatedAt        time.Time          `bson:"created_at,omitempty" json:"created_at"`
+    GeneratedAt      *time.Time         `bson:"generated_at,omitempty" json:"generated_at,omitempty"`
 }
 
 
@@ -0,0 +1,20 @@
+package models
+
+import "testing"
+
+func TestEffectiveRole(t *testing.T) {
+    if got := (User{}).EffectiveRole(); got != RoleUser {
+        t.Errorf("account without a role: got %q, want %q", got, RoleUser)
+    }
+    if got := (User{Role: RoleAdmin}).EffectiveRole(); got != RoleAdmin {
+        t.Errorf("got %q, want %q", got, RoleAdmin)
+    }
+}
+
+func TestNormalizeEmail(t *testing.T) {
+    for _, email := range []string{"sam@example.com", " Sam@Example.COM ", "SAM@EXAMPLE.COM\t"} {
+        if got := NormalizeEmail(email); got != "sam@example.com" {
+            t.Errorf("NormalizeEmail(%q) = %q", email, got)
+        }
+    }
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Avatar holds a user's uploaded profile picture. It is keyed by user ID so
+// each user has at most one. Key is a random value that changes with every
+// upload; knowing it is what lets anyone, such as an <img> tag, fetch the
+// image without a bearer token.
+type Avatar struct {
+    UserID      primitive.ObjectID `bson:"_id" json:"user_id"`
+    Key         string            `bson:"key" json:"-"`
+    ContentType string            `bson:"content_type" json:"content_type"`
+    Data        []byte            `bson:"data" json:"-"`
+    UpdatedAt   time.Time         `bson:"updated_at" json:"updated_at"`
+}
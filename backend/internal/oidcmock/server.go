@@ -0,0 +1,213 @@
+// Package oidcmock is a minimal OpenID Connect provider for local
+// development and testing of the single sign-on flow. It signs in whatever
+// email address is typed into its login form; never expose it publicly.
+package oidcmock
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "html/template"
+    "math/big"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+    "github.com/golang-jwt/jwt/v4"
+)
+
+const keyID = "mock-key"
+
+type authorization struct {
+    clientID      string
+    redirectURI   string
+    codeChallenge string
+    nonce         string
+    email         string
+    expiresAt     time.Time
+}
+
+type Server struct {
+    issuer string
+    key    *rsa.PrivateKey
+
+    mutex sync.Mutex
+    codes map[string]authorization
+}
+
+func NewServer(issuer string) (*Server, error) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return nil, fmt.Errorf("error generating signing key: %v", err)
+    }
+    return &Server{
+        issuer: strings.TrimSuffix(issuer, "/"),
+        key:    key,
+        codes:  make(map[string]authorization),
+    }, nil
+}
+
+func (s *Server) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+    mux.HandleFunc("/authorize", s.handleAuthorize)
+    mux.HandleFunc("/token", s.handleToken)
+    mux.HandleFunc("/jwks", s.handleJWKS)
+    return mux
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "issuer":                                s.issuer,
+        "authorization_endpoint":                s.issuer + "/authorize",
+        "token_endpoint":                        s.issuer + "/token",
+        "jwks_uri":                              s.issuer + "/jwks",
+        "response_types_supported":              []string{"code"},
+        "subject_types_supported":               []string{"public"},
+        "id_token_signing_alg_values_supported": []string{"RS256"},
+        "code_challenge_methods_supported":      []string{"S256"},
+    })
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Mock OIDC login</title>
+<h1>Mock OIDC login</h1>
+<form method="post">
+  {{range $name, $values := .}}<input type="hidden" name="{{$name}}" value="{{index $values 0}}">
+  {{end}}<label>Email <input type="email" name="email" value="dev@example.com" required></label>
+  <button type="submit">Sign in</button>
+</form>`))
+
+// handleAuthorize shows a login form on GET and issues an authorization
+// code for the submitted email on POST.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+    if err := r.ParseForm(); err != nil {
+        http.Error(w, "invalid request", http.StatusBadRequest)
+        return
+    }
+
+    if r.Method == http.MethodGet {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        loginForm.Execute(w, r.URL.Query())
+        return
+    }
+
+    redirectURI := r.Form.Get("redirect_uri")
+    if redirectURI == "" || r.Form.Get("response_type") != "code" {
+        http.Error(w, "redirect_uri and response_type=code are required", http.StatusBadRequest)
+        return
+    }
+    if r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+        http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+        return
+    }
+
+    code := randomString()
+    s.mutex.Lock()
+    s.codes[code] = authorization{
+        clientID:      r.Form.Get("client_id"),
+        redirectURI:   redirectURI,
+        codeChallenge: r.Form.Get("code_challenge"),
+        nonce:         r.Form.Get("nonce"),
+        email:         r.Form.Get("email"),
+        expiresAt:     time.Now().Add(time.Minute),
+    }
+    s.mutex.Unlock()
+
+    params := url.Values{}
+    params.Set("code", code)
+    params.Set("state", r.Form.Get("state"))
+    http.Redirect(w, r, redirectURI+"?"+params.Encode(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+        return
+    }
+
+    code := r.Form.Get("code")
+    s.mutex.Lock()
+    auth, ok := s.codes[code]
+    delete(s.codes, code)
+    s.mutex.Unlock()
+
+    if !ok || time.Now().After(auth.expiresAt) || auth.redirectURI != r.Form.Get("redirect_uri") {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+        return
+    }
+
+    sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+    if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+        return
+    }
+
+    clientID := auth.clientID
+    if user, _, ok := r.BasicAuth(); ok {
+        if unescaped, err := url.QueryUnescape(user); err == nil {
+            clientID = unescaped
+        }
+    }
+
+    now := time.Now()
+    token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+        "iss":            s.issuer,
+        "sub":            "mock|" + strings.ToLower(auth.email),
+        "aud":            clientID,
+        "iat":            now.Unix(),
+        "exp":            now.Add(5 * time.Minute).Unix(),
+        "nonce":          auth.nonce,
+        "email":          auth.email,
+        "email_verified": true,
+        "name":           strings.Split(auth.email, "@")[0],
+    })
+    token.Header["kid"] = keyID
+
+    idToken, err := token.SignedString(s.key)
+    if err != nil {
+        writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": randomString(),
+        "token_type":   "Bearer",
+        "expires_in":   300,
+        "id_token":     idToken,
+    })
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+    pub := s.key.PublicKey
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "keys": []map[string]string{{
+            "kid": keyID,
+            "kty": "RSA",
+            "use": "sig",
+            "alg": "RS256",
+            "n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+            "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+        }},
+    })
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+    b := make([]byte, 24)
+    rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/sync/singleflight"
+    "task-management/internal/database"
+)
+
+const (
+    cacheCollection = "ai_cache"
+    defaultCacheTTL = 24 * time.Hour
+)
+
+// cachedCompletion is an ai_cache document. Expired entries are removed by a
+// TTL index on expires_at.
+type cachedCompletion struct {
+    Key          string    `bson:"_id"`
+    Provider     string    `bson:"provider"`
+    Model        string    `bson:"model"`
+    Feature      string    `bson:"feature,omitempty"`
+    Content      string    `bson:"content"`
+    InputTokens  int       `bson:"input_tokens"`
+    OutputTokens int       `bson:"output_tokens"`
+    CreatedAt    time.Time `bson:"created_at"`
+    ExpiresAt    time.Time `bson:"expires_at"`
+}
+
+// Concurrent identical requests on this instance share one provider call
+var completionCalls singleflight.Group
+
+type aiCacheBypassKey struct{}
+
+// WithoutAICache makes calls with ctx skip the cache lookup. The fresh answer
+// still replaces the cached one.
+func WithoutAICache(ctx context.Context) context.Context {
+    return context.WithValue(ctx, aiCacheBypassKey{}, true)
+}
+
+func aiCacheBypassed(ctx context.Context) bool {
+    bypass, _ := ctx.Value(aiCacheBypassKey{}).(bool)
+    return bypass
+}
+
+// aiCacheTTL is how long answers for feature are kept. AI_CACHE_TTL sets the
+// default and AI_CACHE_TTL_<FEATURE>, e.g. AI_CACHE_TTL_CHAT, overrides it
+// per endpoint. A TTL of 0 turns caching off.
+func aiCacheTTL(feature string) time.Duration {
+    ttl := defaultCacheTTL
+    if v, err := time.ParseDuration(os.Getenv("AI_CACHE_TTL")); err == nil {
+        ttl = v
+    }
+    if feature != "" {
+        if v, err := time.ParseDuration(os.Getenv("AI_CACHE_TTL_" + strings.ToUpper(feature))); err == nil {
+            ttl = v
+        }
+    }
+    if ttl < 0 {
+        return 0
+    }
+    return ttl
+}
+
+var cacheWhitespace = regexp.MustCompile(`\s+`)
+
+// completionCacheKey identifies a request by provider, model and the prompt
+// with whitespace normalized, plus every option that changes the answer.
+func completionCacheKey(provider LLMProvider, req CompletionRequest) string {
+    normalize := func(s string) string {
+        return cacheWhitespace.ReplaceAllString(strings.TrimSpace(s), " ")
+    }
+
+    parts := map[string]interface{}{
+        "provider":   provider.Name(),
+        "model":      provider.Model(),
+        "system":     normalize(req.System),
+        "max_tokens": req.MaxTokens,
+    }
+    messages := make([][2]string, 0, len(req.Messages))
+    for _, m := range req.Messages {
+        messages = append(messages, [2]string{m.Role, normalize(m.Content)})
+    }
+    parts["messages"] = messages
+    if req.Temperature != nil {
+        parts["temperature"] = *req.Temperature
+    }
+    if req.Schema != nil {
+        parts["schema"] = req.Schema.Schema
+    }
+
+    // encoding/json sorts map keys, so equal requests encode identically
+    data, _ := json.Marshal(parts)
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+func lookupCachedCompletion(ctx context.Context, key string) *CompletionResponse {
+    var cached cachedCompletion
+    err := database.GetCollection(cacheCollection).FindOne(ctx, bson.M{
+        "_id":        key,
+        "expires_at": bson.M{"$gt": time.Now()},
+    }).Decode(&cached)
+    if err != nil {
+        if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+            log.Printf("Error reading AI cache: %v", err)
+        }
+        return nil
+    }
+    return &CompletionResponse{
+        Content:      cached.Content,
+        Model:        cached.Model,
+        InputTokens:  cached.InputTokens,
+        OutputTokens: cached.OutputTokens,
+    }
+}
+
+func storeCachedCompletion(provider LLMProvider, key string, feature string, ttl time.Duration, response *CompletionResponse) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    now := time.Now()
+    _, err := database.GetCollection(cacheCollection).ReplaceOne(ctx,
+        bson.M{"_id": key},
+        cachedCompletion{
+            Key:          key,
+            Provider:     provider.Name(),
+            Model:        response.Model,
+            Feature:      feature,
+            Content:      response.Content,
+            InputTokens:  response.InputTokens,
+            OutputTokens: response.OutputTokens,
+            CreatedAt:    now,
+            ExpiresAt:    now.Add(ttl),
+        },
+        options.Replace().SetUpsert(true),
+    )
+    if err != nil && !mongo.IsDuplicateKeyError(err) {
+        log.Printf("Error writing AI cache: %v", err)
+    }
+}
+
+// sharedCompletion runs call once for all concurrent callers with the same
+// key. A caller whose own context is still alive makes its own call when the
+// shared one was cancelled by the caller that started it.
+func sharedCompletion(ctx context.Context, key string, call func() (*CompletionResponse, error)) (*CompletionResponse, error) {
+    result := completionCalls.DoChan(key, func() (interface{}, error) {
+        return call()
+    })
+
+    select {
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    case r := <-result:
+        if r.Err != nil {
+            if r.Shared && ctx.Err() == nil && (errors.Is(r.Err, context.Canceled) || errors.Is(r.Err, context.DeadlineExceeded)) {
+                return call()
+            }
+            return nil, r.Err
+        }
+        return r.Val.(*CompletionResponse), nil
+    }
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+    "task-management/internal/models"
+)
+
+func TestCompletionCacheKey(t *testing.T) {
+    provider := NewFakeProvider("")
+    base := CompletionRequest{
+        System:    "You are helpful.",
+        Messages:  []Message{{Role: "user", Content: "Plan my   week\n"}},
+        MaxTokens: 512,
+    }
+    key := completionCacheKey(provider, base)
+
+    same := base
+    same.Messages = []Message{{Role: "user", Content: "  Plan my week"}}
+    if completionCacheKey(provider, same) != key {
+        t.Error("whitespace differences should share a cache entry")
+    }
+
+    temperature := 0.2
+    variants := map[string]CompletionRequest{
+        "prompt":      {System: base.System, Messages: []Message{{Role: "user", Content: "Plan my day"}}, MaxTokens: 512},
+        "role":        {System: base.System, Messages: []Message{{Role: "assistant", Content: "Plan my week"}}, MaxTokens: 512},
+        "system":      {System: "Be terse.", Messages: base.Messages, MaxTokens: 512},
+        "max tokens":  {System: base.System, Messages: base.Messages, MaxTokens: 1024},
+        "temperature": {System: base.System, Messages: base.Messages, MaxTokens: 512, Temperature: &temperature},
+        "schema":      {System: base.System, Messages: base.Messages, MaxTokens: 512, Schema: dailyPlanSchema},
+    }
+    for name, req := range variants {
+        if completionCacheKey(provider, req) == key {
+            t.Errorf("a different %s should change the key", name)
+        }
+    }
+
+    if completionCacheKey(&stubProvider{}, base) == key {
+        t.Error("a different provider or model should change the key")
+    }
+}
+
+func TestAICacheTTL(t *testing.T) {
+    t.Setenv("AI_CACHE_TTL", "")
+    t.Setenv("AI_CACHE_TTL_CHAT", "")
+    if got := aiCacheTTL(models.AIFeatureChat); got != defaultCacheTTL {
+        t.Errorf("default = %s", got)
+    }
+
+    t.Setenv("AI_CACHE_TTL", "2h")
+    t.Setenv("AI_CACHE_TTL_CHAT", "0")
+    if got := aiCacheTTL(models.AIFeatureChat); got != 0 {
+        t.Errorf("per-feature override = %s, want caching off", got)
+    }
+    if got := aiCacheTTL(models.AIFeaturePlan); got != 2*time.Hour {
+        t.Errorf("other feature = %s, want the default", got)
+    }
+
+    t.Setenv("AI_CACHE_TTL", "-1h")
+    if got := aiCacheTTL(""); got != 0 {
+        t.Errorf("negative TTL = %s, want 0", got)
+    }
+}
+
+func TestWithoutAICache(t *testing.T) {
+    if aiCacheBypassed(context.Background()) {
+        t.Error("cache bypassed by default")
+    }
+    if !aiCacheBypassed(WithoutAICache(context.Background())) {
+        t.Error("WithoutAICache had no effect")
+    }
+}
+
+func TestSharedCompletionDeduplicatesCalls(t *testing.T) {
+    var calls int32
+    release := make(chan struct{})
+    call := func() (*CompletionResponse, error) {
+        atomic.AddInt32(&calls, 1)
+        <-release
+        return &CompletionResponse{Content: "shared"}, nil
+    }
+
+    const callers = 5
+    var started, done sync.WaitGroup
+    results := make(chan string, callers)
+    for i := 0; i < callers; i++ {
+        started.Add(1)
+        done.Add(1)
+        go func() {
+            defer done.Done()
+            started.Done()
+            response, err := sharedCompletion(context.Background(), "same-key", call)
+            if err != nil {
+                t.Errorf("unexpected error: %v", err)
+                return
+            }
+            results <- response.Content
+        }()
+    }
+    started.Wait()
+    time.Sleep(50 * time.Millisecond)
+    close(release)
+    done.Wait()
+    close(results)
+
+    if n := atomic.LoadInt32(&calls); n != 1 {
+        t.Errorf("provider called %d times, want 1", n)
+    }
+    for content := range results {
+        if content != "shared" {
+            t.Errorf("got %q", content)
+        }
+    }
+}
+
+func TestSharedCompletionHonoursCallerContext(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    block := make(chan struct{})
+    defer close(block)
+
+    _, err := sharedCompletion(ctx, "cancelled-key", func() (*CompletionResponse, error) {
+        <-block
+        return &CompletionResponse{}, nil
+    })
+    if err != context.Canceled {
+        t.Errorf("got %v, want context.Canceled", err)
+    }
+}
+
+// An answer that fails validation must not be stored, or every later
+// request would be served the same broken reply until it expired.
+func TestInvalidAnswersAreNotCached(t *testing.T) {
+    useTestDatabase(t)
+    t.Setenv("AI_CACHE_TTL", "1h")
+    ctx := context.Background()
+    task := models.Task{Title: "Launch beta", Status: "todo", Priority: "high"}
+
+    if _, err := NewAIService(NewFakeProvider("not an analysis")).AnalyzeTask(ctx, task, nil); err == nil {
+        t.Fatal("an invalid analysis should fail")
+    }
+
+    valid, err := NewAIService(NewFakeProvider("")).AnalyzeTask(ctx, task, nil)
+    if err != nil {
+        t.Fatalf("the invalid reply was replayed from the cache: %v", err)
+    }
+
+    // The valid answer is cached and served ahead of the provider's
+    cached, err := NewAIService(NewFakeProvider("still not an analysis")).AnalyzeTask(ctx, task, nil)
+    if err != nil {
+        t.Fatalf("valid answer wasn't cached: %v", err)
+    }
+    if cached.Summary != valid.Summary {
+        t.Errorf("got %q, want the cached %q", cached.Summary, valid.Summary)
+    }
+}
+
+func TestInvalidCachedAnswersAreSkipped(t *testing.T) {
+    useTestDatabase(t)
+    t.Setenv("AI_CACHE_TTL", "1h")
+    ctx := context.Background()
+    task := models.Task{Title: "Launch beta", Status: "todo", Priority: "high"}
+    ai := NewAIService(NewFakeProvider(""))
+
+    // An entry written before answers were validated
+    req := CompletionRequest{
+        System:    taskAnalysisSystemPrompt,
+        Messages:  []Message{{Role: "user", Content: generateAIPrompt(task, nil)}},
+        MaxTokens: 2048,
+        Schema:    taskAnalysisSchema,
+    }
+    storeCachedCompletion(ai.Provider(), completionCacheKey(ai.Provider(), req), "", time.Hour, &CompletionResponse{Content: "{}", Model: "fake"})
+
+    if _, err := ai.AnalyzeTask(ctx, task, nil); err != nil {
+        t.Errorf("a cached answer that fails validation should be regenerated: %v", err)
+    }
+}
@@ -1,121 +1,181 @@
-
 package services
 
 import (
-    "bytes"
-    "encoding/json"
+    "context"
     "fmt"
-    "log"
-    "net/http"
+    "strings"
+    "time"
     "task-management/internal/models"
 )
 
+// AIService generates task suggestions with the configured LLMProvider.
 type AIService struct {
-    apiKey  string
-    baseURL string
+    provider LLMProvider
 }
 
-type OpenAIRequest struct {
-    Model    string    `json:"model"`
-    Messages []Message `json:"messages"`
-    Store    bool      `json:"store"`
-}
+var AI *AIService
 
-type Message struct {
-    Role    string `json:"role"`
-    Content string `json:"content"`
+func NewAIService(provider LLMProvider) *AIService {
+    return &AIService{provider: provider}
 }
 
-type OpenAIResponse struct {
-    ID      string `json:"id"`
-    Object  string `json:"object"`
-    Created int64  `json:"created"`
-    Model   string `json:"model"`
-    Choices []struct {
-        Message struct {
-            Role    string `json:"role"`
-            Content string `json:"content"`
-        } `json:"message"`
-    } `json:"choices"`
+func (s *AIService) Provider() LLMProvider {
+    return s.provider
 }
 
-func NewAIService(apiKey string) (*AIService, error) {
-    if apiKey == "" {
-        return nil, fmt.Errorf("OpenAI API key is not set")
+// complete calls the provider on behalf of the usage owner of ctx, enforcing
+// their quota and recording the tokens spent. Answers are cached per feature
+// and identical concurrent requests share one call. An answer is only
+// cached once validate, if given, accepts its content, so a malformed reply
+// is asked for again instead of being replayed. Every AIService call goes
+// through here or StreamResponse.
+func (s *AIService) complete(ctx context.Context, req CompletionRequest, validate func(string) error) (*CompletionResponse, error) {
+    owner, _ := aiUsageOwnerFrom(ctx)
+    ttl := aiCacheTTL(owner.feature)
+    key := completionCacheKey(s.provider, req)
+    bypass := aiCacheBypassed(ctx)
+    valid := func(response *CompletionResponse) bool {
+        return validate == nil || validate(response.Content) == nil
+    }
+
+    // Cache hits cost nothing, so they are served even over quota
+    if ttl > 0 && !bypass {
+        if cached := lookupCachedCompletion(ctx, key); cached != nil && valid(cached) {
+            return cached, nil
+        }
+    }
+
+    if err := CheckAIQuota(ctx); err != nil {
+        return nil, err
+    }
+
+    call := func() (*CompletionResponse, error) {
+        response, err := s.provider.Complete(ctx, req)
+        if err != nil {
+            return nil, err
+        }
+        recordAIUsage(ctx, tokensOrEstimate(response.InputTokens, requestText(req)), tokensOrEstimate(response.OutputTokens, response.Content))
+        if ttl > 0 && valid(response) {
+            storeCachedCompletion(s.provider, key, owner.feature, ttl, response)
+        }
+        return response, nil
     }
-    return &AIService{
-        apiKey:  apiKey,
-        baseURL: "https://api.openai.com/v1/chat/completions",
-    }, nil
+    if bypass {
+        return call()
+    }
+    return sharedCompletion(ctx, key, call)
 }
 
-func (s *AIService) GenerateResponse(prompt string) (string, error) {
-    request := OpenAIRequest{
-        Model: "gpt-4o-mini",
-        Store: true,
+func (s *AIService) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+    response, err := s.complete(ctx, CompletionRequest{
         Messages: []Message{
             {
                 Role:    "user",
                 Content: prompt,
             },
         },
+    }, nil)
+    if err != nil {
+        return "", err
     }
+    return response.Content, nil
+}
 
-    jsonData, err := json.Marshal(request)
-    if err != nil {
-        return "", fmt.Errorf("error marshaling request: %v", err)
+// StreamResponse is GenerateResponse with the text passed to onDelta as it
+// is generated. Providers that can't stream deliver it in one piece.
+func (s *AIService) StreamResponse(ctx context.Context, prompt string, onDelta func(string) error) (string, error) {
+    req := CompletionRequest{
+        Messages: []Message{
+            {
+                Role:    "user",
+                Content: prompt,
+            },
+        },
     }
 
-    log.Printf("Sending request to OpenAI: %s", string(jsonData))
+    streamer, ok := s.provider.(StreamingProvider)
+    if !ok {
+        // complete handles the cache
+        response, err := s.complete(ctx, req, nil)
+        if err != nil {
+            return "", err
+        }
+        return response.Content, onDelta(response.Content)
+    }
 
-    req, err := http.NewRequest("POST", s.baseURL, bytes.NewBuffer(jsonData))
-    if err != nil {
-        return "", fmt.Errorf("error creating request: %v", err)
+    owner, _ := aiUsageOwnerFrom(ctx)
+    ttl := aiCacheTTL(owner.feature)
+    key := completionCacheKey(s.provider, req)
+    if ttl > 0 && !aiCacheBypassed(ctx) {
+        if cached := lookupCachedCompletion(ctx, key); cached != nil {
+            return cached.Content, onDelta(cached.Content)
+        }
     }
 
-    req.Header.Set("Content-Type", "application/json")
-    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
+    if err := CheckAIQuota(ctx); err != nil {
+        return "", err
+    }
 
-    client := &http.Client{}
-    resp, err := client.Do(req)
+    var streamed strings.Builder
+    response, err := streamer.Stream(ctx, req, func(delta string) error {
+        streamed.WriteString(delta)
+        return onDelta(delta)
+    })
     if err != nil {
-        return "", fmt.Errorf("error making request: %v", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        
-        var errorResponse struct {
-            Error struct {
-                Message string `json:"message"`
-                Type    string `json:"type"`
-                Code    string `json:"code"`
-            } `json:"error"`
-        }
-        if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
-            return "", fmt.Errorf("OpenAI API error, status code: %d", resp.StatusCode)
+        // Output generated before a failure or cancellation is still billed
+        if streamed.Len() > 0 {
+            recordAIUsage(ctx, estimateTokens(requestText(req)), estimateTokens(streamed.String()))
         }
-        return "", fmt.Errorf("OpenAI API error: %s", errorResponse.Error.Message)
+        return "", err
     }
-
-    var response OpenAIResponse
-    if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-        return "", fmt.Errorf("error decoding response: %v", err)
+    recordAIUsage(ctx, tokensOrEstimate(response.InputTokens, requestText(req)), tokensOrEstimate(response.OutputTokens, response.Content))
+    if ttl > 0 {
+        storeCachedCompletion(s.provider, key, owner.feature, ttl, response)
     }
+    return response.Content, nil
+}
 
-    if len(response.Choices) == 0 {
-        return "", fmt.Errorf("no suggestions generated")
+// Some self-hosted servers don't report usage. About four characters per
+// token is close enough for quotas.
+func tokensOrEstimate(reported int, text string) int {
+    if reported > 0 {
+        return reported
     }
+    return estimateTokens(text)
+}
 
-    return response.Choices[0].Message.Content, nil
+func estimateTokens(text string) int {
+    return (len(text) + 3) / 4
 }
 
-func (s *AIService) GenerateTaskSuggestions(task models.Task) (string, error) {
-    prompt := generateAIPrompt(task)
-    return s.GenerateResponse(prompt)
+func requestText(req CompletionRequest) string {
+    text := req.System
+    for _, m := range req.Messages {
+        text += "\n" + m.Content
+    }
+    return text
 }
 
-func generateAIPrompt(task models.Task) string {
+func generateAIPrompt(task models.Task, subtasks []models.Task) string {
+    tags := "none"
+    if len(task.Tags) > 0 {
+        tags = strings.Join(task.Tags, ", ")
+    }
+
+    dueDate := "not set"
+    if task.DueDate != nil {
+        dueDate = task.DueDate.Format("Monday, January 2, 2006")
+    }
+
+    existing := "   none"
+    if len(subtasks) > 0 {
+        lines := make([]string, 0, len(subtasks))
+        for _, subtask := range subtasks {
+            lines = append(lines, fmt.Sprintf("   - %s (%s)", subtask.Title, subtask.Status))
+        }
+        existing = strings.Join(lines, "\n")
+    }
+
     return fmt.Sprintf(`Please analyze this task and provide detailed suggestions:
 
 Task Details:
@@ -123,33 +183,23 @@ Task Details:
 - Description: %s
 - Status: %s
 - Priority: %s
+- Tags: %s
+- Due date: %s (today is %s)
+- Existing subtasks:
+%s
 
-Please provide a structured response with the following sections:
-
-1. Task Breakdown:
-   - List of subtasks
-   - Dependencies between subtasks
-
-2. Time Estimation:
-   - Estimated duration for each subtask
-   - Total project timeline
-
-3. Potential Challenges:
-   - Technical challenges
-   - Resource requirements
-   - Risk factors
-
-4. Implementation Recommendations:
-   - Best practices
-   - Tools and technologies
-   - Testing strategies
+Please provide:
 
-5. Success Criteria:
-   - Definition of done
-   - Quality metrics
-   - Validation steps`, 
+1. A short summary of the approach
+2. The remaining subtasks, building on any existing ones, each with a
+   priority, an estimate in minutes and the subtasks it depends on
+3. Risks with their severity and how to mitigate them`, 
     task.Title, 
     task.Description, 
     task.Status, 
-    task.Priority)
+    task.Priority,
+    tags,
+    dueDate,
+    time.Now().Format("Monday, January 2, 2006"),
+    existing)
 }
\ No newline at end of file
@@ -0,0 +1,47 @@
+package services
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "task-management/internal/models"
+)
+
+func TestGenerateAIPrompt(t *testing.T) {
+    due := time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)
+    task := models.Task{
+        Title:       "Launch beta",
+        Description: "Open the beta to the waitlist",
+        Status:      "in_progress",
+        Priority:    "high",
+        Tags:        []string{"launch", "marketing"},
+        DueDate:     &due,
+    }
+    subtasks := []models.Task{
+        {Title: "Write announcement", Status: "done"},
+        {Title: "Invite first cohort", Status: "todo"},
+    }
+
+    prompt := generateAIPrompt(task, subtasks)
+    for _, want := range []string{
+        "- Title: Launch beta",
+        "- Description: Open the beta to the waitlist",
+        "- Priority: high",
+        "- Tags: launch, marketing",
+        "- Due date: Friday, March 6, 2026 (today is " + time.Now().Format("Monday, January 2, 2006") + ")",
+        "   - Write announcement (done)\n   - Invite first cohort (todo)",
+    } {
+        if !strings.Contains(prompt, want) {
+            t.Errorf("prompt is missing %q:\n%s", want, prompt)
+        }
+    }
+}
+
+func TestGenerateAIPromptDefaults(t *testing.T) {
+    prompt := generateAIPrompt(models.Task{Title: "Tidy up"}, nil)
+    for _, want := range []string{"- Tags: none", "- Due date: not set", "- Existing subtasks:\n   none"} {
+        if !strings.Contains(prompt, want) {
+            t.Errorf("prompt is missing %q:\n%s", want, prompt)
+        }
+    }
+}
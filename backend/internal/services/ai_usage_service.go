@@ -0,0 +1,209 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "log"
+    "os"
+    "strconv"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const usageCollection = "ai_usage"
+
+// ErrAIQuotaExceeded is returned instead of calling the provider once the
+// user has used up today's quota. Handlers answer 429.
+var ErrAIQuotaExceeded = errors.New("daily AI quota exceeded")
+
+// AIQuota holds the per-user daily limits. Zero means unlimited.
+type AIQuota struct {
+    Requests int64 `json:"requests"`
+    Tokens   int64 `json:"tokens"`
+}
+
+// AIQuotaStatus is today's usage measured against the quota.
+type AIQuotaStatus struct {
+    Usage     models.AIUsage `json:"usage"`
+    Limits    AIQuota        `json:"limits"`
+    Remaining AIQuota        `json:"remaining"`
+    ResetsAt  time.Time      `json:"resets_at"`
+}
+
+type aiUsageKey struct{}
+
+type aiUsageOwner struct {
+    userID  primitive.ObjectID
+    feature string
+}
+
+// WithAIUsage attributes AI calls made with ctx to the user and feature, so
+// they count against the user's quota. Calls without an owner, such as
+// maintenance jobs, are neither limited nor recorded.
+func WithAIUsage(ctx context.Context, userID primitive.ObjectID, feature string) context.Context {
+    return context.WithValue(ctx, aiUsageKey{}, aiUsageOwner{userID: userID, feature: feature})
+}
+
+func aiUsageOwnerFrom(ctx context.Context) (aiUsageOwner, bool) {
+    owner, ok := ctx.Value(aiUsageKey{}).(aiUsageOwner)
+    return owner, ok && !owner.userID.IsZero()
+}
+
+// LoadAIQuota reads AI_DAILY_REQUEST_LIMIT and AI_DAILY_TOKEN_LIMIT. Either
+// may be set to 0 to remove that limit.
+func LoadAIQuota() AIQuota {
+    return AIQuota{
+        Requests: envLimit("AI_DAILY_REQUEST_LIMIT", 100),
+        Tokens:   envLimit("AI_DAILY_TOKEN_LIMIT", 200000),
+    }
+}
+
+func envLimit(name string, fallback int64) int64 {
+    v, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+    if err != nil {
+        return fallback
+    }
+    if v < 0 {
+        return 0
+    }
+    return v
+}
+
+func envFloat(name string) float64 {
+    v, err := strconv.ParseFloat(os.Getenv(name), 64)
+    if err != nil || v < 0 {
+        return 0
+    }
+    return v
+}
+
+// CheckAIQuota returns ErrAIQuotaExceeded when the owner of ctx has reached
+// a daily limit. The check happens before a call, so the last call of the
+// day may go slightly over the token limit.
+func CheckAIQuota(ctx context.Context) error {
+    owner, ok := aiUsageOwnerFrom(ctx)
+    if !ok {
+        return nil
+    }
+
+    quota := LoadAIQuota()
+    if quota.Requests == 0 && quota.Tokens == 0 {
+        return nil
+    }
+
+    usage, err := dailyAIUsage(ctx, owner.userID, usageDate(time.Now()))
+    if err != nil {
+        // Don't take AI features down with the usage store
+        log.Printf("Error checking AI quota: %v", err)
+        return nil
+    }
+    if quota.Requests > 0 && usage.Requests >= quota.Requests {
+        return ErrAIQuotaExceeded
+    }
+    if quota.Tokens > 0 && usage.InputTokens+usage.OutputTokens >= quota.Tokens {
+        return ErrAIQuotaExceeded
+    }
+    return nil
+}
+
+// recordAIUsage adds one call to the owner's daily totals. It runs with its
+// own context so calls cancelled by the client are still counted.
+func recordAIUsage(ctx context.Context, inputTokens, outputTokens int) {
+    owner, ok := aiUsageOwnerFrom(ctx)
+    if !ok {
+        return
+    }
+
+    cost := (float64(inputTokens)*envFloat("AI_PRICE_INPUT_PER_MTOK") +
+        float64(outputTokens)*envFloat("AI_PRICE_OUTPUT_PER_MTOK")) / 1e6
+
+    feature := "features." + owner.feature + "."
+    recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    filter := bson.M{"user_id": owner.userID, "date": usageDate(time.Now())}
+    update := bson.M{"$inc": bson.M{
+        "requests":                1,
+        "input_tokens":            inputTokens,
+        "output_tokens":           outputTokens,
+        "cost_usd":                cost,
+        feature + "requests":      1,
+        feature + "input_tokens":  inputTokens,
+        feature + "output_tokens": outputTokens,
+        feature + "cost_usd":      cost,
+    }}
+
+    usage := database.GetCollection(usageCollection)
+    _, err := usage.UpdateOne(recordCtx, filter, update, options.Update().SetUpsert(true))
+    if mongo.IsDuplicateKeyError(err) {
+        // Lost the race to create today's document; it exists now
+        _, err = usage.UpdateOne(recordCtx, filter, update)
+    }
+    if err != nil {
+        log.Printf("Error recording AI usage: %v", err)
+    }
+}
+
+// GetAIQuotaStatus reports today's usage and what is left of the quota.
+func GetAIQuotaStatus(ctx context.Context, userID primitive.ObjectID) (*AIQuotaStatus, error) {
+    now := time.Now().UTC()
+    usage, err := dailyAIUsage(ctx, userID, usageDate(now))
+    if err != nil {
+        return nil, err
+    }
+
+    quota := LoadAIQuota()
+    status := &AIQuotaStatus{
+        Usage:    *usage,
+        Limits:   quota,
+        ResetsAt: time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+    }
+    if quota.Requests > 0 {
+        status.Remaining.Requests = max(quota.Requests-usage.Requests, 0)
+    }
+    if quota.Tokens > 0 {
+        status.Remaining.Tokens = max(quota.Tokens-usage.InputTokens-usage.OutputTokens, 0)
+    }
+    return status, nil
+}
+
+// ListAIUsage returns the user's daily usage for the last days days, newest
+// first. Days without any calls are left out.
+func ListAIUsage(ctx context.Context, userID primitive.ObjectID, days int) ([]models.AIUsage, error) {
+    since := usageDate(time.Now().AddDate(0, 0, -(days - 1)))
+    cursor, err := database.GetCollection(usageCollection).Find(ctx,
+        bson.M{"user_id": userID, "date": bson.M{"$gte": since}},
+        options.Find().SetSort(bson.M{"date": -1}),
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    usage := []models.AIUsage{}
+    if err := cursor.All(ctx, &usage); err != nil {
+        return nil, err
+    }
+    return usage, nil
+}
+
+func dailyAIUsage(ctx context.Context, userID primitive.ObjectID, date string) (*models.AIUsage, error) {
+    var usage models.AIUsage
+    err := database.GetCollection(usageCollection).FindOne(ctx, bson.M{"user_id": userID, "date": date}).Decode(&usage)
+    if err == mongo.ErrNoDocuments {
+        return &models.AIUsage{UserID: userID, Date: date}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &usage, nil
+}
+
+// Quotas reset at midnight UTC
+func usageDate(t time.Time) string {
+    return t.UTC().Format("2006-01-02")
+}
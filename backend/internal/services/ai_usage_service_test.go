@@ -0,0 +1,105 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/models"
+)
+
+func TestLoadAIQuota(t *testing.T) {
+    t.Setenv("AI_DAILY_REQUEST_LIMIT", "")
+    t.Setenv("AI_DAILY_TOKEN_LIMIT", "")
+    if got := LoadAIQuota(); got != (AIQuota{Requests: 100, Tokens: 200000}) {
+        t.Errorf("defaults = %+v", got)
+    }
+
+    // 0 turns a limit off and negative values are treated the same way
+    t.Setenv("AI_DAILY_REQUEST_LIMIT", "0")
+    t.Setenv("AI_DAILY_TOKEN_LIMIT", "-5")
+    if got := LoadAIQuota(); got != (AIQuota{}) {
+        t.Errorf("unlimited = %+v", got)
+    }
+
+    t.Setenv("AI_DAILY_REQUEST_LIMIT", "lots")
+    t.Setenv("AI_DAILY_TOKEN_LIMIT", "5000")
+    if got := LoadAIQuota(); got != (AIQuota{Requests: 100, Tokens: 5000}) {
+        t.Errorf("configured = %+v", got)
+    }
+}
+
+func TestTokensOrEstimate(t *testing.T) {
+    if got := tokensOrEstimate(42, "ignored"); got != 42 {
+        t.Errorf("reported count should win, got %d", got)
+    }
+    // About four characters per token, rounded up
+    if got := tokensOrEstimate(0, "twelve chars"); got != 3 {
+        t.Errorf("estimate = %d, want 3", got)
+    }
+    if got := estimateTokens("x"); got != 1 {
+        t.Errorf("estimate of one character = %d, want 1", got)
+    }
+    if got := estimateTokens(""); got != 0 {
+        t.Errorf("estimate of nothing = %d, want 0", got)
+    }
+}
+
+func TestUsageDate(t *testing.T) {
+    // Quotas reset at midnight UTC whatever the server's zone
+    late := time.Date(2026, 3, 4, 23, 30, 0, 0, time.FixedZone("PST", -8*3600))
+    if got := usageDate(late); got != "2026-03-05" {
+        t.Errorf("got %s", got)
+    }
+}
+
+func TestCheckAIQuotaWithoutOwner(t *testing.T) {
+    // Maintenance jobs aren't attributed to anyone and never hit the store
+    if err := CheckAIQuota(context.Background()); err != nil {
+        t.Errorf("got %v", err)
+    }
+    if err := CheckAIQuota(WithAIUsage(context.Background(), primitive.NilObjectID, models.AIFeatureChat)); err != nil {
+        t.Errorf("zero user: got %v", err)
+    }
+}
+
+func TestAIQuotaIsEnforced(t *testing.T) {
+    useTestDatabase(t)
+    t.Setenv("AI_CACHE_TTL", "0")
+    t.Setenv("AI_DAILY_REQUEST_LIMIT", "2")
+    t.Setenv("AI_DAILY_TOKEN_LIMIT", "0")
+
+    userID := primitive.NewObjectID()
+    ctx := WithAIUsage(context.Background(), userID, models.AIFeatureChat)
+    ai := NewAIService(NewFakeProvider("one two three"))
+
+    for i := 0; i < 2; i++ {
+        if _, err := ai.GenerateResponse(ctx, "hello there"); err != nil {
+            t.Fatalf("call %d: %v", i+1, err)
+        }
+    }
+    if _, err := ai.GenerateResponse(ctx, "hello there"); err != ErrAIQuotaExceeded {
+        t.Errorf("third call: got %v, want ErrAIQuotaExceeded", err)
+    }
+
+    status, err := GetAIQuotaStatus(context.Background(), userID)
+    if err != nil {
+        t.Fatalf("loading status: %v", err)
+    }
+    usage := status.Usage
+    if usage.Requests != 2 || usage.InputTokens != 4 || usage.OutputTokens != 6 {
+        t.Errorf("unexpected usage %+v", usage)
+    }
+    if feature := usage.Features[models.AIFeatureChat]; feature.Requests != 2 {
+        t.Errorf("usage not broken down by feature: %+v", usage.Features)
+    }
+    if status.Remaining.Requests != 0 || status.Limits.Requests != 2 {
+        t.Errorf("unexpected quota status %+v", status)
+    }
+
+    // Another user has their own allowance
+    other := WithAIUsage(context.Background(), primitive.NewObjectID(), models.AIFeatureChat)
+    if err := CheckAIQuota(other); err != nil {
+        t.Errorf("other user: got %v", err)
+    }
+}
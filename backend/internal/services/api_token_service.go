@@ -0,0 +1,147 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    apiTokenCollection = "api_tokens"
+
+    // APITokenPrefix marks personal access tokens so AuthMiddleware can tell
+    // them apart from JWTs without trying to parse them.
+    APITokenPrefix = "tma_"
+
+    apiTokenTouchInterval = time.Minute
+)
+
+var (
+    ErrAPITokenInvalid  = errors.New("invalid or expired API token")
+    ErrAPITokenNotFound = errors.New("API token not found")
+    ErrUnknownScope     = errors.New("unknown scope")
+)
+
+func IsAPIToken(raw string) bool {
+    return strings.HasPrefix(raw, APITokenPrefix)
+}
+
+func CreateAPIToken(ctx context.Context, userID primitive.ObjectID, name string, scopes []string, expiresAt *time.Time) (*models.APIToken, string, error) {
+    for _, scope := range scopes {
+        if !validScope(scope) {
+            return nil, "", fmt.Errorf("%w %q", ErrUnknownScope, scope)
+        }
+    }
+
+    secret, err := GenerateOpaqueToken()
+    if err != nil {
+        return nil, "", err
+    }
+    raw := APITokenPrefix + secret
+
+    token := models.APIToken{
+        ID:        primitive.NewObjectID(),
+        UserID:    userID,
+        Name:      name,
+        Prefix:    raw[:len(APITokenPrefix)+6],
+        TokenHash: HashToken(raw),
+        Scopes:    scopes,
+        ExpiresAt: expiresAt,
+        CreatedAt: time.Now(),
+    }
+    if _, err := database.GetCollection(apiTokenCollection).InsertOne(ctx, token); err != nil {
+        return nil, "", fmt.Errorf("error storing API token: %v", err)
+    }
+    return &token, raw, nil
+}
+
+// AuthenticateAPIToken resolves raw to an active token and records its use.
+// Usage tracking is best effort and never rejects a valid token.
+func AuthenticateAPIToken(ctx context.Context, raw string, ip string) (*models.APIToken, error) {
+    collection := database.GetCollection(apiTokenCollection)
+    now := time.Now()
+
+    var token models.APIToken
+    err := collection.FindOne(ctx, bson.M{
+        "token_hash": HashToken(raw),
+        "revoked_at": nil,
+        "$or": []bson.M{
+            {"expires_at": nil},
+            {"expires_at": bson.M{"$gt": now}},
+        },
+    }).Decode(&token)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrAPITokenInvalid
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+        _, err = collection.UpdateOne(ctx,
+            bson.M{"_id": token.ID},
+            bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": ip}},
+        )
+        if err != nil {
+            log.Printf("Error updating API token usage: %v", err)
+        }
+    }
+    return &token, nil
+}
+
+func ListAPITokens(ctx context.Context, userID primitive.ObjectID) ([]models.APIToken, error) {
+    cursor, err := database.GetCollection(apiTokenCollection).Find(ctx,
+        bson.M{"user_id": userID, "revoked_at": nil},
+        options.Find().SetSort(bson.M{"created_at": -1}),
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    tokens := []models.APIToken{}
+    if err := cursor.All(ctx, &tokens); err != nil {
+        return nil, err
+    }
+    return tokens, nil
+}
+
+func RevokeAPIToken(ctx context.Context, tokenID, userID primitive.ObjectID) error {
+    result, err := database.GetCollection(apiTokenCollection).UpdateOne(ctx,
+        bson.M{"_id": tokenID, "user_id": userID, "revoked_at": nil},
+        bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+    )
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrAPITokenNotFound
+    }
+    return nil
+}
+
+// RevokeAllAPITokens revokes every active token belonging to the user.
+func RevokeAllAPITokens(ctx context.Context, userID primitive.ObjectID) error {
+    _, err := database.GetCollection(apiTokenCollection).UpdateMany(ctx,
+        bson.M{"user_id": userID, "revoked_at": nil},
+        bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+    )
+    return err
+}
+
+func validScope(scope string) bool {
+    for _, known := range models.APITokenScopes {
+        if scope == known {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/models"
+)
+
+func TestIsAPIToken(t *testing.T) {
+    if !IsAPIToken("tma_abc") {
+        t.Error("prefixed token not recognised")
+    }
+    if IsAPIToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+        t.Error("JWT taken for an API token")
+    }
+}
+
+func TestValidScope(t *testing.T) {
+    for _, scope := range models.APITokenScopes {
+        if !validScope(scope) {
+            t.Errorf("%q should be valid", scope)
+        }
+    }
+    for _, scope := range []string{"", "admin", "tasks:*"} {
+        if validScope(scope) {
+            t.Errorf("%q should be rejected", scope)
+        }
+    }
+}
+
+func TestAPITokenLifecycle(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    userID := primitive.NewObjectID()
+
+    if _, _, err := CreateAPIToken(ctx, userID, "ci", []string{"admin"}, nil); !errors.Is(err, ErrUnknownScope) {
+        t.Errorf("unknown scope: got %v, want ErrUnknownScope", err)
+    }
+
+    token, raw, err := CreateAPIToken(ctx, userID, "ci", []string{models.ScopeTasksRead}, nil)
+    if err != nil {
+        t.Fatalf("creating token: %v", err)
+    }
+    if !IsAPIToken(raw) || !strings.HasPrefix(raw, token.Prefix) || token.TokenHash == raw {
+        t.Errorf("unexpected token %q for %+v", raw, token)
+    }
+
+    authenticated, err := AuthenticateAPIToken(ctx, raw, "10.0.0.1")
+    if err != nil {
+        t.Fatalf("authenticating: %v", err)
+    }
+    if authenticated.ID != token.ID || len(authenticated.Scopes) != 1 {
+        t.Errorf("authenticated the wrong token: %+v", authenticated)
+    }
+    tokens, _ := ListAPITokens(ctx, userID)
+    if len(tokens) != 1 || tokens[0].LastUsedAt == nil || tokens[0].LastUsedIP != "10.0.0.1" {
+        t.Errorf("usage not recorded: %+v", tokens)
+    }
+
+    if err := RevokeAPIToken(ctx, token.ID, primitive.NewObjectID()); err != ErrAPITokenNotFound {
+        t.Errorf("revoking another user's token: got %v, want ErrAPITokenNotFound", err)
+    }
+    if err := RevokeAPIToken(ctx, token.ID, userID); err != nil {
+        t.Fatalf("revoking: %v", err)
+    }
+    if _, err := AuthenticateAPIToken(ctx, raw, "10.0.0.1"); err != ErrAPITokenInvalid {
+        t.Errorf("revoked token: got %v, want ErrAPITokenInvalid", err)
+    }
+}
+
+func TestAuthenticateAPITokenRejectsExpired(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+
+    expired := time.Now().Add(-time.Minute)
+    _, raw, err := CreateAPIToken(ctx, primitive.NewObjectID(), "old", nil, &expired)
+    if err != nil {
+        t.Fatalf("creating token: %v", err)
+    }
+    if _, err := AuthenticateAPIToken(ctx, raw, "10.0.0.1"); err != ErrAPITokenInvalid {
+        t.Errorf("got %v, want ErrAPITokenInvalid", err)
+    }
+    if _, err := AuthenticateAPIToken(ctx, "tma_unknown", "10.0.0.1"); err != ErrAPITokenInvalid {
+        t.Errorf("unknown token: got %v, want ErrAPITokenInvalid", err)
+    }
+}
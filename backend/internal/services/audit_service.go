@@ -0,0 +1,21 @@
+package services
+
+import (
+    "context"
+    "log"
+    "time"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+// RecordAudit stores an audit entry. Failures are logged rather than
+// returned so auditing never blocks the action being audited.
+func RecordAudit(ctx context.Context, entry models.AuditLog) {
+    if entry.CreatedAt.IsZero() {
+        entry.CreatedAt = time.Now()
+    }
+
+    if _, err := database.GetCollection("audit_logs").InsertOne(ctx, entry); err != nil {
+        log.Printf("Error writing audit log %s: %v", entry.Action, err)
+    }
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+)
+
+// useTestDatabase connects to TEST_MONGODB_URI and gives the test its own
+// database, dropped afterwards. Tests needing it are skipped without one.
+func useTestDatabase(t *testing.T) {
+    t.Helper()
+    uri := os.Getenv("TEST_MONGODB_URI")
+    if uri == "" {
+        t.Skip("TEST_MONGODB_URI not set")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatalf("connecting to MongoDB: %v", err)
+    }
+    if err := client.Ping(ctx, nil); err != nil {
+        t.Fatalf("pinging MongoDB: %v", err)
+    }
+
+    previous := database.DB
+    database.DB = client.Database(fmt.Sprintf("task_management_test_%d", time.Now().UnixNano()))
+    t.Cleanup(func() {
+        database.DB.Drop(context.Background())
+        client.Disconnect(context.Background())
+        database.DB = previous
+    })
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+const (
+    defaultAnthropicBaseURL = "https://api.anthropic.com"
+    defaultAnthropicModel   = "claude-3-5-haiku-latest"
+    anthropicVersion        = "2023-06-01"
+)
+
+type AnthropicProvider struct {
+    baseURL string
+    apiKey  string
+    model   string
+    client  *http.Client
+}
+
+type anthropicRequest struct {
+    Model       string                 `json:"model"`
+    System      string                 `json:"system,omitempty"`
+    Messages    []Message              `json:"messages"`
+    MaxTokens   int                    `json:"max_tokens"`
+    Temperature *float64               `json:"temperature,omitempty"`
+    Tools       []anthropicTool        `json:"tools,omitempty"`
+    ToolChoice  map[string]interface{} `json:"tool_choice,omitempty"`
+    Stream      bool                   `json:"stream,omitempty"`
+}
+
+type anthropicTool struct {
+    Name        string                 `json:"name"`
+    Description string                 `json:"description,omitempty"`
+    InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+    Model   string `json:"model"`
+    Content []struct {
+        Type  string          `json:"type"`
+        Text  string          `json:"text"`
+        Input json.RawMessage `json:"input"`
+    } `json:"content"`
+    Usage struct {
+        InputTokens  int `json:"input_tokens"`
+        OutputTokens int `json:"output_tokens"`
+    } `json:"usage"`
+}
+
+func NewAnthropicProvider(baseURL, apiKey, model string, client *http.Client) *AnthropicProvider {
+    if baseURL == "" {
+        baseURL = defaultAnthropicBaseURL
+    }
+    if model == "" {
+        model = defaultAnthropicModel
+    }
+    return &AnthropicProvider{
+        baseURL: strings.TrimRight(baseURL, "/"),
+        apiKey:  apiKey,
+        model:   model,
+        client:  client,
+    }
+}
+
+func (p *AnthropicProvider) Name() string  { return "anthropic" }
+func (p *AnthropicProvider) Model() string { return p.model }
+
+func (p *AnthropicProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+    resp, err := p.post(ctx, p.newRequest(req))
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    var response anthropicResponse
+    if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+        return nil, fmt.Errorf("error decoding response: %v", err)
+    }
+
+    var text strings.Builder
+    for _, block := range response.Content {
+        switch {
+        case block.Type == "tool_use" && req.Schema != nil:
+            text.Reset()
+            text.Write(block.Input)
+        case block.Type == "text" && req.Schema == nil:
+            text.WriteString(block.Text)
+        }
+    }
+    if text.Len() == 0 {
+        return nil, fmt.Errorf("no suggestions generated")
+    }
+
+    return &CompletionResponse{
+        Content:      text.String(),
+        Model:        response.Model,
+        InputTokens:  response.Usage.InputTokens,
+        OutputTokens: response.Usage.OutputTokens,
+    }, nil
+}
+
+// anthropicStreamEvent covers the fields used from the Messages API stream
+// events: message_start, content_block_delta, message_delta and error.
+type anthropicStreamEvent struct {
+    Message struct {
+        Model string `json:"model"`
+        Usage struct {
+            InputTokens int `json:"input_tokens"`
+        } `json:"usage"`
+    } `json:"message"`
+    Delta struct {
+        Type        string `json:"type"`
+        Text        string `json:"text"`
+        PartialJSON string `json:"partial_json"`
+    } `json:"delta"`
+    Usage struct {
+        OutputTokens int `json:"output_tokens"`
+    } `json:"usage"`
+    Error struct {
+        Message string `json:"message"`
+    } `json:"error"`
+}
+
+func (p *AnthropicProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*CompletionResponse, error) {
+    request := p.newRequest(req)
+    request.Stream = true
+
+    resp, err := p.post(ctx, request)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    result := &CompletionResponse{Model: p.model}
+    var content strings.Builder
+    err = readSSE(resp.Body, func(event, data string) error {
+        var payload anthropicStreamEvent
+        if err := json.Unmarshal([]byte(data), &payload); err != nil {
+            return fmt.Errorf("error decoding stream event: %v", err)
+        }
+
+        switch event {
+        case "message_start":
+            if payload.Message.Model != "" {
+                result.Model = payload.Message.Model
+            }
+            result.InputTokens = payload.Message.Usage.InputTokens
+        case "message_delta":
+            result.OutputTokens = payload.Usage.OutputTokens
+        case "message_stop":
+            return errStreamDone
+        case "error":
+            return &LLMAPIError{Provider: "Anthropic", Message: payload.Error.Message}
+        case "content_block_delta":
+            // With a schema the answer arrives as tool input JSON
+            delta := payload.Delta.Text
+            if req.Schema != nil {
+                delta = payload.Delta.PartialJSON
+            }
+            if delta == "" {
+                return nil
+            }
+            content.WriteString(delta)
+            return onDelta(delta)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    result.Content = content.String()
+    return result, nil
+}
+
+func (p *AnthropicProvider) newRequest(req CompletionRequest) anthropicRequest {
+    // The Messages API requires max_tokens
+    maxTokens := req.MaxTokens
+    if maxTokens <= 0 {
+        maxTokens = defaultMaxTokens
+    }
+
+    request := anthropicRequest{
+        Model:       p.model,
+        System:      req.System,
+        Messages:    req.Messages,
+        MaxTokens:   maxTokens,
+        Temperature: req.Temperature,
+    }
+    // Structured output is obtained by forcing a call to a tool whose input
+    // schema is the requested one; the tool input is the answer.
+    if req.Schema != nil {
+        request.Tools = []anthropicTool{{
+            Name:        req.Schema.Name,
+            Description: req.Schema.Description,
+            InputSchema: req.Schema.Schema,
+        }}
+        request.ToolChoice = map[string]interface{}{"type": "tool", "name": req.Schema.Name}
+    }
+    return request
+}
+
+// post sends a Messages API request and returns the response when it
+// succeeded. The caller closes the body.
+func (p *AnthropicProvider) post(ctx context.Context, request anthropicRequest) (*http.Response, error) {
+    jsonData, err := json.Marshal(request)
+    if err != nil {
+        return nil, fmt.Errorf("error marshaling request: %v", err)
+    }
+
+    httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
+    if err != nil {
+        return nil, fmt.Errorf("error creating request: %v", err)
+    }
+
+    httpReq.Header.Set("Content-Type", "application/json")
+    httpReq.Header.Set("x-api-key", p.apiKey)
+    httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+    resp, err := p.client.Do(httpReq)
+    if err != nil {
+        return nil, fmt.Errorf("error making request: %v", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        var errorResponse struct {
+            Error struct {
+                Message string `json:"message"`
+            } `json:"error"`
+        }
+        json.NewDecoder(resp.Body).Decode(&errorResponse)
+        return nil, &LLMAPIError{
+            Provider:   "Anthropic",
+            StatusCode: resp.StatusCode,
+            Message:    errorResponse.Error.Message,
+            RetryAfter: parseRetryAfter(resp.Header),
+        }
+    }
+    return resp, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+    "task-management/internal/models"
+)
+
+// FakeProvider answers without any network access. The reply is fixed when
+// configured, otherwise derived from the prompt, so the same input always
+// produces the same output.
+type FakeProvider struct {
+    response string
+}
+
+func NewFakeProvider(response string) *FakeProvider {
+    return &FakeProvider{response: response}
+}
+
+func (p *FakeProvider) Name() string  { return "fake" }
+func (p *FakeProvider) Model() string { return "fake" }
+
+func (p *FakeProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+
+    prompt := req.System
+    for _, m := range req.Messages {
+        prompt += "\n" + m.Content
+    }
+
+    sum := sha256.Sum256([]byte(prompt))
+    digest := hex.EncodeToString(sum[:4])
+
+    content := p.response
+    switch {
+    case content != "":
+    case req.Schema != nil:
+        content = fakeStructuredReply(req, digest)
+    default:
+        firstLine := strings.TrimSpace(strings.SplitN(strings.TrimSpace(prompt), "\n", 2)[0])
+        content = fmt.Sprintf("Fake suggestion %s for: %s", digest, firstLine)
+    }
+
+    return &CompletionResponse{
+        Content:      content,
+        Model:        "fake",
+        InputTokens:  len(strings.Fields(prompt)),
+        OutputTokens: len(strings.Fields(content)),
+    }, nil
+}
+
+// Stream replays the Complete answer a word at a time.
+func (p *FakeProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*CompletionResponse, error) {
+    response, err := p.Complete(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, word := range strings.SplitAfter(response.Content, " ") {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        if err := onDelta(word); err != nil {
+            return nil, err
+        }
+    }
+    return response, nil
+}
+
+// fakeStructuredReply returns a valid answer for the schemas the API uses.
+func fakeStructuredReply(req CompletionRequest, digest string) string {
+    var reply interface{}
+    switch req.Schema.Name {
+    case taskAnalysisSchema.Name:
+        reply = models.TaskAnalysis{
+            Summary: "Fake analysis " + digest,
+            Subtasks: []models.SuggestedSubtask{
+                {Title: "Research the requirements", Description: "Collect what is needed.", Priority: "medium", EstimateMinutes: 30, DependsOn: []int{}},
+                {Title: "Do the work", Description: "Carry out the task.", Priority: "high", EstimateMinutes: 90, DependsOn: []int{0}},
+                {Title: "Review the result", Description: "Check the outcome.", Priority: "low", EstimateMinutes: 30, DependsOn: []int{1}},
+            },
+            Risks: []models.TaskRisk{
+                {Description: "Requirements may change.", Severity: "medium", Mitigation: "Confirm them early."},
+            },
+            TotalEstimateMinutes: 150,
+        }
+    case taskDraftSchema.Name:
+        draft := parseTaskRules(lastMessage(req), time.Now())
+        parsed := taskDraftReply{
+            Title:    draft.Task.Title,
+            Priority: draft.Task.Priority,
+            Tags:     append([]string{}, draft.Task.Tags...),
+            Assignee: draft.Assignee,
+        }
+        if draft.Task.DueDate != nil {
+            parsed.DueDate = draft.Task.DueDate.Format("2006-01-02")
+        }
+        reply = parsed
+    case dailyPlanSchema.Name:
+        // Tasks are listed most urgent first; the first three go to today
+        plan := dailyPlanReply{Summary: "Fake plan " + digest, Today: []planItemReply{}, ThisWeek: []planItemReply{}}
+        for i, m := range fakeTaskIDPattern.FindAllStringSubmatch(lastMessage(req), -1) {
+            item := planItemReply{TaskID: m[1], Rationale: "Listed as number " + fmt.Sprint(i+1) + "."}
+            if i < 3 {
+                plan.Today = append(plan.Today, item)
+            } else {
+                plan.ThisWeek = append(plan.ThisWeek, item)
+            }
+        }
+        reply = plan
+    default:
+        reply = map[string]interface{}{}
+    }
+
+    data, _ := json.Marshal(reply)
+    return string(data)
+}
+
+var fakeTaskIDPattern = regexp.MustCompile(`task_id: ([0-9a-f]{24})`)
+
+func lastMessage(req CompletionRequest) string {
+    if len(req.Messages) == 0 {
+        return ""
+    }
+    return req.Messages[len(req.Messages)-1].Content
+}
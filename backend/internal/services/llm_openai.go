@@ -0,0 +1,237 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+const (
+    defaultOpenAIBaseURL = "https://api.openai.com/v1"
+    defaultOpenAIModel   = "gpt-4o-mini"
+)
+
+// OpenAIProvider speaks the OpenAI chat completions API, which many
+// self-hosted servers implement as well.
+type OpenAIProvider struct {
+    baseURL string
+    apiKey  string
+    model   string
+    client  *http.Client
+}
+
+type OpenAIRequest struct {
+    Model          string                `json:"model"`
+    Messages       []Message             `json:"messages"`
+    MaxTokens      int                   `json:"max_tokens,omitempty"`
+    Temperature    *float64              `json:"temperature,omitempty"`
+    ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+    Stream         bool                  `json:"stream,omitempty"`
+    StreamOptions  *openAIStreamOptions  `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+    IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponseFormat struct {
+    Type       string `json:"type"`
+    JSONSchema struct {
+        Name        string                 `json:"name"`
+        Description string                 `json:"description,omitempty"`
+        Schema      map[string]interface{} `json:"schema"`
+        Strict      bool                   `json:"strict"`
+    } `json:"json_schema"`
+}
+
+type Message struct {
+    Role    string `json:"role"`
+    Content string `json:"content"`
+}
+
+type OpenAIResponse struct {
+    ID      string `json:"id"`
+    Object  string `json:"object"`
+    Created int64  `json:"created"`
+    Model   string `json:"model"`
+    Choices []struct {
+        Message struct {
+            Role    string `json:"role"`
+            Content string `json:"content"`
+        } `json:"message"`
+    } `json:"choices"`
+    Usage struct {
+        PromptTokens     int `json:"prompt_tokens"`
+        CompletionTokens int `json:"completion_tokens"`
+    } `json:"usage"`
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string, client *http.Client) *OpenAIProvider {
+    if baseURL == "" {
+        baseURL = defaultOpenAIBaseURL
+    }
+    if model == "" {
+        model = defaultOpenAIModel
+    }
+    return &OpenAIProvider{
+        baseURL: strings.TrimRight(baseURL, "/"),
+        apiKey:  apiKey,
+        model:   model,
+        client:  client,
+    }
+}
+
+func (p *OpenAIProvider) Name() string  { return "openai" }
+func (p *OpenAIProvider) Model() string { return p.model }
+
+// openAIStreamChunk is one server-sent event of a streamed completion. Usage
+// is only set on the final chunk, and only when include_usage was requested.
+type openAIStreamChunk struct {
+    Model   string `json:"model"`
+    Choices []struct {
+        Delta struct {
+            Content string `json:"content"`
+        } `json:"delta"`
+    } `json:"choices"`
+    Usage *struct {
+        PromptTokens     int `json:"prompt_tokens"`
+        CompletionTokens int `json:"completion_tokens"`
+    } `json:"usage"`
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+    resp, err := p.post(ctx, p.newRequest(req))
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    var response OpenAIResponse
+    if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+        return nil, fmt.Errorf("error decoding response: %v", err)
+    }
+
+    if len(response.Choices) == 0 {
+        return nil, fmt.Errorf("no suggestions generated")
+    }
+
+    return &CompletionResponse{
+        Content:      response.Choices[0].Message.Content,
+        Model:        response.Model,
+        InputTokens:  response.Usage.PromptTokens,
+        OutputTokens: response.Usage.CompletionTokens,
+    }, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*CompletionResponse, error) {
+    request := p.newRequest(req)
+    request.Stream = true
+    request.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+
+    resp, err := p.post(ctx, request)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    result := &CompletionResponse{Model: p.model}
+    var content strings.Builder
+    err = readSSE(resp.Body, func(event, data string) error {
+        if data == "[DONE]" {
+            return errStreamDone
+        }
+
+        var chunk openAIStreamChunk
+        if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+            return fmt.Errorf("error decoding stream chunk: %v", err)
+        }
+        if chunk.Model != "" {
+            result.Model = chunk.Model
+        }
+        if chunk.Usage != nil {
+            result.InputTokens = chunk.Usage.PromptTokens
+            result.OutputTokens = chunk.Usage.CompletionTokens
+        }
+        if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+            return nil
+        }
+
+        delta := chunk.Choices[0].Delta.Content
+        content.WriteString(delta)
+        return onDelta(delta)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    result.Content = content.String()
+    return result, nil
+}
+
+func (p *OpenAIProvider) newRequest(req CompletionRequest) OpenAIRequest {
+    messages := req.Messages
+    if req.System != "" {
+        messages = append([]Message{{Role: "system", Content: req.System}}, messages...)
+    }
+
+    request := OpenAIRequest{
+        Model:       p.model,
+        Messages:    messages,
+        MaxTokens:   req.MaxTokens,
+        Temperature: req.Temperature,
+    }
+    if req.Schema != nil {
+        format := &openAIResponseFormat{Type: "json_schema"}
+        format.JSONSchema.Name = req.Schema.Name
+        format.JSONSchema.Description = req.Schema.Description
+        format.JSONSchema.Schema = req.Schema.Schema
+        format.JSONSchema.Strict = true
+        request.ResponseFormat = format
+    }
+
+    return request
+}
+
+// post sends a chat completion request and returns the response when it
+// succeeded. The caller closes the body.
+func (p *OpenAIProvider) post(ctx context.Context, request OpenAIRequest) (*http.Response, error) {
+    jsonData, err := json.Marshal(request)
+    if err != nil {
+        return nil, fmt.Errorf("error marshaling request: %v", err)
+    }
+
+    httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+    if err != nil {
+        return nil, fmt.Errorf("error creating request: %v", err)
+    }
+
+    httpReq.Header.Set("Content-Type", "application/json")
+    if p.apiKey != "" {
+        httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+    }
+
+    resp, err := p.client.Do(httpReq)
+    if err != nil {
+        return nil, fmt.Errorf("error making request: %v", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        var errorResponse struct {
+            Error struct {
+                Message string `json:"message"`
+            } `json:"error"`
+        }
+        json.NewDecoder(resp.Body).Decode(&errorResponse)
+        return nil, &LLMAPIError{
+            Provider:   "OpenAI",
+            StatusCode: resp.StatusCode,
+            Message:    errorResponse.Error.Message,
+            RetryAfter: parseRetryAfter(resp.Header),
+        }
+    }
+    return resp, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "time"
+)
+
+// LLMProvider is a chat completion backend used by AIService.
+type LLMProvider interface {
+    Name() string
+    Model() string
+    Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error)
+}
+
+type CompletionRequest struct {
+    System      string
+    Messages    []Message
+    MaxTokens   int
+    Temperature *float64
+    // Schema, when set, constrains the reply to JSON matching it
+    Schema *JSONSchema
+}
+
+type JSONSchema struct {
+    Name        string
+    Description string
+    Schema      map[string]interface{}
+}
+
+type CompletionResponse struct {
+    Content      string
+    Model        string
+    InputTokens  int
+    OutputTokens int
+}
+
+// LLMAPIError is returned when a provider answers with an error status.
+type LLMAPIError struct {
+    Provider   string
+    StatusCode int
+    Message    string
+    // RetryAfter is the server's Retry-After, if it sent one
+    RetryAfter time.Duration
+}
+
+func (e *LLMAPIError) Error() string {
+    if e.Message == "" {
+        return fmt.Sprintf("%s API error, status code: %d", e.Provider, e.StatusCode)
+    }
+    return fmt.Sprintf("%s API error: %s", e.Provider, e.Message)
+}
+
+const defaultMaxTokens = 1024
+
+// NewLLMProviderFromEnv builds the provider selected by LLM_PROVIDER:
+//
+//   - "openai" (default) talks to any OpenAI-compatible chat completions API.
+//     LLM_BASE_URL points it at a local server such as Ollama or llama.cpp,
+//     which usually need no API key.
+//   - "anthropic" uses the Anthropic Messages API.
+//   - "fake" returns canned, deterministic answers for tests and demos.
+//
+// LLM_MODEL and LLM_API_KEY apply to every provider. OPENAI_API_KEY and
+// ANTHROPIC_API_KEY are accepted as fallbacks for the key.
+func NewLLMProviderFromEnv() (LLMProvider, error) {
+    name := strings.ToLower(os.Getenv("LLM_PROVIDER"))
+    model := os.Getenv("LLM_MODEL")
+    baseURL := os.Getenv("LLM_BASE_URL")
+    client := newLLMHTTPClient(loadResilienceConfig())
+
+    switch name {
+    case "", "openai":
+        apiKey := firstNonEmpty(os.Getenv("LLM_API_KEY"), os.Getenv("OPENAI_API_KEY"))
+        if apiKey == "" && baseURL == "" {
+            return nil, fmt.Errorf("OpenAI API key is not set")
+        }
+        return NewOpenAIProvider(baseURL, apiKey, model, client), nil
+    case "anthropic":
+        apiKey := firstNonEmpty(os.Getenv("LLM_API_KEY"), os.Getenv("ANTHROPIC_API_KEY"))
+        if apiKey == "" {
+            return nil, fmt.Errorf("Anthropic API key is not set")
+        }
+        return NewAnthropicProvider(baseURL, apiKey, model, client), nil
+    case "fake":
+        return NewFakeProvider(os.Getenv("LLM_FAKE_RESPONSE")), nil
+    }
+    return nil, fmt.Errorf("unknown LLM_PROVIDER %q", name)
+}
+
+// InitAI configures the global AI service. AI features stay disabled, and
+// their endpoints answer 503, when no provider is configured.
+func InitAI() {
+    provider, err := NewLLMProviderFromEnv()
+    if err != nil {
+        log.Printf("Warning: AI features disabled: %v", err)
+        return
+    }
+    AI = NewAIService(NewResilientProvider(provider, loadResilienceConfig()))
+    log.Printf("AI provider %s using model %s", provider.Name(), provider.Model())
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// AIHealth describes the AI provider for the health endpoint, or returns nil
+// when AI features are disabled.
+func AIHealth() map[string]interface{} {
+    if AI == nil {
+        return nil
+    }
+    health := map[string]interface{}{
+        "provider": AI.Provider().Name(),
+        "model":    AI.Provider().Model(),
+    }
+    if resilient, ok := AI.Provider().(*ResilientProvider); ok {
+        health["circuit"] = resilient.Breaker()
+    }
+    return health
+}
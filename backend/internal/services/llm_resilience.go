@@ -0,0 +1,311 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "log"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// ErrLLMUnavailable is returned without calling the provider while the
+// circuit breaker is open. Handlers answer 503.
+var ErrLLMUnavailable = errors.New("AI provider is temporarily unavailable")
+
+// consumerError marks an error returned by the caller's stream callback, such
+// as a client that disconnected mid-answer. It says nothing about the
+// provider's health, so it is neither retried nor counted by the breaker.
+type consumerError struct {
+    err error
+}
+
+func (e *consumerError) Error() string { return e.err.Error() }
+func (e *consumerError) Unwrap() error { return e.err }
+
+const (
+    CircuitClosed   = "closed"
+    CircuitOpen     = "open"
+    CircuitHalfOpen = "half_open"
+)
+
+type resilienceConfig struct {
+    callTimeout      time.Duration
+    streamTimeout    time.Duration
+    maxAttempts      int
+    baseBackoff      time.Duration
+    maxBackoff       time.Duration
+    breakerThreshold int
+    breakerCooldown  time.Duration
+}
+
+func loadResilienceConfig() resilienceConfig {
+    return resilienceConfig{
+        callTimeout:      envDuration("LLM_TIMEOUT", 60*time.Second),
+        streamTimeout:    envDuration("LLM_STREAM_TIMEOUT", 5*time.Minute),
+        maxAttempts:      envInt("LLM_MAX_ATTEMPTS", 3),
+        baseBackoff:      envDuration("LLM_RETRY_BACKOFF", 500*time.Millisecond),
+        maxBackoff:       envDuration("LLM_RETRY_MAX_BACKOFF", 30*time.Second),
+        breakerThreshold: envInt("LLM_BREAKER_THRESHOLD", 5),
+        breakerCooldown:  envDuration("LLM_BREAKER_COOLDOWN", 30*time.Second),
+    }
+}
+
+// newLLMHTTPClient has no overall timeout, which would cut streams short;
+// every call gets a deadline through its context instead.
+func newLLMHTTPClient(cfg resilienceConfig) *http.Client {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.ResponseHeaderTimeout = cfg.callTimeout
+    return &http.Client{Transport: transport}
+}
+
+// ResilientProvider wraps a provider with per-call timeouts, retries with
+// jittered backoff on rate limits and server errors, and a circuit breaker
+// that fails fast while the upstream is down.
+type ResilientProvider struct {
+    LLMProvider
+    cfg     resilienceConfig
+    breaker *circuitBreaker
+}
+
+func NewResilientProvider(provider LLMProvider, cfg resilienceConfig) *ResilientProvider {
+    return &ResilientProvider{
+        LLMProvider: provider,
+        cfg:         cfg,
+        breaker:     &circuitBreaker{threshold: cfg.breakerThreshold, cooldown: cfg.breakerCooldown, state: CircuitClosed},
+    }
+}
+
+func (p *ResilientProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+    var response *CompletionResponse
+    err := p.retry(ctx, p.cfg.callTimeout, func(attemptCtx context.Context) (bool, error) {
+        var err error
+        response, err = p.LLMProvider.Complete(attemptCtx, req)
+        return true, err
+    })
+    return response, err
+}
+
+// Stream retries only failures that happen before any text was delivered;
+// after that the caller has already seen part of the answer.
+func (p *ResilientProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*CompletionResponse, error) {
+    streamer, ok := p.LLMProvider.(StreamingProvider)
+    if !ok {
+        response, err := p.Complete(ctx, req)
+        if err != nil {
+            return nil, err
+        }
+        return response, onDelta(response.Content)
+    }
+
+    var response *CompletionResponse
+    err := p.retry(ctx, p.cfg.streamTimeout, func(attemptCtx context.Context) (bool, error) {
+        started := false
+        var err error
+        response, err = streamer.Stream(attemptCtx, req, func(delta string) error {
+            started = true
+            if err := onDelta(delta); err != nil {
+                return &consumerError{err: err}
+            }
+            return nil
+        })
+        return !started, err
+    })
+    return response, err
+}
+
+// Breaker reports the circuit breaker's current state.
+func (p *ResilientProvider) Breaker() CircuitState {
+    return p.breaker.snapshot()
+}
+
+// retry runs attempt until it succeeds, fails with an error that isn't worth
+// retrying, or runs out of attempts. attempt reports whether it may be
+// retried at all.
+func (p *ResilientProvider) retry(ctx context.Context, timeout time.Duration, attempt func(context.Context) (bool, error)) error {
+    for n := 1; ; n++ {
+        if err := p.breaker.allow(); err != nil {
+            return err
+        }
+
+        attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+        retryable, err := attempt(attemptCtx)
+        cancel()
+
+        if err == nil {
+            p.breaker.success()
+            return nil
+        }
+        // The caller gave up; that says nothing about the upstream
+        var consumerErr *consumerError
+        if errors.As(err, &consumerErr) {
+            p.breaker.release()
+            return consumerErr.err
+        }
+        if ctx.Err() != nil {
+            p.breaker.release()
+            return err
+        }
+
+        wait, transient := retryDelay(err, n, p.cfg)
+        switch {
+        case !transient:
+            // The upstream answered, even if it didn't like the request
+            p.breaker.success()
+        case isRateLimited(err):
+            // Rate limits are handled by Retry-After, not the breaker
+            p.breaker.release()
+        default:
+            p.breaker.failure()
+        }
+        if !transient || !retryable || n >= p.cfg.maxAttempts || wait > p.cfg.maxBackoff {
+            return err
+        }
+        if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+            return err
+        }
+
+        log.Printf("%s request failed (attempt %d), retrying in %s: %v", p.Name(), n, wait.Round(time.Millisecond), err)
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(wait):
+        }
+    }
+}
+
+// retryDelay reports whether err is a transient upstream failure and how
+// long to wait before trying again: the server's Retry-After when given,
+// otherwise exponential backoff with full jitter.
+func retryDelay(err error, attempt int, cfg resilienceConfig) (time.Duration, bool) {
+    var apiErr *LLMAPIError
+    if errors.As(err, &apiErr) {
+        switch apiErr.StatusCode {
+        case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+            http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+        default:
+            return 0, false
+        }
+        if apiErr.RetryAfter > 0 {
+            return apiErr.RetryAfter, true
+        }
+    }
+
+    backoff := cfg.baseBackoff << (attempt - 1)
+    if backoff <= 0 || backoff > cfg.maxBackoff {
+        backoff = cfg.maxBackoff
+    }
+    return time.Duration(rand.Int63n(int64(backoff)) + 1), true
+}
+
+func isRateLimited(err error) bool {
+    var apiErr *LLMAPIError
+    return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date. Some OpenAI-compatible servers send retry-after-ms instead.
+func parseRetryAfter(header http.Header) time.Duration {
+    if ms, err := strconv.Atoi(header.Get("retry-after-ms")); err == nil && ms > 0 {
+        return time.Duration(ms) * time.Millisecond
+    }
+
+    value := header.Get("Retry-After")
+    if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+        return time.Duration(seconds) * time.Second
+    }
+    if date, err := http.ParseTime(value); err == nil {
+        if wait := time.Until(date); wait > 0 {
+            return wait
+        }
+    }
+    return 0
+}
+
+// CircuitState is reported on the health endpoint.
+type CircuitState struct {
+    State               string     `json:"state"`
+    ConsecutiveFailures int        `json:"consecutive_failures"`
+    OpenedAt            *time.Time `json:"opened_at,omitempty"`
+    RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// circuitBreaker opens after threshold consecutive transient failures and
+// rejects calls until cooldown has passed. Then a single probe call is let
+// through: success closes the circuit, failure opens it again.
+type circuitBreaker struct {
+    mu        sync.Mutex
+    threshold int
+    cooldown  time.Duration
+    state     string
+    failures  int
+    openedAt  time.Time
+    probing   bool
+}
+
+func (b *circuitBreaker) allow() error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    switch b.state {
+    case CircuitOpen:
+        if time.Since(b.openedAt) < b.cooldown {
+            return ErrLLMUnavailable
+        }
+        b.state = CircuitHalfOpen
+        b.probing = true
+        return nil
+    case CircuitHalfOpen:
+        if b.probing {
+            return ErrLLMUnavailable
+        }
+        b.probing = true
+    }
+    return nil
+}
+
+func (b *circuitBreaker) success() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.state != CircuitClosed {
+        log.Printf("AI provider circuit closed")
+    }
+    b.state = CircuitClosed
+    b.failures = 0
+    b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.failures++
+    b.probing = false
+    if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+        log.Printf("AI provider circuit opened after %d consecutive failure(s)", b.failures)
+        b.state = CircuitOpen
+        b.openedAt = time.Now()
+    }
+}
+
+// release ends a probe whose outcome is unknown, letting the next call try.
+func (b *circuitBreaker) release() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.probing = false
+}
+
+func (b *circuitBreaker) snapshot() CircuitState {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    state := CircuitState{State: b.state, ConsecutiveFailures: b.failures}
+    if b.state != CircuitClosed {
+        openedAt := b.openedAt
+        retryAt := b.openedAt.Add(b.cooldown)
+        state.OpenedAt = &openedAt
+        state.RetryAt = &retryAt
+    }
+    return state
+}
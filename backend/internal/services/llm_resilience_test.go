@@ -0,0 +1,266 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func testResilienceConfig() resilienceConfig {
+    return resilienceConfig{
+        callTimeout:      time.Second,
+        streamTimeout:    time.Second,
+        maxAttempts:      3,
+        baseBackoff:      time.Millisecond,
+        maxBackoff:       10 * time.Millisecond,
+        breakerThreshold: 2,
+        breakerCooldown:  50 * time.Millisecond,
+    }
+}
+
+// stubProvider answers each call with the next error in errs, then succeeds.
+type stubProvider struct {
+    errs   []error
+    deltas []string
+    calls  int
+}
+
+func (p *stubProvider) Name() string  { return "stub" }
+func (p *stubProvider) Model() string { return "stub-model" }
+
+func (p *stubProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+    p.calls++
+    if p.calls <= len(p.errs) && p.errs[p.calls-1] != nil {
+        return nil, p.errs[p.calls-1]
+    }
+    return &CompletionResponse{Content: "ok", Model: p.Model()}, nil
+}
+
+func (p *stubProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*CompletionResponse, error) {
+    response, err := p.Complete(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    for _, delta := range p.deltas {
+        if err := onDelta(delta); err != nil {
+            return nil, err
+        }
+    }
+    return response, nil
+}
+
+func apiError(status int) *LLMAPIError {
+    return &LLMAPIError{Provider: "stub", StatusCode: status}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+    cfg := testResilienceConfig()
+    b := &circuitBreaker{threshold: cfg.breakerThreshold, cooldown: cfg.breakerCooldown, state: CircuitClosed}
+
+    for i := 0; i < cfg.breakerThreshold; i++ {
+        if err := b.allow(); err != nil {
+            t.Fatalf("closed breaker rejected call %d: %v", i, err)
+        }
+        b.failure()
+    }
+    if state := b.snapshot(); state.State != CircuitOpen || state.RetryAt == nil {
+        t.Fatalf("breaker should be open with a retry time, got %+v", state)
+    }
+    if err := b.allow(); err != ErrLLMUnavailable {
+        t.Fatalf("open breaker allowed a call, err = %v", err)
+    }
+
+    time.Sleep(cfg.breakerCooldown)
+
+    // Only one probe is let through while half open
+    if err := b.allow(); err != nil {
+        t.Fatalf("breaker didn't let a probe through after cooldown: %v", err)
+    }
+    if b.snapshot().State != CircuitHalfOpen {
+        t.Fatalf("breaker should be half open, got %s", b.snapshot().State)
+    }
+    if err := b.allow(); err != ErrLLMUnavailable {
+        t.Fatalf("second call allowed while probing, err = %v", err)
+    }
+
+    b.success()
+    if state := b.snapshot(); state.State != CircuitClosed || state.ConsecutiveFailures != 0 {
+        t.Fatalf("successful probe should close the breaker, got %+v", state)
+    }
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+    b := &circuitBreaker{threshold: 1, cooldown: 20 * time.Millisecond, state: CircuitClosed}
+    b.allow()
+    b.failure()
+    time.Sleep(20 * time.Millisecond)
+
+    if err := b.allow(); err != nil {
+        t.Fatalf("probe rejected: %v", err)
+    }
+    b.failure()
+    if b.snapshot().State != CircuitOpen {
+        t.Fatalf("failed probe should reopen the breaker, got %s", b.snapshot().State)
+    }
+    if err := b.allow(); err != ErrLLMUnavailable {
+        t.Fatalf("reopened breaker allowed a call, err = %v", err)
+    }
+}
+
+func TestCircuitBreakerReleaseEndsProbe(t *testing.T) {
+    b := &circuitBreaker{threshold: 1, cooldown: 20 * time.Millisecond, state: CircuitClosed}
+    b.allow()
+    b.failure()
+    time.Sleep(20 * time.Millisecond)
+
+    b.allow()
+    b.release()
+    if err := b.allow(); err != nil {
+        t.Fatalf("released probe should let the next call try, err = %v", err)
+    }
+}
+
+func TestRetryDelay(t *testing.T) {
+    cfg := testResilienceConfig()
+
+    tests := []struct {
+        name      string
+        err       error
+        transient bool
+    }{
+        {"rate limited", apiError(http.StatusTooManyRequests), true},
+        {"server error", apiError(http.StatusInternalServerError), true},
+        {"bad gateway", apiError(http.StatusBadGateway), true},
+        {"unavailable", apiError(http.StatusServiceUnavailable), true},
+        {"gateway timeout", apiError(http.StatusGatewayTimeout), true},
+        {"overloaded", apiError(529), true},
+        {"bad request", apiError(http.StatusBadRequest), false},
+        {"unauthorized", apiError(http.StatusUnauthorized), false},
+        {"transport error", errors.New("connection reset by peer"), true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            wait, transient := retryDelay(tt.err, 1, cfg)
+            if transient != tt.transient {
+                t.Fatalf("transient = %v, want %v", transient, tt.transient)
+            }
+            if transient && (wait <= 0 || wait > cfg.maxBackoff) {
+                t.Errorf("wait = %s, want within (0, %s]", wait, cfg.maxBackoff)
+            }
+        })
+    }
+}
+
+func TestRetryDelayHonoursRetryAfter(t *testing.T) {
+    err := &LLMAPIError{Provider: "stub", StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second}
+    wait, transient := retryDelay(err, 1, testResilienceConfig())
+    if !transient || wait != 3*time.Second {
+        t.Fatalf("got (%s, %v), want (3s, true)", wait, transient)
+    }
+}
+
+func TestRetryDelayBackoffIsCapped(t *testing.T) {
+    cfg := testResilienceConfig()
+    for attempt := 1; attempt <= 70; attempt++ {
+        wait, _ := retryDelay(errors.New("timeout"), attempt, cfg)
+        if wait <= 0 || wait > cfg.maxBackoff {
+            t.Fatalf("attempt %d: wait = %s, want within (0, %s]", attempt, wait, cfg.maxBackoff)
+        }
+    }
+}
+
+func TestParseRetryAfter(t *testing.T) {
+    header := http.Header{}
+    header.Set("Retry-After", "7")
+    if got := parseRetryAfter(header); got != 7*time.Second {
+        t.Errorf("seconds: got %s", got)
+    }
+
+    header.Set("retry-after-ms", "250")
+    if got := parseRetryAfter(header); got != 250*time.Millisecond {
+        t.Errorf("milliseconds: got %s", got)
+    }
+
+    header = http.Header{}
+    header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+    if got := parseRetryAfter(header); got <= 0 || got > time.Minute {
+        t.Errorf("HTTP date: got %s", got)
+    }
+
+    if got := parseRetryAfter(http.Header{}); got != 0 {
+        t.Errorf("missing header: got %s", got)
+    }
+}
+
+func TestResilientProviderRetriesTransientErrors(t *testing.T) {
+    stub := &stubProvider{errs: []error{apiError(http.StatusServiceUnavailable)}}
+    provider := NewResilientProvider(stub, testResilienceConfig())
+
+    response, err := provider.Complete(context.Background(), CompletionRequest{})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if response.Content != "ok" || stub.calls != 2 {
+        t.Fatalf("got %q after %d calls, want ok after 2", response.Content, stub.calls)
+    }
+    if state := provider.Breaker(); state.State != CircuitClosed || state.ConsecutiveFailures != 0 {
+        t.Errorf("success should reset the breaker, got %+v", state)
+    }
+}
+
+func TestResilientProviderDoesNotRetryClientErrors(t *testing.T) {
+    stub := &stubProvider{errs: []error{apiError(http.StatusBadRequest)}}
+    provider := NewResilientProvider(stub, testResilienceConfig())
+
+    if _, err := provider.Complete(context.Background(), CompletionRequest{}); err == nil {
+        t.Fatal("expected the 400 to be returned")
+    }
+    if stub.calls != 1 {
+        t.Errorf("400 was retried: %d calls", stub.calls)
+    }
+    if state := provider.Breaker(); state.ConsecutiveFailures != 0 {
+        t.Errorf("a 400 shows the upstream is up, got %+v", state)
+    }
+}
+
+func TestResilientProviderOpensBreaker(t *testing.T) {
+    cfg := testResilienceConfig()
+    cfg.maxAttempts = 1
+    stub := &stubProvider{errs: []error{apiError(http.StatusBadGateway), apiError(http.StatusBadGateway), apiError(http.StatusBadGateway)}}
+    provider := NewResilientProvider(stub, cfg)
+
+    for i := 0; i < cfg.breakerThreshold; i++ {
+        provider.Complete(context.Background(), CompletionRequest{})
+    }
+    if _, err := provider.Complete(context.Background(), CompletionRequest{}); err != ErrLLMUnavailable {
+        t.Fatalf("got %v, want ErrLLMUnavailable", err)
+    }
+    if stub.calls != cfg.breakerThreshold {
+        t.Errorf("open breaker still called the provider: %d calls", stub.calls)
+    }
+}
+
+func TestResilientProviderIgnoresConsumerErrors(t *testing.T) {
+    cfg := testResilienceConfig()
+    stub := &stubProvider{deltas: []string{"a", "b"}}
+    provider := NewResilientProvider(stub, cfg)
+
+    // A client that went away is not the provider's fault
+    for i := 0; i < cfg.breakerThreshold+1; i++ {
+        _, err := provider.Stream(context.Background(), CompletionRequest{}, func(string) error {
+            return context.Canceled
+        })
+        if err != context.Canceled {
+            t.Fatalf("got %v, want the callback's error unwrapped", err)
+        }
+    }
+    if stub.calls != cfg.breakerThreshold+1 {
+        t.Errorf("consumer errors were retried: %d calls", stub.calls)
+    }
+    if state := provider.Breaker(); state.State != CircuitClosed || state.ConsecutiveFailures != 0 {
+        t.Errorf("consumer errors were counted by the breaker: %+v", state)
+    }
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "io"
+    "strings"
+)
+
+// StreamingProvider is implemented by providers that can return a completion
+// incrementally. onDelta is called with each piece of text as it arrives;
+// returning an error from it stops the stream. The returned response holds
+// the whole content.
+type StreamingProvider interface {
+    LLMProvider
+    Stream(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*CompletionResponse, error)
+}
+
+// errStreamDone ends readSSE early without reporting an error. fn must
+// return it for the provider's end-of-stream event.
+var errStreamDone = errors.New("stream done")
+
+// readSSE parses a text/event-stream body and calls fn for each event with
+// its event name (empty when not given) and data. Multi-line data is joined
+// with newlines, as the spec requires. A body that ends before fn returned
+// errStreamDone was cut off, and io.ErrUnexpectedEOF is returned so the
+// partial answer isn't taken for a complete one.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+    var event string
+    var data []string
+    dispatch := func() error {
+        if len(data) == 0 {
+            event = ""
+            return nil
+        }
+        err := fn(event, strings.Join(data, "\n"))
+        event, data = "", nil
+        return err
+    }
+
+    for scanner.Scan() {
+        line := strings.TrimSuffix(scanner.Text(), "\r")
+        if line == "" {
+            if err := dispatch(); err != nil {
+                if err == errStreamDone {
+                    return nil
+                }
+                return err
+            }
+            continue
+        }
+        if strings.HasPrefix(line, ":") {
+            continue
+        }
+
+        field, value, _ := strings.Cut(line, ":")
+        value = strings.TrimPrefix(value, " ")
+        switch field {
+        case "event":
+            event = value
+        case "data":
+            data = append(data, value)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+
+    if err := dispatch(); err != nil {
+        if err == errStreamDone {
+            return nil
+        }
+        return err
+    }
+    return io.ErrUnexpectedEOF
+}
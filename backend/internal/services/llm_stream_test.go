@@ -0,0 +1,148 @@
+package services
+
+import (
+    "errors"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type sseEvent struct {
+    event string
+    data  string
+}
+
+// collectSSE returns every event in body, which has no end-of-stream
+// marker and so is reported as cut off.
+func collectSSE(t *testing.T, body string) []sseEvent {
+    t.Helper()
+    var events []sseEvent
+    err := readSSE(strings.NewReader(body), func(event, data string) error {
+        events = append(events, sseEvent{event, data})
+        return nil
+    })
+    if err != io.ErrUnexpectedEOF {
+        t.Fatalf("readSSE returned %v, want io.ErrUnexpectedEOF", err)
+    }
+    return events
+}
+
+func TestReadSSE(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        want []sseEvent
+    }{
+        {
+            name: "data only",
+            body: "data: one\n\ndata: two\n\n",
+            want: []sseEvent{{"", "one"}, {"", "two"}},
+        },
+        {
+            name: "named events",
+            body: "event: message_start\ndata: {}\n\nevent: content_block_delta\ndata: {\"x\":1}\n\n",
+            want: []sseEvent{{"message_start", "{}"}, {"content_block_delta", `{"x":1}`}},
+        },
+        {
+            name: "multi-line data is joined with newlines",
+            body: "data: first\ndata: second\n\n",
+            want: []sseEvent{{"", "first\nsecond"}},
+        },
+        {
+            name: "comments and unknown fields are ignored",
+            body: ": keep-alive\nid: 7\nretry: 1000\ndata: hello\n\n",
+            want: []sseEvent{{"", "hello"}},
+        },
+        {
+            name: "CRLF line endings",
+            body: "event: ping\r\ndata: pong\r\n\r\n",
+            want: []sseEvent{{"ping", "pong"}},
+        },
+        {
+            name: "only one leading space is stripped",
+            body: "data:  indented\ndata:tight\n\n",
+            want: []sseEvent{{"", " indented\ntight"}},
+        },
+        {
+            name: "final event without trailing blank line",
+            body: "data: one\n\ndata: last",
+            want: []sseEvent{{"", "one"}, {"", "last"}},
+        },
+        {
+            name: "event without data is dropped",
+            body: "event: empty\n\ndata: kept\n\n",
+            want: []sseEvent{{"", "kept"}},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := collectSSE(t, tt.body)
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestReadSSEStopsOnStreamDone(t *testing.T) {
+    var seen []string
+    err := readSSE(strings.NewReader("data: a\n\ndata: [DONE]\n\ndata: b\n\n"), func(event, data string) error {
+        if data == "[DONE]" {
+            return errStreamDone
+        }
+        seen = append(seen, data)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("errStreamDone should end the stream without error, got %v", err)
+    }
+    if !reflect.DeepEqual(seen, []string{"a"}) {
+        t.Errorf("events after [DONE] were delivered: %q", seen)
+    }
+}
+
+func TestReadSSEStreamDoneInFinalEvent(t *testing.T) {
+    err := readSSE(strings.NewReader("data: a\n\ndata: [DONE]"), func(event, data string) error {
+        if data == "[DONE]" {
+            return errStreamDone
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("got %v, want nil", err)
+    }
+}
+
+func TestReadSSEReportsTruncatedStream(t *testing.T) {
+    var seen []string
+    err := readSSE(strings.NewReader("data: a\n\ndata: b\n\n"), func(event, data string) error {
+        if data == "[DONE]" {
+            return errStreamDone
+        }
+        seen = append(seen, data)
+        return nil
+    })
+    if err != io.ErrUnexpectedEOF {
+        t.Fatalf("stream without [DONE] returned %v, want io.ErrUnexpectedEOF", err)
+    }
+    if !reflect.DeepEqual(seen, []string{"a", "b"}) {
+        t.Errorf("events before the cut were not delivered: %q", seen)
+    }
+}
+
+func TestReadSSEReturnsCallbackError(t *testing.T) {
+    boom := errors.New("boom")
+    calls := 0
+    err := readSSE(strings.NewReader("data: a\n\ndata: b\n\n"), func(event, data string) error {
+        calls++
+        return boom
+    })
+    if err != boom {
+        t.Fatalf("got error %v, want %v", err, boom)
+    }
+    if calls != 1 {
+        t.Errorf("callback called %d times after failing, want 1", calls)
+    }
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+    "context"
+    "math"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    loginAttemptCollection = "login_attempts"
+
+    // Failures below this count are let through without any delay
+    loginFreeFailures = 3
+    loginMaxDelay     = 30 * time.Second
+)
+
+// LoginBlock describes why a login attempt is being refused before the
+// password is even checked.
+type LoginBlock struct {
+    Locked     bool
+    RetryAfter time.Duration
+}
+
+type loginGuardConfig struct {
+    maxAccountFailures int
+    maxIPFailures      int
+    lockoutDuration    time.Duration
+    failureWindow      time.Duration
+}
+
+func loadLoginGuardConfig() loginGuardConfig {
+    return loginGuardConfig{
+        maxAccountFailures: envInt("LOGIN_MAX_FAILURES", 10),
+        maxIPFailures:      envInt("LOGIN_MAX_IP_FAILURES", 50),
+        lockoutDuration:    envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+        failureWindow:      envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+    }
+}
+
+func accountKey(email string) string {
+    return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+    return "ip:" + ip
+}
+
+// CheckLogin reports whether email or ip is currently locked out or still
+// inside the back-off delay from its last failure. A nil result means the
+// attempt may proceed.
+func CheckLogin(ctx context.Context, email, ip string) (*LoginBlock, error) {
+    cursor, err := database.GetCollection(loginAttemptCollection).Find(ctx, bson.M{
+        "key": bson.M{"$in": []string{accountKey(email), ipKey(ip)}},
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    var attempts []models.LoginAttempt
+    if err := cursor.All(ctx, &attempts); err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    var block *LoginBlock
+    for _, attempt := range attempts {
+        if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+            return &LoginBlock{Locked: true, RetryAfter: attempt.LockedUntil.Sub(now)}, nil
+        }
+        if attempt.NextAllowedAt != nil && attempt.NextAllowedAt.After(now) {
+            wait := attempt.NextAllowedAt.Sub(now)
+            if block == nil || wait > block.RetryAfter {
+                block = &LoginBlock{RetryAfter: wait}
+            }
+        }
+    }
+    return block, nil
+}
+
+// RecordLoginFailure counts a failed attempt against both the account and
+// the client address. It returns true when this failure is the one that
+// locked the account, so the caller can send an unlock email exactly once.
+func RecordLoginFailure(ctx context.Context, email, ip string) (bool, error) {
+    cfg := loadLoginGuardConfig()
+
+    accountLocked, err := recordFailure(ctx, accountKey(email), cfg.maxAccountFailures, cfg)
+    if err != nil {
+        return false, err
+    }
+    if accountLocked {
+        RecordAudit(ctx, models.AuditLog{
+            Action:  models.AuditActionAccountLocked,
+            IP:      ip,
+            Details: map[string]interface{}{"email": strings.ToLower(email), "until": time.Now().Add(cfg.lockoutDuration)},
+        })
+    }
+
+    ipLocked, err := recordFailure(ctx, ipKey(ip), cfg.maxIPFailures, cfg)
+    if err != nil {
+        return accountLocked, err
+    }
+    if ipLocked {
+        RecordAudit(ctx, models.AuditLog{
+            Action:  models.AuditActionIPBlocked,
+            IP:      ip,
+            Details: map[string]interface{}{"until": time.Now().Add(cfg.lockoutDuration)},
+        })
+    }
+
+    return accountLocked, nil
+}
+
+func recordFailure(ctx context.Context, key string, maxFailures int, cfg loginGuardConfig) (bool, error) {
+    collection := database.GetCollection(loginAttemptCollection)
+    now := time.Now()
+    windowStart := now.Add(-cfg.failureWindow)
+
+    // Failures older than the window don't count, so the counter restarts
+    // instead of growing forever for occasional typos.
+    update := mongo.Pipeline{
+        {{Key: "$set", Value: bson.M{
+            "key": key,
+            "failures": bson.M{"$cond": bson.A{
+                bson.M{"$lt": bson.A{"$last_failure_at", windowStart}},
+                1,
+                bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+            }},
+            "last_failure_at": now,
+        }}},
+    }
+    opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+    // Two first failures for a key can race to insert it. The unique index
+    // rejects the loser, whose retry then updates the winner's document.
+    var attempt models.LoginAttempt
+    err := collection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&attempt)
+    if mongo.IsDuplicateKeyError(err) {
+        err = collection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&attempt)
+    }
+    if err != nil {
+        return false, err
+    }
+
+    set := bson.M{}
+    lockedNow := attempt.Failures == maxFailures
+    if attempt.Failures >= maxFailures {
+        set["locked_until"] = now.Add(cfg.lockoutDuration)
+    }
+    if attempt.Failures >= loginFreeFailures {
+        set["next_allowed_at"] = now.Add(loginDelay(attempt.Failures))
+    }
+    if len(set) > 0 {
+        if _, err := collection.UpdateOne(ctx, bson.M{"_id": attempt.ID}, bson.M{"$set": set}); err != nil {
+            return false, err
+        }
+    }
+
+    return lockedNow, nil
+}
+
+// loginDelay doubles the wait for every failure past the free ones:
+// 1s, 2s, 4s ... capped at loginMaxDelay.
+func loginDelay(failures int) time.Duration {
+    exp := failures - loginFreeFailures
+    if exp > 10 {
+        exp = 10
+    }
+    delay := time.Duration(math.Pow(2, float64(exp))) * time.Second
+    if delay > loginMaxDelay {
+        delay = loginMaxDelay
+    }
+    return delay
+}
+
+// RecordLoginSuccess clears the account's failure history. The address
+// history is left alone so one valid login can't reset a spraying attack.
+func RecordLoginSuccess(ctx context.Context, email string) error {
+    _, err := database.GetCollection(loginAttemptCollection).DeleteOne(ctx, bson.M{"key": accountKey(email)})
+    return err
+}
+
+func UnlockAccount(ctx context.Context, email string) error {
+    return RecordLoginSuccess(ctx, email)
+}
+
+func envInt(name string, fallback int) int {
+    if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+        return v
+    }
+    return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+    if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+        return v
+    }
+    return fallback
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+    "context"
+    "sync"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+func TestLoginDelay(t *testing.T) {
+    tests := []struct {
+        failures int
+        want     time.Duration
+    }{
+        {3, time.Second},
+        {4, 2 * time.Second},
+        {7, 16 * time.Second},
+        {8, loginMaxDelay},
+        {100, loginMaxDelay},
+    }
+    for _, tt := range tests {
+        if got := loginDelay(tt.failures); got != tt.want {
+            t.Errorf("loginDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+        }
+    }
+}
+
+func TestLoginAttemptKeys(t *testing.T) {
+    if accountKey(" Sam@Example.COM ") != accountKey("sam@example.com") {
+        t.Error("account keys should ignore case and surrounding spaces")
+    }
+    if accountKey("10.0.0.1") == ipKey("10.0.0.1") {
+        t.Error("account and address keys must not collide")
+    }
+}
+
+func TestLoadLoginGuardConfig(t *testing.T) {
+    t.Setenv("LOGIN_MAX_FAILURES", "5")
+    t.Setenv("LOGIN_MAX_IP_FAILURES", "0")
+    t.Setenv("LOGIN_LOCKOUT_DURATION", "1h")
+    t.Setenv("LOGIN_FAILURE_WINDOW", "soon")
+
+    cfg := loadLoginGuardConfig()
+    want := loginGuardConfig{
+        maxAccountFailures: 5,
+        maxIPFailures:      50,
+        lockoutDuration:    time.Hour,
+        failureWindow:      15 * time.Minute,
+    }
+    if cfg != want {
+        t.Errorf("got %+v, want %+v", cfg, want)
+    }
+}
+
+func TestRecordLoginFailureLocksAccount(t *testing.T) {
+    useTestDatabase(t)
+    useUniqueLoginAttemptKeys(t)
+    t.Setenv("LOGIN_MAX_FAILURES", "4")
+    ctx := context.Background()
+
+    for i := 1; i <= 4; i++ {
+        locked, err := RecordLoginFailure(ctx, "sam@example.com", "10.0.0.1")
+        if err != nil {
+            t.Fatalf("failure %d: %v", i, err)
+        }
+        if locked != (i == 4) {
+            t.Errorf("failure %d: locked = %v", i, locked)
+        }
+    }
+
+    block, err := CheckLogin(ctx, "SAM@example.com", "10.0.0.2")
+    if err != nil {
+        t.Fatalf("checking login: %v", err)
+    }
+    if block == nil || !block.Locked {
+        t.Fatalf("account should be locked, got %+v", block)
+    }
+
+    if err := UnlockAccount(ctx, "sam@example.com"); err != nil {
+        t.Fatalf("unlocking: %v", err)
+    }
+    if block, _ := CheckLogin(ctx, "sam@example.com", "10.0.0.2"); block != nil {
+        t.Errorf("account should be unlocked, got %+v", block)
+    }
+}
+
+// Concurrent first failures used to upsert one document each and split the
+// count between them.
+func TestRecordLoginFailureConcurrently(t *testing.T) {
+    useTestDatabase(t)
+    useUniqueLoginAttemptKeys(t)
+    ctx := context.Background()
+
+    const attempts = 20
+    var wg sync.WaitGroup
+    errs := make(chan error, attempts)
+    for i := 0; i < attempts; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if _, err := RecordLoginFailure(ctx, "sam@example.com", "10.0.0.1"); err != nil {
+                errs <- err
+            }
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Errorf("recording failure: %v", err)
+    }
+
+    var stored []models.LoginAttempt
+    cursor, err := database.GetCollection(loginAttemptCollection).Find(ctx, bson.M{"key": accountKey("sam@example.com")})
+    if err != nil {
+        t.Fatalf("loading attempts: %v", err)
+    }
+    if err := cursor.All(ctx, &stored); err != nil {
+        t.Fatalf("decoding attempts: %v", err)
+    }
+    if len(stored) != 1 || stored[0].Failures != attempts {
+        t.Errorf("want one document with %d failures, got %+v", attempts, stored)
+    }
+}
+
+// useUniqueLoginAttemptKeys creates the index migration 14 adds.
+func useUniqueLoginAttemptKeys(t *testing.T) {
+    t.Helper()
+    _, err := database.GetCollection(loginAttemptCollection).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+        Keys:    bson.D{{Key: "key", Value: 1}},
+        Options: options.Index().SetName("key_1").SetUnique(true),
+    })
+    if err != nil {
+        t.Fatalf("creating index: %v", err)
+    }
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/tls"
+    "encoding/hex"
+    "fmt"
+    htmltemplate "html/template"
+    "log"
+    "mime"
+    "net"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    texttemplate "text/template"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    outboxCollection   = "mail_outbox"
+    outboxPollInterval = 5 * time.Second
+    outboxLockDuration = time.Minute
+    outboxMaxAttempts  = 5
+
+    // A whole SMTP conversation must finish well within the outbox lock, or
+    // another replica could claim and send the same message again
+    smtpTimeout = 30 * time.Second
+)
+
+type MailBackend interface {
+    Send(from string, msg models.MailMessage) error
+}
+
+type MailService struct {
+    backend MailBackend
+    from    string
+}
+
+var Mailer *MailService
+
+func NewMailService(backend MailBackend, from string) (*MailService, error) {
+    if backend == nil {
+        return nil, fmt.Errorf("mail backend is not set")
+    }
+    if from == "" {
+        return nil, fmt.Errorf("mail sender address is not set")
+    }
+    return &MailService{
+        backend: backend,
+        from:    from,
+    }, nil
+}
+
+// InitMailer configures the global Mailer from MAIL_BACKEND ("smtp", "file"
+// or "memory"). Development defaults to writing messages to MAIL_FILE_DIR.
+func InitMailer() {
+    from := os.Getenv("MAIL_FROM")
+    if from == "" {
+        from = "TaskAI <no-reply@localhost>"
+    }
+
+    var backend MailBackend
+    switch kind := os.Getenv("MAIL_BACKEND"); kind {
+    case "smtp":
+        host := os.Getenv("SMTP_HOST")
+        if host == "" {
+            log.Fatal("SMTP_HOST not set in environment")
+        }
+        port := os.Getenv("SMTP_PORT")
+        if port == "" {
+            port = "587"
+        }
+        backend = NewSMTPMailBackend(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+    case "memory":
+        backend = NewMemoryMailBackend()
+    case "", "file":
+        dir := os.Getenv("MAIL_FILE_DIR")
+        if dir == "" {
+            dir = "tmp/mail"
+        }
+        backend = NewFileMailBackend(dir)
+    default:
+        log.Fatalf("Unknown MAIL_BACKEND %q", kind)
+    }
+
+    mailer, err := NewMailService(backend, from)
+    if err != nil {
+        log.Fatal("Failed to initialize mailer:", err)
+    }
+    Mailer = mailer
+
+    log.Printf("Mailer initialized with %T", backend)
+}
+
+func RenderMail(templateName string, data interface{}) (models.MailMessage, error) {
+    tmpl, ok := mailTemplates[templateName]
+    if !ok {
+        return models.MailMessage{}, fmt.Errorf("unknown mail template %q", templateName)
+    }
+
+    subject, err := renderText(templateName+".subject", tmpl.Subject, data)
+    if err != nil {
+        return models.MailMessage{}, err
+    }
+    text, err := renderText(templateName+".text", tmpl.Text, data)
+    if err != nil {
+        return models.MailMessage{}, err
+    }
+
+    var html bytes.Buffer
+    t, err := htmltemplate.New(templateName + ".html").Option("missingkey=error").Parse(tmpl.HTML)
+    if err != nil {
+        return models.MailMessage{}, fmt.Errorf("error parsing template %s: %v", templateName, err)
+    }
+    if err := t.Execute(&html, data); err != nil {
+        return models.MailMessage{}, fmt.Errorf("error rendering template %s: %v", templateName, err)
+    }
+
+    return models.MailMessage{
+        Subject: strings.TrimSpace(subject),
+        Text:    text,
+        HTML:    html.String(),
+    }, nil
+}
+
+func renderText(name, source string, data interface{}) (string, error) {
+    var out bytes.Buffer
+    t, err := texttemplate.New(name).Option("missingkey=error").Parse(source)
+    if err != nil {
+        return "", fmt.Errorf("error parsing template %s: %v", name, err)
+    }
+    if err := t.Execute(&out, data); err != nil {
+        return "", fmt.Errorf("error rendering template %s: %v", name, err)
+    }
+    return out.String(), nil
+}
+
+// Enqueue renders a template and stores it in the outbox for the background
+// sender. Passing a mongo.SessionContext writes the message inside the
+// caller's transaction.
+func (m *MailService) Enqueue(ctx context.Context, to string, templateName string, data interface{}) error {
+    msg, err := RenderMail(templateName, data)
+    if err != nil {
+        return err
+    }
+    msg.To = []string{to}
+
+    now := time.Now()
+    _, err = database.GetCollection(outboxCollection).InsertOne(ctx, models.OutboxMessage{
+        Template:      templateName,
+        Message:       msg,
+        Status:        models.OutboxStatusPending,
+        NextAttemptAt: now,
+        CreatedAt:     now,
+    })
+    if err != nil {
+        return fmt.Errorf("error queueing mail: %v", err)
+    }
+    return nil
+}
+
+// RunOutbox delivers queued messages until the process exits. Messages left
+// in "sending" by a crashed worker are picked up again once their lock expires.
+func (m *MailService) RunOutbox() {
+    ticker := time.NewTicker(outboxPollInterval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        for {
+            msg, err := m.claimNext()
+            if err != nil {
+                if err != mongo.ErrNoDocuments {
+                    log.Printf("Error claiming outbox message: %v", err)
+                }
+                break
+            }
+            m.deliver(msg)
+        }
+    }
+}
+
+func (m *MailService) claimNext() (*models.OutboxMessage, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    now := time.Now()
+    filter := bson.M{
+        "$or": []bson.M{
+            {"status": models.OutboxStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+            {"status": models.OutboxStatusSending, "locked_until": bson.M{"$lt": now}},
+        },
+    }
+    update := bson.M{
+        "$set": bson.M{"status": models.OutboxStatusSending, "locked_until": now.Add(outboxLockDuration)},
+        "$inc": bson.M{"attempts": 1},
+    }
+    opts := options.FindOneAndUpdate().
+        SetSort(bson.M{"next_attempt_at": 1}).
+        SetReturnDocument(options.After)
+
+    var msg models.OutboxMessage
+    err := database.GetCollection(outboxCollection).FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+    if err != nil {
+        return nil, err
+    }
+    return &msg, nil
+}
+
+func (m *MailService) deliver(msg *models.OutboxMessage) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    collection := database.GetCollection(outboxCollection)
+    sendErr := m.backend.Send(m.from, msg.Message)
+
+    var update bson.M
+    switch {
+    case sendErr == nil:
+        update = bson.M{
+            "$set":   bson.M{"status": models.OutboxStatusSent, "sent_at": time.Now()},
+            "$unset": bson.M{"locked_until": "", "last_error": ""},
+        }
+    case msg.Attempts >= outboxMaxAttempts:
+        log.Printf("Giving up on mail %s after %d attempts: %v", msg.ID.Hex(), msg.Attempts, sendErr)
+        update = bson.M{
+            "$set":   bson.M{"status": models.OutboxStatusFailed, "last_error": sendErr.Error()},
+            "$unset": bson.M{"locked_until": ""},
+        }
+    default:
+        log.Printf("Error sending mail %s (attempt %d): %v", msg.ID.Hex(), msg.Attempts, sendErr)
+        backoff := time.Duration(msg.Attempts*msg.Attempts) * 30 * time.Second
+        update = bson.M{
+            "$set": bson.M{
+                "status":          models.OutboxStatusPending,
+                "last_error":      sendErr.Error(),
+                "next_attempt_at": time.Now().Add(backoff),
+            },
+            "$unset": bson.M{"locked_until": ""},
+        }
+    }
+
+    if _, err := collection.UpdateOne(ctx, bson.M{"_id": msg.ID}, update); err != nil {
+        log.Printf("Error updating outbox message %s: %v", msg.ID.Hex(), err)
+    }
+}
+
+type SMTPMailBackend struct {
+    host     string
+    port     string
+    username string
+    password string
+}
+
+func NewSMTPMailBackend(host, port, username, password string) *SMTPMailBackend {
+    return &SMTPMailBackend{
+        host:     host,
+        port:     port,
+        username: username,
+        password: password,
+    }
+}
+
+func (b *SMTPMailBackend) Send(from string, msg models.MailMessage) error {
+    var auth smtp.Auth
+    if b.username != "" {
+        auth = smtp.PlainAuth("", b.username, b.password, b.host)
+    }
+
+    body, err := buildMIMEMessage(from, msg)
+    if err != nil {
+        return err
+    }
+
+    envelopeFrom := from
+    if i := strings.LastIndex(from, "<"); i >= 0 {
+        envelopeFrom = strings.TrimSuffix(from[i+1:], ">")
+    }
+
+    return b.sendMail(auth, envelopeFrom, msg.To, body)
+}
+
+// sendMail is smtp.SendMail with a deadline covering the whole conversation,
+// since a stalled server would otherwise hold the outbox lock indefinitely.
+func (b *SMTPMailBackend) sendMail(auth smtp.Auth, from string, to []string, body []byte) error {
+    conn, err := net.DialTimeout("tcp", net.JoinHostPort(b.host, b.port), smtpTimeout)
+    if err != nil {
+        return err
+    }
+    if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+        conn.Close()
+        return err
+    }
+
+    client, err := smtp.NewClient(conn, b.host)
+    if err != nil {
+        conn.Close()
+        return err
+    }
+    defer client.Close()
+
+    if ok, _ := client.Extension("STARTTLS"); ok {
+        if err := client.StartTLS(&tls.Config{ServerName: b.host}); err != nil {
+            return err
+        }
+    }
+    if auth != nil {
+        if ok, _ := client.Extension("AUTH"); !ok {
+            return fmt.Errorf("smtp server doesn't support AUTH")
+        }
+        if err := client.Auth(auth); err != nil {
+            return err
+        }
+    }
+
+    if err := client.Mail(from); err != nil {
+        return err
+    }
+    for _, addr := range to {
+        if err := client.Rcpt(addr); err != nil {
+            return err
+        }
+    }
+    w, err := client.Data()
+    if err != nil {
+        return err
+    }
+    if _, err := w.Write(body); err != nil {
+        return err
+    }
+    if err := w.Close(); err != nil {
+        return err
+    }
+    return client.Quit()
+}
+
+// FileMailBackend writes each message as an .eml file, which is handy for
+// local development where no SMTP server is running.
+type FileMailBackend struct {
+    dir string
+}
+
+func NewFileMailBackend(dir string) *FileMailBackend {
+    return &FileMailBackend{dir: dir}
+}
+
+func (b *FileMailBackend) Send(from string, msg models.MailMessage) error {
+    if err := os.MkdirAll(b.dir, 0o755); err != nil {
+        return fmt.Errorf("error creating mail directory: %v", err)
+    }
+
+    body, err := buildMIMEMessage(from, msg)
+    if err != nil {
+        return err
+    }
+
+    name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), randomHex(4))
+    return os.WriteFile(filepath.Join(b.dir, name), body, 0o644)
+}
+
+type MemoryMailBackend struct {
+    mutex    sync.Mutex
+    messages []models.MailMessage
+}
+
+func NewMemoryMailBackend() *MemoryMailBackend {
+    return &MemoryMailBackend{}
+}
+
+func (b *MemoryMailBackend) Send(from string, msg models.MailMessage) error {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    b.messages = append(b.messages, msg)
+    return nil
+}
+
+func (b *MemoryMailBackend) Messages() []models.MailMessage {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    return append([]models.MailMessage(nil), b.messages...)
+}
+
+func (b *MemoryMailBackend) Reset() {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    b.messages = nil
+}
+
+func buildMIMEMessage(from string, msg models.MailMessage) ([]byte, error) {
+    if len(msg.To) == 0 {
+        return nil, fmt.Errorf("mail has no recipients")
+    }
+
+    boundary := "taskai-" + randomHex(12)
+
+    var buf bytes.Buffer
+    fmt.Fprintf(&buf, "From: %s\r\n", from)
+    fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+    fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+    fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    buf.WriteString("MIME-Version: 1.0\r\n")
+    fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+    fmt.Fprintf(&buf, "--%s\r\n", boundary)
+    buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+    buf.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+    buf.WriteString("\r\n")
+
+    fmt.Fprintf(&buf, "--%s\r\n", boundary)
+    buf.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+    buf.WriteString(strings.ReplaceAll(msg.HTML, "\n", "\r\n"))
+    buf.WriteString("\r\n")
+
+    fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+    return buf.Bytes(), nil
+}
+
+func randomHex(n int) string {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return fmt.Sprintf("%x", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(b)
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+    "bufio"
+    "context"
+    "net"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "go.mongodb.org/mongo-driver/bson"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+func TestRenderMail(t *testing.T) {
+    msg, err := RenderMail("task_reminder", map[string]string{
+        "Name":      "Sam",
+        "TaskTitle": "Ship <v2>",
+        "DueDate":   "tomorrow",
+        "TaskURL":   "http://app.test/tasks/1",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if msg.Subject != "Reminder: Ship <v2> is due tomorrow" {
+        t.Errorf("subject = %q", msg.Subject)
+    }
+    if !strings.Contains(msg.Text, `"Ship <v2>"`) {
+        t.Errorf("plain text body should not be escaped: %q", msg.Text)
+    }
+    if !strings.Contains(msg.HTML, "Ship &lt;v2&gt;") {
+        t.Errorf("HTML body should be escaped: %q", msg.HTML)
+    }
+}
+
+func TestRenderMailErrors(t *testing.T) {
+    if _, err := RenderMail("no_such_template", nil); err == nil {
+        t.Error("unknown template should fail")
+    }
+    // A missing field is a bug in the caller, not something to send
+    if _, err := RenderMail("task_reminder", map[string]string{"Name": "Sam"}); err == nil {
+        t.Error("missing template data should fail")
+    }
+}
+
+func TestBuildMIMEMessage(t *testing.T) {
+    body, err := buildMIMEMessage("TaskAI <no-reply@example.com>", models.MailMessage{
+        To:      []string{"a@example.com", "b@example.com"},
+        Subject: "Café",
+        Text:    "line one\nline two",
+        HTML:    "<p>hi</p>",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    message := string(body)
+    for _, want := range []string{
+        "From: TaskAI <no-reply@example.com>\r\n",
+        "To: a@example.com, b@example.com\r\n",
+        "Subject: =?utf-8?q?Caf=C3=A9?=\r\n",
+        "Content-Type: text/plain; charset=utf-8\r\n\r\nline one\r\nline two\r\n",
+        "Content-Type: text/html; charset=utf-8\r\n\r\n<p>hi</p>\r\n",
+    } {
+        if !strings.Contains(message, want) {
+            t.Errorf("message is missing %q:\n%s", want, message)
+        }
+    }
+
+    if _, err := buildMIMEMessage("no-reply@example.com", models.MailMessage{Subject: "x"}); err == nil {
+        t.Error("a message without recipients should fail")
+    }
+}
+
+func TestMemoryMailBackend(t *testing.T) {
+    backend := NewMemoryMailBackend()
+    backend.Send("from@example.com", models.MailMessage{To: []string{"a@example.com"}, Subject: "one"})
+    backend.Send("from@example.com", models.MailMessage{To: []string{"b@example.com"}, Subject: "two"})
+
+    messages := backend.Messages()
+    if len(messages) != 2 || messages[0].Subject != "one" || messages[1].Subject != "two" {
+        t.Fatalf("got %+v", messages)
+    }
+
+    backend.Reset()
+    if len(backend.Messages()) != 0 {
+        t.Error("Reset should clear captured messages")
+    }
+    if len(messages) != 2 {
+        t.Error("Messages should return a copy")
+    }
+}
+
+func TestFileMailBackend(t *testing.T) {
+    dir := filepath.Join(t.TempDir(), "mail")
+    backend := NewFileMailBackend(dir)
+    if err := backend.Send("from@example.com", models.MailMessage{To: []string{"a@example.com"}, Subject: "hello", Text: "hi"}); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+    if err != nil || len(files) != 1 {
+        t.Fatalf("expected one .eml file, got %v (%v)", files, err)
+    }
+    body, _ := os.ReadFile(files[0])
+    if !strings.Contains(string(body), "Subject: hello\r\n") {
+        t.Errorf("unexpected file contents:\n%s", body)
+    }
+}
+
+// fakeSMTPServer accepts one connection, answers just enough of SMTP for
+// net/smtp and sends the envelope and message down the returned channel.
+func fakeSMTPServer(t *testing.T) (string, string, <-chan []string) {
+    t.Helper()
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listening: %v", err)
+    }
+    t.Cleanup(func() { listener.Close() })
+
+    received := make(chan []string, 1)
+    go func() {
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        var lines []string
+        reader := bufio.NewReader(conn)
+        reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+        reply("220 localhost ESMTP")
+        inData := false
+        for {
+            line, err := reader.ReadString('\n')
+            if err != nil {
+                return
+            }
+            line = strings.TrimRight(line, "\r\n")
+            if inData {
+                if line == "." {
+                    inData = false
+                    reply("250 OK")
+                    continue
+                }
+                lines = append(lines, line)
+                continue
+            }
+
+            lines = append(lines, line)
+            switch {
+            case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+                reply("250 localhost")
+            case line == "DATA":
+                inData = true
+                reply("354 Go ahead")
+            case line == "QUIT":
+                reply("221 Bye")
+                received <- lines
+                return
+            default:
+                reply("250 OK")
+            }
+        }
+    }()
+
+    host, port, _ := net.SplitHostPort(listener.Addr().String())
+    return host, port, received
+}
+
+func TestSMTPMailBackend(t *testing.T) {
+    host, port, received := fakeSMTPServer(t)
+    backend := NewSMTPMailBackend(host, port, "", "")
+
+    err := backend.Send("TaskAI <no-reply@example.com>", models.MailMessage{
+        To:      []string{"a@example.com"},
+        Subject: "hello",
+        Text:    "hi",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    conversation := strings.Join(<-received, "\n")
+    for _, want := range []string{
+        "MAIL FROM:<no-reply@example.com>",
+        "RCPT TO:<a@example.com>",
+        "Subject: hello",
+    } {
+        if !strings.Contains(conversation, want) {
+            t.Errorf("conversation is missing %q:\n%s", want, conversation)
+        }
+    }
+}
+
+func TestNewMailServiceRequiresBackendAndSender(t *testing.T) {
+    if _, err := NewMailService(nil, "from@example.com"); err == nil {
+        t.Error("missing backend should fail")
+    }
+    if _, err := NewMailService(NewMemoryMailBackend(), ""); err == nil {
+        t.Error("missing sender should fail")
+    }
+}
+
+func TestMailOutboxDelivers(t *testing.T) {
+    useTestDatabase(t)
+    backend := NewMemoryMailBackend()
+    mailer, _ := NewMailService(backend, "TaskAI <no-reply@example.com>")
+    ctx := context.Background()
+
+    err := mailer.Enqueue(ctx, "a@example.com", "task_reminder", map[string]string{
+        "Name": "Sam", "TaskTitle": "Ship", "DueDate": "today", "TaskURL": "http://app.test",
+    })
+    if err != nil {
+        t.Fatalf("enqueue: %v", err)
+    }
+
+    msg, err := mailer.claimNext()
+    if err != nil {
+        t.Fatalf("claim: %v", err)
+    }
+    if _, err := mailer.claimNext(); err == nil {
+        t.Error("a claimed message was handed out twice")
+    }
+    mailer.deliver(msg)
+
+    sent := backend.Messages()
+    if len(sent) != 1 || sent[0].To[0] != "a@example.com" || sent[0].Subject != "Reminder: Ship is due today" {
+        t.Fatalf("got %+v", sent)
+    }
+    var stored models.OutboxMessage
+    database.GetCollection(outboxCollection).FindOne(ctx, bson.M{"_id": msg.ID}).Decode(&stored)
+    if stored.Status != models.OutboxStatusSent {
+        t.Errorf("status = %q, want sent", stored.Status)
+    }
+}
@@ -0,0 +1,115 @@
+package services
+
+type mailTemplate struct {
+    Subject string
+    Text    string
+    HTML    string
+}
+
+// Templates are rendered with text/template for the subject and plain text
+// body and html/template for the HTML body, so data is escaped in the latter.
+var mailTemplates = map[string]mailTemplate{
+    "invite": {
+        Subject: `{{.InviterName}} invited you to TaskAI`,
+        Text: `Hi,
+
+{{.InviterName}} has invited you to collaborate on TaskAI.
+
+Accept the invitation: {{.InviteURL}}
+
+If you weren't expecting this email you can ignore it.`,
+        HTML: `<p>Hi,</p>
+<p><strong>{{.InviterName}}</strong> has invited you to collaborate on TaskAI.</p>
+<p><a href="{{.InviteURL}}">Accept the invitation</a></p>
+<p>If you weren't expecting this email you can ignore it.</p>`,
+    },
+    "task_reminder": {
+        Subject: `Reminder: {{.TaskTitle}} is due {{.DueDate}}`,
+        Text: `Hi {{.Name}},
+
+This is a reminder that "{{.TaskTitle}}" is due {{.DueDate}}.
+
+Open the task: {{.TaskURL}}`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>This is a reminder that <strong>{{.TaskTitle}}</strong> is due {{.DueDate}}.</p>
+<p><a href="{{.TaskURL}}">Open the task</a></p>`,
+    },
+    "password_reset": {
+        Subject: `Reset your TaskAI password`,
+        Text: `Hi {{.Name}},
+
+We received a request to reset your password. Use the link below within {{.ExpiresIn}}:
+
+{{.ResetURL}}
+
+If you didn't ask for this you can ignore this email.`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>We received a request to reset your password. Use the link below within {{.ExpiresIn}}:</p>
+<p><a href="{{.ResetURL}}">Reset password</a></p>
+<p>If you didn't ask for this you can ignore this email.</p>`,
+    },
+    "email_verification": {
+        Subject: `Verify your TaskAI email address`,
+        Text: `Hi {{.Name}},
+
+Please confirm that {{.Email}} is your email address by opening the link below within {{.ExpiresIn}}:
+
+{{.VerifyURL}}`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>Please confirm that <strong>{{.Email}}</strong> is your email address by opening the link below within {{.ExpiresIn}}:</p>
+<p><a href="{{.VerifyURL}}">Verify email address</a></p>`,
+    },
+    "account_unlock": {
+        Subject: `Your TaskAI account has been locked`,
+        Text: `Hi {{.Name}},
+
+We locked your account after several failed login attempts. If this was you, unlock it within {{.ExpiresIn}} using the link below:
+
+{{.UnlockURL}}
+
+If it wasn't you, we recommend resetting your password.`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>We locked your account after several failed login attempts. If this was you, unlock it within {{.ExpiresIn}} using the link below:</p>
+<p><a href="{{.UnlockURL}}">Unlock account</a></p>
+<p>If it wasn't you, we recommend resetting your password.</p>`,
+    },
+    "email_change": {
+        Subject: `Confirm your new TaskAI email address`,
+        Text: `Hi {{.Name}},
+
+Please confirm that you want to use {{.Email}} for your TaskAI account by opening the link below within {{.ExpiresIn}}:
+
+{{.ConfirmURL}}
+
+Until then you can keep signing in with your current address.`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>Please confirm that you want to use <strong>{{.Email}}</strong> for your TaskAI account by opening the link below within {{.ExpiresIn}}:</p>
+<p><a href="{{.ConfirmURL}}">Confirm email address</a></p>
+<p>Until then you can keep signing in with your current address.</p>`,
+    },
+    "sso_link": {
+        Subject: `Confirm single sign-on for your TaskAI account`,
+        Text: `Hi {{.Name}},
+
+Someone signed in to TaskAI through single sign-on as {{.Email}}. To use single sign-on for your existing account, confirm within {{.ExpiresIn}}:
+
+{{.ConfirmURL}}
+
+If this wasn't you, ignore this email and your account stays unchanged.`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>Someone signed in to TaskAI through single sign-on as <strong>{{.Email}}</strong>. To use single sign-on for your existing account, confirm within {{.ExpiresIn}}:</p>
+<p><a href="{{.ConfirmURL}}">Link single sign-on</a></p>
+<p>If this wasn't you, ignore this email and your account stays unchanged.</p>`,
+    },
+    "email_changed": {
+        Subject: `Your TaskAI email address was changed`,
+        Text: `Hi {{.Name}},
+
+The email address on your TaskAI account was changed to {{.NewEmail}}.
+
+If you didn't make this change, contact support immediately.`,
+        HTML: `<p>Hi {{.Name}},</p>
+<p>The email address on your TaskAI account was changed to <strong>{{.NewEmail}}</strong>.</p>
+<p>If you didn't make this change, contact support immediately.</p>`,
+    },
+}
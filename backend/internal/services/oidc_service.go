@@ -0,0 +1,369 @@
+package services
+
+import (
+    "context"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+    "time"
+    "github.com/golang-jwt/jwt/v4"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    oidcStateCollection = "oidc_states"
+    OIDCStateTTL        = 10 * time.Minute
+)
+
+var ErrOIDCStateInvalid = errors.New("invalid or expired login state")
+
+type OIDCClaims struct {
+    Email         string `json:"email"`
+    EmailVerified bool   `json:"email_verified"`
+    Name          string `json:"name"`
+    Nonce         string `json:"nonce"`
+    jwt.RegisteredClaims
+}
+
+type oidcDiscovery struct {
+    Issuer                string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint         string `json:"token_endpoint"`
+    JWKSURI               string `json:"jwks_uri"`
+}
+
+type OIDCProvider struct {
+    issuer         string
+    clientID       string
+    clientSecret   string
+    redirectURL    string
+    allowedDomains []string
+    httpClient     *http.Client
+
+    mutex     sync.Mutex
+    discovery *oidcDiscovery
+    keys      map[string]*rsa.PublicKey
+}
+
+// OIDC is nil when single sign-on isn't configured.
+var OIDC *OIDCProvider
+
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL string, allowedDomains []string) (*OIDCProvider, error) {
+    if issuer == "" || clientID == "" || redirectURL == "" {
+        return nil, fmt.Errorf("OIDC issuer, client ID and redirect URL are required")
+    }
+    return &OIDCProvider{
+        issuer:         strings.TrimSuffix(issuer, "/"),
+        clientID:       clientID,
+        clientSecret:   clientSecret,
+        redirectURL:    redirectURL,
+        allowedDomains: allowedDomains,
+        httpClient:     &http.Client{Timeout: 10 * time.Second},
+    }, nil
+}
+
+// InitOIDC enables single sign-on when OIDC_ISSUER_URL is set. Discovery is
+// deferred to the first login so the API still starts if the provider is
+// briefly unreachable.
+func InitOIDC() {
+    issuer := os.Getenv("OIDC_ISSUER_URL")
+    if issuer == "" {
+        return
+    }
+
+    var domains []string
+    for _, domain := range strings.Split(os.Getenv("OIDC_ALLOWED_DOMAINS"), ",") {
+        if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+            domains = append(domains, domain)
+        }
+    }
+
+    provider, err := NewOIDCProvider(issuer, os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), os.Getenv("OIDC_REDIRECT_URL"), domains)
+    if err != nil {
+        log.Fatal("Failed to initialize OIDC:", err)
+    }
+    OIDC = provider
+
+    log.Printf("OIDC single sign-on enabled for issuer %s", issuer)
+}
+
+func (p *OIDCProvider) Issuer() string {
+    return p.issuer
+}
+
+// DomainAllowed reports whether accounts may be created automatically for
+// email, based on OIDC_ALLOWED_DOMAINS.
+func (p *OIDCProvider) DomainAllowed(email string) bool {
+    at := strings.LastIndex(email, "@")
+    if at < 0 {
+        return false
+    }
+    domain := strings.ToLower(email[at+1:])
+    for _, allowed := range p.allowedDomains {
+        if domain == allowed {
+            return true
+        }
+    }
+    return false
+}
+
+// SecureCookies reports whether cookies set during the login round trip
+// should be limited to HTTPS, based on the registered redirect URL.
+func (p *OIDCProvider) SecureCookies() bool {
+    return strings.HasPrefix(p.redirectURL, "https://")
+}
+
+// StartLogin stores fresh state, nonce and PKCE verifier values and returns
+// the provider URL to send the browser to along with the state, which the
+// caller binds to the browser.
+func (p *OIDCProvider) StartLogin(ctx context.Context) (string, string, error) {
+    discovery, err := p.getDiscovery(ctx)
+    if err != nil {
+        return "", "", err
+    }
+
+    state, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", "", err
+    }
+    nonce, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", "", err
+    }
+    verifier, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", "", err
+    }
+
+    now := time.Now()
+    _, err = database.GetCollection(oidcStateCollection).InsertOne(ctx, models.OIDCState{
+        ID:           primitive.NewObjectID(),
+        StateHash:    HashToken(state),
+        Nonce:        nonce,
+        CodeVerifier: verifier,
+        ExpiresAt:    now.Add(OIDCStateTTL),
+        CreatedAt:    now,
+    })
+    if err != nil {
+        return "", "", fmt.Errorf("error storing login state: %v", err)
+    }
+
+    challenge := sha256.Sum256([]byte(verifier))
+    params := url.Values{}
+    params.Set("response_type", "code")
+    params.Set("client_id", p.clientID)
+    params.Set("redirect_uri", p.redirectURL)
+    params.Set("scope", "openid email profile")
+    params.Set("state", state)
+    params.Set("nonce", nonce)
+    params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+    params.Set("code_challenge_method", "S256")
+
+    separator := "?"
+    if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+        separator = "&"
+    }
+    return discovery.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// CompleteLogin consumes the stored state, redeems code at the token
+// endpoint and returns the verified ID token claims.
+func (p *OIDCProvider) CompleteLogin(ctx context.Context, state, code string) (*OIDCClaims, error) {
+    var stored models.OIDCState
+    err := database.GetCollection(oidcStateCollection).FindOneAndDelete(ctx, bson.M{
+        "state_hash": HashToken(state),
+        "expires_at": bson.M{"$gt": time.Now()},
+    }).Decode(&stored)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrOIDCStateInvalid
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    discovery, err := p.getDiscovery(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    form := url.Values{}
+    form.Set("grant_type", "authorization_code")
+    form.Set("code", code)
+    form.Set("redirect_uri", p.redirectURL)
+    form.Set("client_id", p.clientID)
+    form.Set("code_verifier", stored.CodeVerifier)
+
+    req, err := http.NewRequestWithContext(ctx, "POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, fmt.Errorf("error creating token request: %v", err)
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+    if p.clientSecret != "" {
+        req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+    }
+
+    resp, err := p.httpClient.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("error calling token endpoint: %v", err)
+    }
+    defer resp.Body.Close()
+
+    var tokenResponse struct {
+        IDToken          string `json:"id_token"`
+        Error            string `json:"error"`
+        ErrorDescription string `json:"error_description"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+        return nil, fmt.Errorf("error decoding token response: %v", err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("token endpoint error: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+    }
+    if tokenResponse.IDToken == "" {
+        return nil, fmt.Errorf("token response has no id_token")
+    }
+
+    claims, err := p.verifyIDToken(ctx, tokenResponse.IDToken)
+    if err != nil {
+        return nil, err
+    }
+    if claims.Nonce != stored.Nonce {
+        return nil, fmt.Errorf("id_token nonce mismatch")
+    }
+    return claims, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw string) (*OIDCClaims, error) {
+    claims := &OIDCClaims{}
+    parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}))
+    _, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+        kid, _ := token.Header["kid"].(string)
+        return p.getKey(ctx, kid)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("invalid id_token: %v", err)
+    }
+
+    if claims.Issuer != p.issuer {
+        return nil, fmt.Errorf("id_token issuer mismatch")
+    }
+    if !claims.VerifyAudience(p.clientID, true) {
+        return nil, fmt.Errorf("id_token audience mismatch")
+    }
+    if claims.Subject == "" {
+        return nil, fmt.Errorf("id_token has no subject")
+    }
+    return claims, nil
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    if p.discovery != nil {
+        return p.discovery, nil
+    }
+
+    var discovery oidcDiscovery
+    if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+        return nil, fmt.Errorf("error fetching OIDC discovery document: %v", err)
+    }
+    if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+        return nil, fmt.Errorf("OIDC discovery issuer %q does not match %q", discovery.Issuer, p.issuer)
+    }
+
+    p.discovery = &discovery
+    return p.discovery, nil
+}
+
+// getKey returns the signing key for kid, refetching the provider's key set
+// once if the key is unknown since providers rotate keys without notice.
+func (p *OIDCProvider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+    p.mutex.Lock()
+    key, ok := p.keys[kid]
+    p.mutex.Unlock()
+    if ok {
+        return key, nil
+    }
+
+    discovery, err := p.getDiscovery(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var jwks struct {
+        Keys []struct {
+            Kid string `json:"kid"`
+            Kty string `json:"kty"`
+            Use string `json:"use"`
+            N   string `json:"n"`
+            E   string `json:"e"`
+        } `json:"keys"`
+    }
+    if err := p.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+        return nil, fmt.Errorf("error fetching OIDC signing keys: %v", err)
+    }
+
+    keys := make(map[string]*rsa.PublicKey)
+    for _, jwk := range jwks.Keys {
+        if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+            continue
+        }
+        n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+        if err != nil {
+            continue
+        }
+        e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+        if err != nil {
+            continue
+        }
+        keys[jwk.Kid] = &rsa.PublicKey{
+            N: new(big.Int).SetBytes(n),
+            E: int(new(big.Int).SetBytes(e).Int64()),
+        }
+    }
+
+    p.mutex.Lock()
+    p.keys = keys
+    p.mutex.Unlock()
+
+    key, ok = keys[kid]
+    if !ok {
+        return nil, fmt.Errorf("unknown signing key %q", kid)
+    }
+    return key, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+    req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := p.httpClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("status code %d from %s", resp.StatusCode, endpoint)
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
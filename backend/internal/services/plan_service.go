@@ -0,0 +1,261 @@
+package services
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    planCollection = "ai_plans"
+    // Open tasks beyond this many, soonest due first, are left out of the plan
+    maxPlanTasks = 100
+)
+
+const dailyPlanSystemPrompt = `You are a productivity assistant. Answer only with JSON that matches the daily_plan schema. Rank the tasks to work on today and the ones to do later this week, most important first, with a one-sentence rationale each. Consider due dates, priority, status and estimates; subtasks should be done before the task they belong to. Use each task_id at most once and only ids from the list. Leave out tasks that can wait until after this week.`
+
+var dailyPlanSchema = &JSONSchema{
+    Name:        "daily_plan",
+    Description: "Ranked plan of the user's tasks for today and this week",
+    Schema: map[string]interface{}{
+        "type":                 "object",
+        "additionalProperties": false,
+        "required":             []string{"summary", "today", "this_week"},
+        "properties": map[string]interface{}{
+            "summary":   map[string]interface{}{"type": "string"},
+            "today":     planItemsSchema,
+            "this_week": planItemsSchema,
+        },
+    },
+}
+
+var planItemsSchema = map[string]interface{}{
+    "type": "array",
+    "items": map[string]interface{}{
+        "type":                 "object",
+        "additionalProperties": false,
+        "required":             []string{"task_id", "rationale"},
+        "properties": map[string]interface{}{
+            "task_id":   map[string]interface{}{"type": "string"},
+            "rationale": map[string]interface{}{"type": "string"},
+        },
+    },
+}
+
+type dailyPlanReply struct {
+    Summary  string          `json:"summary"`
+    Today    []planItemReply `json:"today"`
+    ThisWeek []planItemReply `json:"this_week"`
+}
+
+type planItemReply struct {
+    TaskID    string `json:"task_id"`
+    Rationale string `json:"rationale"`
+}
+
+// GetDailyPlan returns the user's plan for today in loc. A plan is generated
+// at most once per day unless the user's open tasks change in the meantime
+// or refresh is set. The second result reports whether it came from the
+// cache.
+func GetDailyPlan(ctx context.Context, userID primitive.ObjectID, loc *time.Location, refresh bool) (*models.DailyPlan, bool, error) {
+    now := time.Now().In(loc)
+    date := now.Format("2006-01-02")
+
+    tasks, err := openTasksForPlan(ctx, userID)
+    if err != nil {
+        return nil, false, err
+    }
+    fingerprint := tasksFingerprint(tasks)
+
+    plans := database.GetCollection(planCollection)
+    if !refresh {
+        var cached models.DailyPlan
+        err := plans.FindOne(ctx, bson.M{"user_id": userID, "date": date}).Decode(&cached)
+        if err == nil && cached.TasksFingerprint == fingerprint {
+            fillPlanTitles(&cached, tasks)
+            return &cached, true, nil
+        }
+        if err != nil && err != mongo.ErrNoDocuments {
+            return nil, false, err
+        }
+    }
+
+    plan := &models.DailyPlan{
+        UserID:           userID,
+        Date:             date,
+        TasksFingerprint: fingerprint,
+        Today:            []models.PlanItem{},
+        ThisWeek:         []models.PlanItem{},
+        GeneratedAt:      time.Now(),
+    }
+    if len(tasks) == 0 {
+        plan.Summary = "You have no open tasks."
+        return plan, false, nil
+    }
+    if AI == nil {
+        return nil, false, fmt.Errorf("AI provider not configured")
+    }
+
+    if err := AI.planTasks(ctx, plan, tasks, now); err != nil {
+        return nil, false, err
+    }
+
+    filter := bson.M{"user_id": userID, "date": date}
+    _, err = plans.ReplaceOne(ctx, filter, plan, options.Replace().SetUpsert(true))
+    if mongo.IsDuplicateKeyError(err) {
+        // Another request inserted today's plan first; overwrite it
+        _, err = plans.ReplaceOne(ctx, filter, plan)
+    }
+    if err != nil {
+        return nil, false, err
+    }
+
+    fillPlanTitles(plan, tasks)
+    return plan, false, nil
+}
+
+func openTasksForPlan(ctx context.Context, userID primitive.ObjectID) ([]models.Task, error) {
+    // Tasks without a due date sort first in MongoDB but matter least here,
+    // so they go last before the limit is applied
+    cursor, err := database.GetCollection("tasks").Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{
+            "$or": []bson.M{
+                {"created_by": userID},
+                {"assigned_to": userID},
+            },
+            "status":     bson.M{"$ne": "completed"},
+            "deleted_at": nil,
+        }}},
+        {{Key: "$addFields", Value: bson.M{
+            "undated": bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$due_date", nil}}, nil}},
+        }}},
+        {{Key: "$sort", Value: bson.D{{Key: "undated", Value: 1}, {Key: "due_date", Value: 1}, {Key: "_id", Value: 1}}}},
+        {{Key: "$limit", Value: maxPlanTasks}},
+        {{Key: "$project", Value: bson.M{"undated": 0}}},
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    var tasks []models.Task
+    if err := cursor.All(ctx, &tasks); err != nil {
+        return nil, err
+    }
+    return tasks, nil
+}
+
+// tasksFingerprint changes whenever an open task is added, removed or
+// edited, since every write to a task sets updated_at.
+func tasksFingerprint(tasks []models.Task) string {
+    lines := make([]string, 0, len(tasks))
+    for _, task := range tasks {
+        lines = append(lines, fmt.Sprintf("%s:%d", task.ID.Hex(), task.UpdatedAt.UnixNano()))
+    }
+    sort.Strings(lines)
+    sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+    return hex.EncodeToString(sum[:])
+}
+
+func (s *AIService) planTasks(ctx context.Context, plan *models.DailyPlan, tasks []models.Task, now time.Time) error {
+    response, err := s.complete(ctx, CompletionRequest{
+        System:    dailyPlanSystemPrompt,
+        Messages:  []Message{{Role: "user", Content: generatePlanPrompt(tasks, now)}},
+        MaxTokens: 2048,
+        Schema:    dailyPlanSchema,
+    }, func(content string) error {
+        _, err := parseDailyPlanReply(content)
+        return err
+    })
+    if err != nil {
+        return err
+    }
+
+    reply, err := parseDailyPlanReply(response.Content)
+    if err != nil {
+        return err
+    }
+
+    open := make(map[primitive.ObjectID]bool, len(tasks))
+    for _, task := range tasks {
+        open[task.ID] = true
+    }
+
+    // Unknown and repeated ids are dropped rather than failing the plan
+    used := map[primitive.ObjectID]bool{}
+    convert := func(items []planItemReply) []models.PlanItem {
+        result := []models.PlanItem{}
+        for _, item := range items {
+            id, err := primitive.ObjectIDFromHex(strings.TrimSpace(item.TaskID))
+            if err != nil || !open[id] || used[id] {
+                continue
+            }
+            used[id] = true
+            result = append(result, models.PlanItem{TaskID: id, Rationale: strings.TrimSpace(item.Rationale)})
+        }
+        return result
+    }
+
+    plan.Summary = strings.TrimSpace(reply.Summary)
+    plan.Today = convert(reply.Today)
+    plan.ThisWeek = convert(reply.ThisWeek)
+    plan.Model = response.Model
+    return nil
+}
+
+func parseDailyPlanReply(content string) (*dailyPlanReply, error) {
+    var reply dailyPlanReply
+    if err := json.Unmarshal([]byte(content), &reply); err != nil {
+        return nil, &InvalidAnalysisError{Reason: err.Error()}
+    }
+    return &reply, nil
+}
+
+func generatePlanPrompt(tasks []models.Task, now time.Time) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Today is %s (%s).\n\nOpen tasks:\n", now.Format("Monday, January 2, 2006"), now.Location())
+    for _, task := range tasks {
+        fmt.Fprintf(&b, "- task_id: %s\n  title: %s\n  status: %s\n  priority: %s\n", task.ID.Hex(), task.Title, task.Status, task.Priority)
+        if task.DueDate != nil {
+            due := task.DueDate.In(now.Location())
+            overdue := ""
+            if due.Before(now) {
+                overdue = " (overdue)"
+            }
+            fmt.Fprintf(&b, "  due: %s%s\n", due.Format("Monday, January 2, 2006 15:04"), overdue)
+        }
+        if task.EstimateMinutes > 0 {
+            fmt.Fprintf(&b, "  estimate: %s\n", formatMinutes(task.EstimateMinutes))
+        }
+        if task.ParentID != nil {
+            fmt.Fprintf(&b, "  subtask of: %s\n", task.ParentID.Hex())
+        }
+        if len(task.Tags) > 0 {
+            fmt.Fprintf(&b, "  tags: %s\n", strings.Join(task.Tags, ", "))
+        }
+    }
+    return b.String()
+}
+
+func fillPlanTitles(plan *models.DailyPlan, tasks []models.Task) {
+    titles := make(map[primitive.ObjectID]string, len(tasks))
+    for _, task := range tasks {
+        titles[task.ID] = task.Title
+    }
+    for i := range plan.Today {
+        plan.Today[i].Title = titles[plan.Today[i].TaskID]
+    }
+    for i := range plan.ThisWeek {
+        plan.ThisWeek[i].Title = titles[plan.ThisWeek[i].TaskID]
+    }
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+func TestTasksFingerprint(t *testing.T) {
+    now := time.Now()
+    a := models.Task{ID: primitive.NewObjectID(), UpdatedAt: now}
+    b := models.Task{ID: primitive.NewObjectID(), UpdatedAt: now}
+
+    if tasksFingerprint([]models.Task{a, b}) != tasksFingerprint([]models.Task{b, a}) {
+        t.Error("fingerprint should not depend on order")
+    }
+
+    edited := b
+    edited.UpdatedAt = now.Add(time.Second)
+    if tasksFingerprint([]models.Task{a, b}) == tasksFingerprint([]models.Task{a, edited}) {
+        t.Error("editing a task should change the fingerprint")
+    }
+    if tasksFingerprint([]models.Task{a, b}) == tasksFingerprint([]models.Task{a}) {
+        t.Error("removing a task should change the fingerprint")
+    }
+}
+
+func TestGeneratePlanPrompt(t *testing.T) {
+    loc := time.FixedZone("CET", 3600)
+    now := time.Date(2026, 3, 4, 9, 0, 0, 0, loc)
+    overdue := time.Date(2026, 3, 3, 16, 0, 0, 0, time.UTC)
+    parentID := primitive.NewObjectID()
+    task := models.Task{
+        ID:              primitive.NewObjectID(),
+        Title:           "Send invoices",
+        Status:          "todo",
+        Priority:        "high",
+        DueDate:         &overdue,
+        EstimateMinutes: 90,
+        ParentID:        &parentID,
+        Tags:            []string{"finance"},
+    }
+
+    prompt := generatePlanPrompt([]models.Task{task, {ID: primitive.NewObjectID(), Title: "Someday", Status: "todo"}}, now)
+    for _, want := range []string{
+        "Today is Wednesday, March 4, 2026 (CET).",
+        "- task_id: " + task.ID.Hex() + "\n  title: Send invoices\n",
+        "  due: Tuesday, March 3, 2026 17:00 (overdue)\n",
+        "  estimate: 1h30m\n",
+        "  subtask of: " + parentID.Hex() + "\n",
+        "  tags: finance\n",
+        "  title: Someday\n  status: todo\n  priority: \n",
+    } {
+        if !strings.Contains(prompt, want) {
+            t.Errorf("prompt is missing %q:\n%s", want, prompt)
+        }
+    }
+}
+
+func TestParseDailyPlanReply(t *testing.T) {
+    reply, err := parseDailyPlanReply(`{"summary":"Busy day","today":[{"task_id":"a","rationale":"due"}],"this_week":[]}`)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if reply.Summary != "Busy day" || len(reply.Today) != 1 || reply.Today[0].TaskID != "a" {
+        t.Errorf("got %+v", reply)
+    }
+
+    if _, err := parseDailyPlanReply("Here is your plan: ..."); err == nil {
+        t.Error("non-JSON reply should fail")
+    }
+}
+
+func TestFillPlanTitles(t *testing.T) {
+    task := models.Task{ID: primitive.NewObjectID(), Title: "Send invoices"}
+    plan := &models.DailyPlan{
+        Today:    []models.PlanItem{{TaskID: task.ID}},
+        ThisWeek: []models.PlanItem{{TaskID: primitive.NewObjectID()}},
+    }
+    fillPlanTitles(plan, []models.Task{task})
+    if plan.Today[0].Title != "Send invoices" || plan.ThisWeek[0].Title != "" {
+        t.Errorf("got %+v", plan)
+    }
+}
+
+func TestPlanTasksDropsUnknownAndRepeatedIDs(t *testing.T) {
+    t.Setenv("AI_CACHE_TTL", "0")
+    first, second := primitive.NewObjectID(), primitive.NewObjectID()
+    reply := fmt.Sprintf(`{
+        "summary": " Two things today ",
+        "today": [{"task_id": "%s", "rationale": "Overdue"}, {"task_id": "%s", "rationale": "Made up"}],
+        "this_week": [{"task_id": "%s", "rationale": "Again"}, {"task_id": " %s ", "rationale": "Later"}]
+    }`, first.Hex(), primitive.NewObjectID().Hex(), first.Hex(), second.Hex())
+
+    ai := NewAIService(NewFakeProvider(reply))
+    plan := &models.DailyPlan{}
+    tasks := []models.Task{{ID: first, Title: "Send invoices"}, {ID: second, Title: "Book travel"}}
+    if err := ai.planTasks(context.Background(), plan, tasks, time.Now()); err != nil {
+        t.Fatalf("planning: %v", err)
+    }
+
+    if plan.Summary != "Two things today" || plan.Model != "fake" {
+        t.Errorf("got summary %q from %q", plan.Summary, plan.Model)
+    }
+    if len(plan.Today) != 1 || plan.Today[0].TaskID != first {
+        t.Errorf("today = %+v", plan.Today)
+    }
+    if len(plan.ThisWeek) != 1 || plan.ThisWeek[0].TaskID != second {
+        t.Errorf("this week = %+v", plan.ThisWeek)
+    }
+}
+
+func TestGetDailyPlanIsCachedUntilTasksChange(t *testing.T) {
+    useTestDatabase(t)
+    t.Setenv("AI_CACHE_TTL", "0")
+    ctx := context.Background()
+    userID, taskID := primitive.NewObjectID(), primitive.NewObjectID()
+
+    previous := AI
+    AI = NewAIService(NewFakeProvider(fmt.Sprintf(`{"summary":"Plan","today":[{"task_id":"%s","rationale":"Due"}],"this_week":[]}`, taskID.Hex())))
+    t.Cleanup(func() { AI = previous })
+
+    tasks := database.GetCollection("tasks")
+    tasks.InsertOne(ctx, models.Task{ID: taskID, Title: "Send invoices", Status: "todo", CreatedBy: userID, UpdatedAt: time.Now()})
+
+    plan, cached, err := GetDailyPlan(ctx, userID, time.UTC, false)
+    if err != nil || cached {
+        t.Fatalf("first plan: cached %v, %v", cached, err)
+    }
+    if len(plan.Today) != 1 || plan.Today[0].Title != "Send invoices" {
+        t.Errorf("unexpected plan %+v", plan)
+    }
+
+    if _, cached, _ := GetDailyPlan(ctx, userID, time.UTC, false); !cached {
+        t.Error("second request should reuse today's plan")
+    }
+    if _, cached, _ := GetDailyPlan(ctx, userID, time.UTC, true); cached {
+        t.Error("refresh should generate a new plan")
+    }
+
+    tasks.InsertOne(ctx, models.Task{ID: primitive.NewObjectID(), Title: "Book travel", Status: "todo", CreatedBy: userID, UpdatedAt: time.Now()})
+    if _, cached, _ := GetDailyPlan(ctx, userID, time.UTC, false); cached {
+        t.Error("a new task should invalidate the plan")
+    }
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const refreshTokenCollection = "refresh_tokens"
+
+var (
+    ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+    ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// GenerateOpaqueToken returns a random URL-safe token. Only its HashToken
+// digest should ever be stored.
+func GenerateOpaqueToken() (string, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("error generating token: %v", err)
+    }
+    return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(raw string) string {
+    sum := sha256.Sum256([]byte(raw))
+    return hex.EncodeToString(sum[:])
+}
+
+func RefreshTokenTTL() time.Duration {
+    if ttl, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+        return ttl
+    }
+    return 30 * 24 * time.Hour
+}
+
+func IssueRefreshToken(ctx context.Context, userID, familyID primitive.ObjectID) (string, error) {
+    raw, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", err
+    }
+
+    now := time.Now()
+    _, err = database.GetCollection(refreshTokenCollection).InsertOne(ctx, models.RefreshToken{
+        ID:        primitive.NewObjectID(),
+        UserID:    userID,
+        FamilyID:  familyID,
+        TokenHash: HashToken(raw),
+        ExpiresAt: now.Add(RefreshTokenTTL()),
+        CreatedAt: now,
+    })
+    if err != nil {
+        return "", fmt.Errorf("error storing refresh token: %v", err)
+    }
+    return raw, nil
+}
+
+// RotateRefreshToken consumes raw and issues its successor in the same
+// family. Presenting a token that was already used or revoked means it has
+// leaked, so the whole family is revoked and ErrRefreshTokenReused returned.
+func RotateRefreshToken(ctx context.Context, raw string) (*models.RefreshToken, string, error) {
+    collection := database.GetCollection(refreshTokenCollection)
+    hash := HashToken(raw)
+    now := time.Now()
+
+    var current models.RefreshToken
+    err := collection.FindOneAndUpdate(ctx,
+        bson.M{
+            "token_hash": hash,
+            "used_at":    nil,
+            "revoked_at": nil,
+            "expires_at": bson.M{"$gt": now},
+        },
+        bson.M{"$set": bson.M{"used_at": now}},
+    ).Decode(&current)
+
+    if err == mongo.ErrNoDocuments {
+        var stale models.RefreshToken
+        if err := collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&stale); err != nil {
+            return nil, "", ErrRefreshTokenInvalid
+        }
+        if stale.UsedAt != nil || stale.RevokedAt != nil {
+            log.Printf("Refresh token reuse detected for user %s, revoking family %s", stale.UserID.Hex(), stale.FamilyID.Hex())
+            if err := RevokeSession(ctx, stale.FamilyID); err != nil {
+                log.Printf("Error revoking session: %v", err)
+            }
+            return nil, "", ErrRefreshTokenReused
+        }
+        return nil, "", ErrRefreshTokenInvalid
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("error rotating refresh token: %v", err)
+    }
+
+    next, err := IssueRefreshToken(ctx, current.UserID, current.FamilyID)
+    if err != nil {
+        return nil, "", err
+    }
+    return &current, next, nil
+}
+
+func LookupRefreshToken(ctx context.Context, raw string) (*models.RefreshToken, error) {
+    var token models.RefreshToken
+    err := database.GetCollection(refreshTokenCollection).FindOne(ctx, bson.M{"token_hash": HashToken(raw)}).Decode(&token)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrRefreshTokenInvalid
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &token, nil
+}
+
+func RevokeRefreshTokenFamily(ctx context.Context, familyID primitive.ObjectID) error {
+    _, err := database.GetCollection(refreshTokenCollection).UpdateMany(ctx,
+        bson.M{"family_id": familyID, "revoked_at": nil},
+        bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+    )
+    return err
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGenerateOpaqueToken(t *testing.T) {
+    a, err := GenerateOpaqueToken()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    b, _ := GenerateOpaqueToken()
+    if a == b {
+        t.Error("two tokens were equal")
+    }
+    // 32 random bytes, base64url without padding
+    if len(a) != 43 {
+        t.Errorf("len = %d, want 43", len(a))
+    }
+}
+
+func TestHashToken(t *testing.T) {
+    if HashToken("abc") != HashToken("abc") {
+        t.Error("hash is not deterministic")
+    }
+    if HashToken("abc") == HashToken("abd") {
+        t.Error("different tokens hashed the same")
+    }
+    if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+        t.Errorf("HashToken should be hex SHA-256, got %s", got)
+    }
+}
+
+func TestRefreshTokenTTL(t *testing.T) {
+    t.Setenv("REFRESH_TOKEN_TTL", "")
+    if got := RefreshTokenTTL(); got != 30*24*time.Hour {
+        t.Errorf("default = %s", got)
+    }
+    t.Setenv("REFRESH_TOKEN_TTL", "2h")
+    if got := RefreshTokenTTL(); got != 2*time.Hour {
+        t.Errorf("configured = %s", got)
+    }
+    t.Setenv("REFRESH_TOKEN_TTL", "-1h")
+    if got := RefreshTokenTTL(); got != 30*24*time.Hour {
+        t.Errorf("negative TTL should fall back to the default, got %s", got)
+    }
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+
+    session, err := CreateSession(ctx, primitive.NewObjectID(), "127.0.0.1", "curl/8.0")
+    if err != nil {
+        t.Fatalf("creating session: %v", err)
+    }
+    first, err := IssueRefreshToken(ctx, session.UserID, session.ID)
+    if err != nil {
+        t.Fatalf("issuing token: %v", err)
+    }
+
+    current, second, err := RotateRefreshToken(ctx, first)
+    if err != nil {
+        t.Fatalf("rotating: %v", err)
+    }
+    if current.FamilyID != session.ID || second == first {
+        t.Fatalf("unexpected rotation result: %+v, %q", current, second)
+    }
+
+    if _, _, err := RotateRefreshToken(ctx, "not-a-token"); err != ErrRefreshTokenInvalid {
+        t.Errorf("unknown token: got %v, want ErrRefreshTokenInvalid", err)
+    }
+
+    // Presenting the spent token again means it leaked: the whole session
+    // goes, including the successor
+    if _, _, err := RotateRefreshToken(ctx, first); err != ErrRefreshTokenReused {
+        t.Fatalf("reused token: got %v, want ErrRefreshTokenReused", err)
+    }
+    if _, _, err := RotateRefreshToken(ctx, second); err != ErrRefreshTokenReused {
+        t.Errorf("successor of a reused token: got %v, want ErrRefreshTokenReused", err)
+    }
+    if _, err := GetActiveSession(ctx, session.ID, session.UserID); err != ErrSessionNotFound {
+        t.Errorf("session should be revoked, got %v", err)
+    }
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    sessionCollection = "sessions"
+
+    // Only write last_seen_at once per interval so authenticated requests
+    // don't each turn into a database write.
+    sessionTouchInterval = time.Minute
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func CreateSession(ctx context.Context, userID primitive.ObjectID, ip, userAgent string) (*models.Session, error) {
+    now := time.Now()
+    session := models.Session{
+        ID:         primitive.NewObjectID(),
+        UserID:     userID,
+        Device:     describeDevice(userAgent),
+        IP:         ip,
+        UserAgent:  userAgent,
+        CreatedAt:  now,
+        LastSeenAt: now,
+        ExpiresAt:  now.Add(RefreshTokenTTL()),
+    }
+
+    if _, err := database.GetCollection(sessionCollection).InsertOne(ctx, session); err != nil {
+        return nil, fmt.Errorf("error creating session: %v", err)
+    }
+    return &session, nil
+}
+
+// GetActiveSession returns the session if it exists, belongs to userID and
+// has been neither revoked nor left to expire.
+func GetActiveSession(ctx context.Context, sessionID, userID primitive.ObjectID) (*models.Session, error) {
+    var session models.Session
+    err := database.GetCollection(sessionCollection).FindOne(ctx, bson.M{
+        "_id":        sessionID,
+        "user_id":    userID,
+        "revoked_at": nil,
+        "expires_at": bson.M{"$gt": time.Now()},
+    }).Decode(&session)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrSessionNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &session, nil
+}
+
+func ListSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+    cursor, err := database.GetCollection(sessionCollection).Find(ctx,
+        bson.M{
+            "user_id":    userID,
+            "revoked_at": nil,
+            "expires_at": bson.M{"$gt": time.Now()},
+        },
+        options.Find().SetSort(bson.M{"last_seen_at": -1}),
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    sessions := []models.Session{}
+    if err := cursor.All(ctx, &sessions); err != nil {
+        return nil, err
+    }
+    return sessions, nil
+}
+
+// TouchSession records activity on a session. ip and userAgent are updated
+// too since mobile clients move between networks.
+func TouchSession(ctx context.Context, session *models.Session, ip, userAgent string) error {
+    now := time.Now()
+    if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+        return nil
+    }
+
+    _, err := database.GetCollection(sessionCollection).UpdateOne(ctx,
+        bson.M{"_id": session.ID},
+        bson.M{"$set": bson.M{"last_seen_at": now, "ip": ip, "user_agent": userAgent}},
+    )
+    return err
+}
+
+// ExtendSession pushes the session's expiry out alongside a refresh token
+// rotation.
+func ExtendSession(ctx context.Context, sessionID primitive.ObjectID) error {
+    now := time.Now()
+    _, err := database.GetCollection(sessionCollection).UpdateOne(ctx,
+        bson.M{"_id": sessionID, "revoked_at": nil},
+        bson.M{"$set": bson.M{"last_seen_at": now, "expires_at": now.Add(RefreshTokenTTL())}},
+    )
+    return err
+}
+
+// RevokeSession ends a session and every refresh token issued for it.
+func RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error {
+    _, err := database.GetCollection(sessionCollection).UpdateOne(ctx,
+        bson.M{"_id": sessionID, "revoked_at": nil},
+        bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+    )
+    if err != nil {
+        return err
+    }
+    return RevokeRefreshTokenFamily(ctx, sessionID)
+}
+
+// RevokeUserSession revokes sessionID only if it belongs to userID.
+func RevokeUserSession(ctx context.Context, sessionID, userID primitive.ObjectID) error {
+    result, err := database.GetCollection(sessionCollection).UpdateOne(ctx,
+        bson.M{"_id": sessionID, "user_id": userID, "revoked_at": nil},
+        bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+    )
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrSessionNotFound
+    }
+    return RevokeRefreshTokenFamily(ctx, sessionID)
+}
+
+func describeDevice(userAgent string) string {
+    ua := strings.ToLower(userAgent)
+
+    browser := "Unknown browser"
+    switch {
+    case strings.Contains(ua, "edg/"):
+        browser = "Edge"
+    case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+        browser = "Opera"
+    case strings.Contains(ua, "firefox/"):
+        browser = "Firefox"
+    case strings.Contains(ua, "chrome/"):
+        browser = "Chrome"
+    case strings.Contains(ua, "safari/"):
+        browser = "Safari"
+    case strings.Contains(ua, "curl/"):
+        browser = "curl"
+    }
+
+    os := "unknown OS"
+    switch {
+    case strings.Contains(ua, "android"):
+        os = "Android"
+    case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+        os = "iOS"
+    case strings.Contains(ua, "windows"):
+        os = "Windows"
+    case strings.Contains(ua, "mac os"):
+        os = "macOS"
+    case strings.Contains(ua, "linux"):
+        os = "Linux"
+    }
+
+    return browser + " on " + os
+}
+
+// RevokeAllUserSessions ends every session for userID except keep, which
+// may be primitive.NilObjectID to revoke them all.
+func RevokeAllUserSessions(ctx context.Context, userID, keep primitive.ObjectID) error {
+    filter := bson.M{"user_id": userID, "revoked_at": nil}
+    if !keep.IsZero() {
+        filter["_id"] = bson.M{"$ne": keep}
+    }
+
+    var sessions []models.Session
+    cursor, err := database.GetCollection(sessionCollection).Find(ctx, filter)
+    if err != nil {
+        return err
+    }
+    if err := cursor.All(ctx, &sessions); err != nil {
+        return err
+    }
+
+    for _, session := range sessions {
+        if err := RevokeSession(ctx, session.ID); err != nil {
+            return err
+        }
+    }
+    return nil
+}
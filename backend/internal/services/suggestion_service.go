@@ -0,0 +1,257 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const (
+    suggestionCollection   = "ai_suggestions"
+    suggestionPollInterval = 2 * time.Second
+    suggestionLockDuration = 2 * time.Minute
+    suggestionMaxAttempts  = 5
+)
+
+var errSuggestionTaskGone = errors.New("task no longer exists")
+
+// EnqueueTaskSuggestion queues suggestion generation for a task as its next
+// version. The result is pushed to requestedBy over WebSocket once the
+// worker has produced it.
+func EnqueueTaskSuggestion(ctx context.Context, taskID, requestedBy primitive.ObjectID) (*models.AITaskSuggestion, error) {
+    collection := database.GetCollection(suggestionCollection)
+
+    // The unique (task_id, version) index makes concurrent requests for the
+    // same task retry with the following version.
+    for attempt := 0; attempt < 5; attempt++ {
+        version, err := nextSuggestionVersion(ctx, taskID)
+        if err != nil {
+            return nil, err
+        }
+
+        now := time.Now()
+        suggestion := models.AITaskSuggestion{
+            ID:            primitive.NewObjectID(),
+            TaskID:        taskID,
+            Version:       version,
+            RequestedBy:   requestedBy,
+            Status:        models.SuggestionStatusPending,
+            NextAttemptAt: now,
+            CreatedAt:     now,
+        }
+        _, err = collection.InsertOne(ctx, suggestion)
+        if mongo.IsDuplicateKeyError(err) {
+            continue
+        }
+        if err != nil {
+            return nil, fmt.Errorf("error queueing suggestion: %v", err)
+        }
+        return &suggestion, nil
+    }
+    return nil, fmt.Errorf("error queueing suggestion: too many concurrent requests")
+}
+
+func nextSuggestionVersion(ctx context.Context, taskID primitive.ObjectID) (int, error) {
+    var latest models.AITaskSuggestion
+    err := database.GetCollection(suggestionCollection).FindOne(ctx,
+        bson.M{"task_id": taskID},
+        options.FindOne().SetSort(bson.M{"version": -1}).SetProjection(bson.M{"version": 1}),
+    ).Decode(&latest)
+    if err == mongo.ErrNoDocuments {
+        return 1, nil
+    }
+    if err != nil {
+        return 0, err
+    }
+    return latest.Version + 1, nil
+}
+
+// ListTaskSuggestions returns every version of the task's suggestions,
+// newest first.
+func ListTaskSuggestions(ctx context.Context, taskID primitive.ObjectID) ([]models.AITaskSuggestion, error) {
+    cursor, err := database.GetCollection(suggestionCollection).Find(ctx,
+        bson.M{"task_id": taskID},
+        options.Find().SetSort(bson.D{{Key: "version", Value: -1}, {Key: "created_at", Value: -1}}),
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    suggestions := []models.AITaskSuggestion{}
+    if err := cursor.All(ctx, &suggestions); err != nil {
+        return nil, err
+    }
+    for i := range suggestions {
+        // Suggestions stored before the queue existed were generated inline
+        if suggestions[i].Status == "" {
+            suggestions[i].Status = models.SuggestionStatusReady
+        }
+    }
+    return suggestions, nil
+}
+
+// RunSuggestionWorker generates queued suggestions until the process exits.
+// Jobs left locked by a crashed worker are picked up once the lock expires.
+func RunSuggestionWorker() {
+    ticker := time.NewTicker(suggestionPollInterval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        for {
+            suggestion, err := claimNextSuggestion()
+            if err != nil {
+                if err != mongo.ErrNoDocuments {
+                    log.Printf("Error claiming suggestion job: %v", err)
+                }
+                break
+            }
+            processSuggestion(suggestion)
+        }
+    }
+}
+
+func claimNextSuggestion() (*models.AITaskSuggestion, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    now := time.Now()
+    filter := bson.M{
+        "status":          models.SuggestionStatusPending,
+        "next_attempt_at": bson.M{"$lte": now},
+        "$or": []bson.M{
+            {"locked_until": nil},
+            {"locked_until": bson.M{"$lt": now}},
+        },
+    }
+    update := bson.M{
+        "$set": bson.M{"locked_until": now.Add(suggestionLockDuration)},
+        "$inc": bson.M{"attempts": 1},
+    }
+
+    var suggestion models.AITaskSuggestion
+    err := database.GetCollection(suggestionCollection).FindOneAndUpdate(ctx, filter, update,
+        options.FindOneAndUpdate().
+            SetSort(bson.M{"next_attempt_at": 1}).
+            SetReturnDocument(options.After),
+    ).Decode(&suggestion)
+    if err != nil {
+        return nil, err
+    }
+    return &suggestion, nil
+}
+
+func processSuggestion(suggestion *models.AITaskSuggestion) {
+    ctx, cancel := context.WithTimeout(context.Background(), suggestionLockDuration)
+    defer cancel()
+    ctx = WithAIUsage(ctx, suggestion.RequestedBy, models.AIFeatureTaskSuggestions)
+    // Later versions are explicit requests for a new answer
+    if suggestion.Version > 1 {
+        ctx = WithoutAICache(ctx)
+    }
+
+    analysis, model, genErr := generateSuggestion(ctx, suggestion.TaskID)
+
+    now := time.Now()
+    var update bson.M
+    switch {
+    case genErr == nil:
+        suggestion.Status = models.SuggestionStatusReady
+        suggestion.Suggestion = FormatTaskAnalysis(analysis)
+        suggestion.Analysis = analysis
+        suggestion.Model = model
+        suggestion.GeneratedAt = &now
+        update = bson.M{
+            "$set": bson.M{
+                "status":       suggestion.Status,
+                "suggestion":   suggestion.Suggestion,
+                "analysis":     analysis,
+                "model":        model,
+                "generated_at": now,
+            },
+            "$unset": bson.M{"locked_until": "", "error": ""},
+        }
+    case suggestion.Attempts >= suggestionMaxAttempts || !retryableLLMError(genErr):
+        log.Printf("Giving up on suggestion %s after %d attempt(s): %v", suggestion.ID.Hex(), suggestion.Attempts, genErr)
+        suggestion.Status = models.SuggestionStatusFailed
+        suggestion.Error = genErr.Error()
+        update = bson.M{
+            "$set":   bson.M{"status": suggestion.Status, "error": suggestion.Error},
+            "$unset": bson.M{"locked_until": ""},
+        }
+    default:
+        log.Printf("Error generating suggestion %s (attempt %d): %v", suggestion.ID.Hex(), suggestion.Attempts, genErr)
+        backoff := time.Duration(suggestion.Attempts*suggestion.Attempts) * 10 * time.Second
+        update = bson.M{
+            "$set":   bson.M{"error": genErr.Error(), "next_attempt_at": now.Add(backoff)},
+            "$unset": bson.M{"locked_until": ""},
+        }
+    }
+
+    if _, err := database.GetCollection(suggestionCollection).UpdateOne(ctx, bson.M{"_id": suggestion.ID}, update); err != nil {
+        log.Printf("Error updating suggestion %s: %v", suggestion.ID.Hex(), err)
+        return
+    }
+
+    if suggestion.Status != models.SuggestionStatusPending && !suggestion.RequestedBy.IsZero() {
+        suggestion.LockedUntil = nil
+        SendToUser(suggestion.RequestedBy.Hex(), "task_suggestion", suggestion)
+    }
+}
+
+// generateSuggestion asks for a structured analysis of the task and its
+// subtasks and returns it along with the model that wrote it. Output that
+// fails validation is retried like any other transient error.
+func generateSuggestion(ctx context.Context, taskID primitive.ObjectID) (*models.TaskAnalysis, string, error) {
+    if AI == nil {
+        return nil, "", fmt.Errorf("AI provider not configured")
+    }
+
+    tasks := database.GetCollection("tasks")
+    var task models.Task
+    err := tasks.FindOne(ctx, bson.M{"_id": taskID, "deleted_at": nil}).Decode(&task)
+    if err == mongo.ErrNoDocuments {
+        return nil, "", errSuggestionTaskGone
+    }
+    if err != nil {
+        return nil, "", err
+    }
+
+    cursor, err := tasks.Find(ctx,
+        bson.M{"parent_id": taskID, "deleted_at": nil},
+        options.Find().SetSort(bson.M{"created_at": 1}).SetLimit(50),
+    )
+    if err != nil {
+        return nil, "", err
+    }
+    var subtasks []models.Task
+    if err := cursor.All(ctx, &subtasks); err != nil {
+        return nil, "", err
+    }
+
+    analysis, err := AI.AnalyzeTask(ctx, task, subtasks)
+    if err != nil {
+        return nil, "", err
+    }
+    return analysis, AI.Provider().Model(), nil
+}
+
+// retryableLLMError reports whether trying again later might succeed. Client
+// errors other than rate limiting and timeouts won't go away on their own.
+func retryableLLMError(err error) bool {
+    if err == errSuggestionTaskGone || errors.Is(err, ErrAIQuotaExceeded) {
+        return false
+    }
+    var apiErr *LLMAPIError
+    if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+        return apiErr.StatusCode == 408 || apiErr.StatusCode == 429
+    }
+    return true
+}
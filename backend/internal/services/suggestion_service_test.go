@@ -0,0 +1,132 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "sync"
+    "testing"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+func TestRetryableLLMError(t *testing.T) {
+    tests := []struct {
+        err  error
+        want bool
+    }{
+        {errSuggestionTaskGone, false},
+        {fmt.Errorf("checking quota: %w", ErrAIQuotaExceeded), false},
+        {&LLMAPIError{StatusCode: 400}, false},
+        {&LLMAPIError{StatusCode: 401}, false},
+        {&LLMAPIError{StatusCode: 408}, true},
+        {&LLMAPIError{StatusCode: 429}, true},
+        {&LLMAPIError{StatusCode: 503}, true},
+        {fmt.Errorf("request failed: %w", &LLMAPIError{StatusCode: 404}), false},
+        {context.DeadlineExceeded, true},
+    }
+    for _, tt := range tests {
+        if got := retryableLLMError(tt.err); got != tt.want {
+            t.Errorf("retryableLLMError(%v) = %v, want %v", tt.err, got, tt.want)
+        }
+    }
+}
+
+func TestEnqueueTaskSuggestionVersions(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    _, err := database.GetCollection(suggestionCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.D{{Key: "task_id", Value: 1}, {Key: "version", Value: 1}},
+        Options: options.Index().SetUnique(true),
+    })
+    if err != nil {
+        t.Fatalf("creating index: %v", err)
+    }
+
+    taskID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+
+    // Concurrent requests each get their own version
+    const requests = 4
+    var mu sync.Mutex
+    var versions []int
+    var wg sync.WaitGroup
+    for i := 0; i < requests; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            suggestion, err := EnqueueTaskSuggestion(ctx, taskID, userID)
+            if err != nil {
+                t.Errorf("queueing: %v", err)
+                return
+            }
+            mu.Lock()
+            versions = append(versions, suggestion.Version)
+            mu.Unlock()
+        }()
+    }
+    wg.Wait()
+
+    sort.Ints(versions)
+    for i, v := range versions {
+        if v != i+1 {
+            t.Fatalf("got versions %v, want 1..%d", versions, requests)
+        }
+    }
+
+    suggestions, err := ListTaskSuggestions(ctx, taskID)
+    if err != nil {
+        t.Fatalf("listing: %v", err)
+    }
+    if len(suggestions) != requests || suggestions[0].Version != requests {
+        t.Fatalf("want %d suggestions, newest first, got %+v", requests, suggestions)
+    }
+    for _, s := range suggestions {
+        if s.Status != models.SuggestionStatusPending || s.RequestedBy != userID {
+            t.Errorf("unexpected queued suggestion %+v", s)
+        }
+    }
+}
+
+func TestListTaskSuggestionsDefaultsLegacyStatus(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    taskID := primitive.NewObjectID()
+
+    // Suggestions from before the queue have no status or version
+    database.GetCollection(suggestionCollection).InsertOne(ctx, bson.M{"task_id": taskID, "suggestion": "Split it up"})
+
+    suggestions, err := ListTaskSuggestions(ctx, taskID)
+    if err != nil {
+        t.Fatalf("listing: %v", err)
+    }
+    if len(suggestions) != 1 || suggestions[0].Status != models.SuggestionStatusReady {
+        t.Errorf("got %+v", suggestions)
+    }
+}
+
+func TestClaimNextSuggestion(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+
+    queued, err := EnqueueTaskSuggestion(ctx, primitive.NewObjectID(), primitive.NewObjectID())
+    if err != nil {
+        t.Fatalf("queueing: %v", err)
+    }
+
+    claimed, err := claimNextSuggestion()
+    if err != nil {
+        t.Fatalf("claiming: %v", err)
+    }
+    if claimed.ID != queued.ID || claimed.Attempts != 1 || claimed.LockedUntil == nil {
+        t.Errorf("unexpected claim %+v", claimed)
+    }
+
+    // A locked job isn't handed to a second worker
+    if _, err := claimNextSuggestion(); err != mongo.ErrNoDocuments {
+        t.Errorf("second claim: got %v, want ErrNoDocuments", err)
+    }
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "task-management/internal/models"
+)
+
+const taskAnalysisSystemPrompt = `You are a project planning assistant. Answer only with JSON that matches the task_analysis schema. Estimates are in minutes. depends_on lists the zero-based indexes of subtasks that must be finished first.`
+
+var validPriorities = map[string]bool{"low": true, "medium": true, "high": true}
+
+// taskAnalysisSchema describes models.TaskAnalysis. It is written to satisfy
+// OpenAI strict mode: every property is required and no others are allowed.
+var taskAnalysisSchema = &JSONSchema{
+    Name:        "task_analysis",
+    Description: "Breakdown of a task into subtasks with estimates and risks",
+    Schema: map[string]interface{}{
+        "type":                 "object",
+        "additionalProperties": false,
+        "required":             []string{"summary", "subtasks", "risks", "total_estimate_minutes"},
+        "properties": map[string]interface{}{
+            "summary": map[string]interface{}{"type": "string"},
+            "subtasks": map[string]interface{}{
+                "type": "array",
+                "items": map[string]interface{}{
+                    "type":                 "object",
+                    "additionalProperties": false,
+                    "required":             []string{"title", "description", "priority", "estimate_minutes", "depends_on"},
+                    "properties": map[string]interface{}{
+                        "title":            map[string]interface{}{"type": "string"},
+                        "description":      map[string]interface{}{"type": "string"},
+                        "priority":         map[string]interface{}{"type": "string", "enum": []string{"low", "medium", "high"}},
+                        "estimate_minutes": map[string]interface{}{"type": "integer"},
+                        "depends_on":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}},
+                    },
+                },
+            },
+            "risks": map[string]interface{}{
+                "type": "array",
+                "items": map[string]interface{}{
+                    "type":                 "object",
+                    "additionalProperties": false,
+                    "required":             []string{"description", "severity", "mitigation"},
+                    "properties": map[string]interface{}{
+                        "description": map[string]interface{}{"type": "string"},
+                        "severity":    map[string]interface{}{"type": "string", "enum": []string{"low", "medium", "high"}},
+                        "mitigation":  map[string]interface{}{"type": "string"},
+                    },
+                },
+            },
+            "total_estimate_minutes": map[string]interface{}{"type": "integer"},
+        },
+    },
+}
+
+// InvalidAnalysisError is returned when the model's answer doesn't match the
+// schema. Models are not deterministic, so asking again may succeed.
+type InvalidAnalysisError struct {
+    Reason string
+}
+
+func (e *InvalidAnalysisError) Error() string {
+    return "invalid task analysis: " + e.Reason
+}
+
+// AnalyzeTask asks for a structured breakdown of the task and validates it.
+func (s *AIService) AnalyzeTask(ctx context.Context, task models.Task, subtasks []models.Task) (*models.TaskAnalysis, error) {
+    response, err := s.complete(ctx, CompletionRequest{
+        System:    taskAnalysisSystemPrompt,
+        Messages:  []Message{{Role: "user", Content: generateAIPrompt(task, subtasks)}},
+        MaxTokens: 2048,
+        Schema:    taskAnalysisSchema,
+    }, func(content string) error {
+        _, err := ParseTaskAnalysis(content)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return ParseTaskAnalysis(response.Content)
+}
+
+func ParseTaskAnalysis(content string) (*models.TaskAnalysis, error) {
+    // Some local models wrap JSON in a Markdown code fence
+    content = strings.TrimSpace(content)
+    content = strings.TrimPrefix(content, "```json")
+    content = strings.TrimPrefix(content, "```")
+    content = strings.TrimSuffix(content, "```")
+
+    var analysis models.TaskAnalysis
+    decoder := json.NewDecoder(strings.NewReader(content))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&analysis); err != nil {
+        return nil, &InvalidAnalysisError{Reason: err.Error()}
+    }
+    if err := validateTaskAnalysis(&analysis); err != nil {
+        return nil, err
+    }
+    return &analysis, nil
+}
+
+func validateTaskAnalysis(analysis *models.TaskAnalysis) error {
+    if len(analysis.Subtasks) == 0 {
+        return &InvalidAnalysisError{Reason: "no subtasks"}
+    }
+    if len(analysis.Subtasks) > 50 {
+        return &InvalidAnalysisError{Reason: "too many subtasks"}
+    }
+
+    total := 0
+    for i, subtask := range analysis.Subtasks {
+        if strings.TrimSpace(subtask.Title) == "" {
+            return &InvalidAnalysisError{Reason: fmt.Sprintf("subtask %d has no title", i)}
+        }
+        if !validPriorities[subtask.Priority] {
+            return &InvalidAnalysisError{Reason: fmt.Sprintf("subtask %d has invalid priority %q", i, subtask.Priority)}
+        }
+        if subtask.EstimateMinutes < 0 {
+            return &InvalidAnalysisError{Reason: fmt.Sprintf("subtask %d has a negative estimate", i)}
+        }
+        for _, dep := range subtask.DependsOn {
+            if dep < 0 || dep >= len(analysis.Subtasks) || dep == i {
+                return &InvalidAnalysisError{Reason: fmt.Sprintf("subtask %d depends on invalid subtask %d", i, dep)}
+            }
+        }
+        total += subtask.EstimateMinutes
+    }
+    for i, risk := range analysis.Risks {
+        if !validPriorities[risk.Severity] {
+            return &InvalidAnalysisError{Reason: fmt.Sprintf("risk %d has invalid severity %q", i, risk.Severity)}
+        }
+    }
+
+    // The sum is authoritative; models are bad at arithmetic
+    analysis.TotalEstimateMinutes = total
+    return nil
+}
+
+// FormatTaskAnalysis renders an analysis as plain text for clients that
+// only display the suggestion string.
+func FormatTaskAnalysis(analysis *models.TaskAnalysis) string {
+    var b strings.Builder
+    if analysis.Summary != "" {
+        b.WriteString(analysis.Summary + "\n\n")
+    }
+
+    b.WriteString("Task Breakdown:\n")
+    for i, subtask := range analysis.Subtasks {
+        fmt.Fprintf(&b, "%d. %s (%s priority, %s)\n", i+1, subtask.Title, subtask.Priority, formatMinutes(subtask.EstimateMinutes))
+        if subtask.Description != "" {
+            fmt.Fprintf(&b, "   %s\n", subtask.Description)
+        }
+        if len(subtask.DependsOn) > 0 {
+            deps := make([]string, 0, len(subtask.DependsOn))
+            for _, dep := range subtask.DependsOn {
+                deps = append(deps, fmt.Sprint(dep+1))
+            }
+            fmt.Fprintf(&b, "   Depends on: %s\n", strings.Join(deps, ", "))
+        }
+    }
+    fmt.Fprintf(&b, "\nTotal estimate: %s\n", formatMinutes(analysis.TotalEstimateMinutes))
+
+    if len(analysis.Risks) > 0 {
+        b.WriteString("\nRisks:\n")
+        for _, risk := range analysis.Risks {
+            fmt.Fprintf(&b, "- [%s] %s", risk.Severity, risk.Description)
+            if risk.Mitigation != "" {
+                fmt.Fprintf(&b, " Mitigation: %s", risk.Mitigation)
+            }
+            b.WriteString("\n")
+        }
+    }
+    return strings.TrimRight(b.String(), "\n")
+}
+
+func formatMinutes(minutes int) string {
+    if minutes < 60 {
+        return fmt.Sprintf("%dm", minutes)
+    }
+    if minutes%60 == 0 {
+        return fmt.Sprintf("%dh", minutes/60)
+    }
+    return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+    "errors"
+    "testing"
+)
+
+const validAnalysis = `{
+    "summary": "Ship the release",
+    "subtasks": [
+        {"title": "Write changelog", "description": "", "priority": "low", "estimate_minutes": 30, "depends_on": []},
+        {"title": "Tag release", "description": "After the changelog", "priority": "high", "estimate_minutes": 15, "depends_on": [0]}
+    ],
+    "risks": [
+        {"description": "CI is flaky", "severity": "medium", "mitigation": "Rerun failed jobs"}
+    ],
+    "total_estimate_minutes": 999
+}`
+
+func TestParseTaskAnalysis(t *testing.T) {
+    analysis, err := ParseTaskAnalysis(validAnalysis)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if analysis.Summary != "Ship the release" {
+        t.Errorf("summary = %q", analysis.Summary)
+    }
+    if len(analysis.Subtasks) != 2 || analysis.Subtasks[1].DependsOn[0] != 0 {
+        t.Errorf("subtasks not decoded: %+v", analysis.Subtasks)
+    }
+    if len(analysis.Risks) != 1 || analysis.Risks[0].Severity != "medium" {
+        t.Errorf("risks not decoded: %+v", analysis.Risks)
+    }
+    // The model's total is replaced by the sum of the subtask estimates
+    if analysis.TotalEstimateMinutes != 45 {
+        t.Errorf("total estimate = %d, want 45", analysis.TotalEstimateMinutes)
+    }
+}
+
+func TestParseTaskAnalysisStripsCodeFence(t *testing.T) {
+    for _, content := range []string{
+        "```json\n" + validAnalysis + "\n```",
+        "```\n" + validAnalysis + "\n```",
+        "\n  " + validAnalysis + "  \n",
+    } {
+        if _, err := ParseTaskAnalysis(content); err != nil {
+            t.Errorf("ParseTaskAnalysis(%q) returned error: %v", content[:10], err)
+        }
+    }
+}
+
+func TestParseTaskAnalysisRejectsInvalid(t *testing.T) {
+    subtask := func(fields string) string {
+        return `{"summary": "s", "risks": [], "subtasks": [` + fields + `]}`
+    }
+
+    tests := []struct {
+        name    string
+        content string
+    }{
+        {"not JSON", "Here are some ideas: write tests"},
+        {"unknown field", `{"summary": "s", "subtasks": [], "risks": [], "confidence": 0.9}`},
+        {"no subtasks", `{"summary": "s", "subtasks": [], "risks": []}`},
+        {"blank title", subtask(`{"title": "  ", "priority": "low", "estimate_minutes": 5, "depends_on": []}`)},
+        {"bad priority", subtask(`{"title": "a", "priority": "urgent", "estimate_minutes": 5, "depends_on": []}`)},
+        {"negative estimate", subtask(`{"title": "a", "priority": "low", "estimate_minutes": -5, "depends_on": []}`)},
+        {"self dependency", subtask(`{"title": "a", "priority": "low", "estimate_minutes": 5, "depends_on": [0]}`)},
+        {"dependency out of range", subtask(`{"title": "a", "priority": "low", "estimate_minutes": 5, "depends_on": [3]}`)},
+        {"bad risk severity", `{"summary": "s", "subtasks": [{"title": "a", "priority": "low", "estimate_minutes": 5, "depends_on": []}], "risks": [{"description": "d", "severity": "critical", "mitigation": "m"}]}`},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := ParseTaskAnalysis(tt.content)
+            var invalid *InvalidAnalysisError
+            if !errors.As(err, &invalid) {
+                t.Fatalf("got error %v, want *InvalidAnalysisError", err)
+            }
+        })
+    }
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+    "unicode/utf8"
+    "task-management/internal/models"
+)
+
+// TaskDraft is a task parsed from free text. Nothing is stored; the client
+// shows the draft for confirmation and then creates it with POST /api/tasks.
+type TaskDraft struct {
+    Task models.Task
+    // Assignee is the name as written in the text, resolved to a user by
+    // the caller. Empty when the task isn't for someone else.
+    Assignee string
+    // Source is "ai" or "rules"
+    Source string
+}
+
+const taskDraftSystemPrompt = `You turn a short note into a task. Answer only with JSON that matches the task_draft schema. Leave a field empty when the note doesn't mention it. The title is a short imperative phrase without the date, priority, tags or assignee. due_date is a calendar date (YYYY-MM-DD) resolved against the current date given below. assignee is the name of the person the task is for, or empty if it is for the writer.`
+
+var taskDraftSchema = &JSONSchema{
+    Name:        "task_draft",
+    Description: "A task extracted from a natural-language note",
+    Schema: map[string]interface{}{
+        "type":                 "object",
+        "additionalProperties": false,
+        "required":             []string{"title", "description", "due_date", "priority", "tags", "assignee"},
+        "properties": map[string]interface{}{
+            "title":       map[string]interface{}{"type": "string"},
+            "description": map[string]interface{}{"type": "string"},
+            "due_date":    map[string]interface{}{"type": "string"},
+            "priority":    map[string]interface{}{"type": "string", "enum": []string{"low", "medium", "high", ""}},
+            "tags":        map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+            "assignee":    map[string]interface{}{"type": "string"},
+        },
+    },
+}
+
+type taskDraftReply struct {
+    Title       string   `json:"title"`
+    Description string   `json:"description"`
+    DueDate     string   `json:"due_date"`
+    Priority    string   `json:"priority"`
+    Tags        []string `json:"tags"`
+    Assignee    string   `json:"assignee"`
+}
+
+// ParseTaskText turns text such as "remind Alex to review the deployment
+// docs by Friday, high priority, tag infra" into a draft. Dates are resolved
+// in loc. The AI service is used when useAI is set and one is configured;
+// otherwise, or if it fails, a rule-based parser handles common phrasings.
+func ParseTaskText(ctx context.Context, text string, loc *time.Location, useAI bool) *TaskDraft {
+    now := time.Now().In(loc)
+    if useAI && AI != nil {
+        draft, err := AI.parseTaskText(ctx, text, now)
+        if err == nil {
+            return draft
+        }
+        log.Printf("Error parsing task with AI, falling back to rules: %v", err)
+    }
+    return parseTaskRules(text, now)
+}
+
+func (s *AIService) parseTaskText(ctx context.Context, text string, now time.Time) (*TaskDraft, error) {
+    response, err := s.complete(ctx, CompletionRequest{
+        System:    taskDraftSystemPrompt + "\n\nThe current date is " + now.Format("Monday, January 2, 2006") + " (" + now.Location().String() + ").",
+        Messages:  []Message{{Role: "user", Content: text}},
+        MaxTokens: 512,
+        Schema:    taskDraftSchema,
+    }, func(content string) error {
+        _, err := parseTaskDraftReply(content)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    reply, err := parseTaskDraftReply(response.Content)
+    if err != nil {
+        return nil, err
+    }
+
+    draft := newTaskDraft("ai")
+    draft.Task.Title = strings.TrimSpace(reply.Title)
+    draft.Task.Description = strings.TrimSpace(reply.Description)
+    if validPriorities[reply.Priority] {
+        draft.Task.Priority = reply.Priority
+    }
+    if reply.DueDate != "" {
+        if day, err := time.ParseInLocation("2006-01-02", reply.DueDate, now.Location()); err == nil {
+            draft.Task.DueDate = endOfDay(day)
+        }
+    }
+    draft.Task.Tags = normalizeTags(reply.Tags)
+    draft.Assignee = normalizeAssignee(reply.Assignee)
+    return draft, nil
+}
+
+func parseTaskDraftReply(content string) (*taskDraftReply, error) {
+    var reply taskDraftReply
+    if err := json.Unmarshal([]byte(content), &reply); err != nil {
+        return nil, fmt.Errorf("invalid task draft: %v", err)
+    }
+    if strings.TrimSpace(reply.Title) == "" {
+        return nil, fmt.Errorf("invalid task draft: no title")
+    }
+    return &reply, nil
+}
+
+func newTaskDraft(source string) *TaskDraft {
+    return &TaskDraft{
+        Task:   models.Task{Status: "todo", Priority: "medium"},
+        Source: source,
+    }
+}
+
+var (
+    ruleAssigneePrefix = regexp.MustCompile(`(?i)^\s*(?:please\s+)?(?:remind|ask|tell|get)\s+(@?[\p{L}][\p{L}.'-]*)\s+to\s+`)
+    ruleAssignedTo     = regexp.MustCompile(`(?i)[,;]?\s*\bassign(?:ed)?\s+to\s+@?([\p{L}][\p{L}.'-]*)\b`)
+    ruleMention        = regexp.MustCompile(`(?:^|\s)@([\p{L}][\p{L}.'-]*)`)
+    rulePriority       = regexp.MustCompile(`(?i)[,;]?\s*\b(?:(high|medium|low)\s+priority|priority\s*[:=]?\s*(high|medium|low)|(urgent|asap))\b`)
+    ruleTagList        = regexp.MustCompile(`(?i)[,;]?\s*\btag(?:s|ged)?\s*[:=]?\s*(#?[\w-]+(?:\s*,\s*#?[\w-]+)*)`)
+    ruleHashtag        = regexp.MustCompile(`(?:^|\s)#([\w-]+)`)
+    ruleDueDate        = regexp.MustCompile(`(?i)[,;]?\s*\b(?:(?:by|due|on|before|until)\s+)?(today|tonight|tomorrow|next\s+week|(?:next\s+)?(?:mon|tues|wednes|thurs|fri|satur|sun)day|\d{4}-\d{2}-\d{2}|in\s+\d+\s+days?)\b`)
+    ruleSpaces         = regexp.MustCompile(`\s+`)
+)
+
+var weekdays = map[string]time.Weekday{
+    "sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+    "thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// parseTaskRules recognises an assignee ("remind Alex to", "@alex",
+// "assign to Alex"), a priority, tags ("tag infra", "#infra") and a due date
+// (today, tomorrow, weekdays, "next week", "in 3 days", YYYY-MM-DD). What is
+// left over becomes the title.
+func parseTaskRules(text string, now time.Time) *TaskDraft {
+    draft := newTaskDraft("rules")
+    rest := text
+
+    if m := ruleAssigneePrefix.FindStringSubmatch(rest); m != nil {
+        draft.Assignee = normalizeAssignee(m[1])
+        rest = rest[len(m[0]):]
+    } else if m := ruleAssignedTo.FindStringSubmatchIndex(rest); m != nil {
+        draft.Assignee = normalizeAssignee(rest[m[2]:m[3]])
+        rest = rest[:m[0]] + rest[m[1]:]
+    } else if m := ruleMention.FindStringSubmatchIndex(rest); m != nil {
+        draft.Assignee = normalizeAssignee(rest[m[2]:m[3]])
+        rest = rest[:m[0]] + " " + rest[m[1]:]
+    }
+
+    if m := rulePriority.FindStringSubmatchIndex(rest); m != nil {
+        switch {
+        case m[2] >= 0:
+            draft.Task.Priority = strings.ToLower(rest[m[2]:m[3]])
+        case m[4] >= 0:
+            draft.Task.Priority = strings.ToLower(rest[m[4]:m[5]])
+        default:
+            draft.Task.Priority = "high"
+        }
+        rest = rest[:m[0]] + rest[m[1]:]
+    }
+
+    var tags []string
+    if m := ruleTagList.FindStringSubmatchIndex(rest); m != nil {
+        tags = append(tags, strings.Split(rest[m[2]:m[3]], ",")...)
+        rest = rest[:m[0]] + rest[m[1]:]
+    }
+    for _, m := range ruleHashtag.FindAllStringSubmatch(rest, -1) {
+        tags = append(tags, m[1])
+    }
+    rest = ruleHashtag.ReplaceAllString(rest, " ")
+    draft.Task.Tags = normalizeTags(tags)
+
+    if m := ruleDueDate.FindStringSubmatchIndex(rest); m != nil {
+        if due := resolveDueDate(strings.ToLower(rest[m[2]:m[3]]), now); due != nil {
+            draft.Task.DueDate = due
+            rest = rest[:m[0]] + rest[m[1]:]
+        }
+    }
+
+    title := strings.Trim(ruleSpaces.ReplaceAllString(rest, " "), " ,;.-")
+    if title == "" {
+        title = strings.TrimSpace(text)
+    }
+    draft.Task.Title = capitalize(title)
+    return draft
+}
+
+func resolveDueDate(phrase string, now time.Time) *time.Time {
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+    phrase = ruleSpaces.ReplaceAllString(phrase, " ")
+
+    switch {
+    case phrase == "today" || phrase == "tonight":
+        return endOfDay(today)
+    case phrase == "tomorrow":
+        return endOfDay(today.AddDate(0, 0, 1))
+    case phrase == "next week":
+        // The end of next week's working days
+        days := (int(time.Friday) - int(today.Weekday()) + 7) % 7
+        return endOfDay(today.AddDate(0, 0, days+7))
+    case strings.HasPrefix(phrase, "in "):
+        n, err := strconv.Atoi(strings.Fields(phrase)[1])
+        if err != nil || n > 3650 {
+            return nil
+        }
+        return endOfDay(today.AddDate(0, 0, n))
+    }
+
+    if day, err := time.ParseInLocation("2006-01-02", phrase, now.Location()); err == nil {
+        return endOfDay(day)
+    }
+
+    next := strings.HasPrefix(phrase, "next ")
+    weekday, ok := weekdays[strings.TrimPrefix(phrase, "next ")]
+    if !ok {
+        return nil
+    }
+    // "Friday" is the coming Friday, today included; "next Friday" the one after
+    days := (int(weekday) - int(today.Weekday()) + 7) % 7
+    if next {
+        days += 7
+    }
+    return endOfDay(today.AddDate(0, 0, days))
+}
+
+// endOfDay makes a date-only due date last until the end of that day in the
+// user's timezone.
+func endOfDay(day time.Time) *time.Time {
+    t := time.Date(day.Year(), day.Month(), day.Day(), 23, 59, 59, 0, day.Location())
+    return &t
+}
+
+func normalizeTags(tags []string) []string {
+    seen := map[string]bool{}
+    var result []string
+    for _, tag := range tags {
+        tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+        if tag == "" || seen[tag] {
+            continue
+        }
+        seen[tag] = true
+        result = append(result, tag)
+    }
+    return result
+}
+
+// normalizeAssignee drops references to the writer, who is the default.
+func normalizeAssignee(name string) string {
+    name = strings.Trim(strings.TrimSpace(name), "@.,'")
+    switch strings.ToLower(name) {
+    case "", "me", "myself", "i":
+        return ""
+    }
+    return name
+}
+
+func capitalize(s string) string {
+    r, size := utf8.DecodeRuneInString(s)
+    return string(unicode.ToUpper(r)) + s[size:]
+}
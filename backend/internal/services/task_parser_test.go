@@ -0,0 +1,128 @@
+package services
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+// A Wednesday, in a zone away from UTC so date arithmetic has to respect it
+var parserNow = time.Date(2025, time.March, 12, 10, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+
+func dueOn(month time.Month, day int) *time.Time {
+    t := time.Date(2025, month, day, 23, 59, 59, 0, parserNow.Location())
+    return &t
+}
+
+func TestResolveDueDate(t *testing.T) {
+    tests := []struct {
+        phrase string
+        want   *time.Time
+    }{
+        {"today", dueOn(time.March, 12)},
+        {"tonight", dueOn(time.March, 12)},
+        {"tomorrow", dueOn(time.March, 13)},
+        {"wednesday", dueOn(time.March, 12)},
+        {"friday", dueOn(time.March, 14)},
+        {"monday", dueOn(time.March, 17)},
+        {"next wednesday", dueOn(time.March, 19)},
+        {"next friday", dueOn(time.March, 21)},
+        {"next week", dueOn(time.March, 21)},
+        {"next  week", dueOn(time.March, 21)},
+        {"in 1 day", dueOn(time.March, 13)},
+        {"in 20 days", dueOn(time.April, 1)},
+        {"2025-04-01", dueOn(time.April, 1)},
+        {"in 5000 days", nil},
+        {"2025-13-01", nil},
+        {"someday", nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.phrase, func(t *testing.T) {
+            got := resolveDueDate(tt.phrase, parserNow)
+            switch {
+            case tt.want == nil && got != nil:
+                t.Errorf("got %v, want nil", got)
+            case tt.want != nil && (got == nil || !got.Equal(*tt.want)):
+                t.Errorf("got %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseTaskRules(t *testing.T) {
+    tests := []struct {
+        text     string
+        title    string
+        assignee string
+        priority string
+        tags     []string
+        due      *time.Time
+    }{
+        {
+            text:     "remind Alex to review the deployment docs by Friday, high priority, tag infra",
+            title:    "Review the deployment docs",
+            assignee: "Alex",
+            priority: "high",
+            tags:     []string{"infra"},
+            due:      dueOn(time.March, 14),
+        },
+        {
+            text:     "buy milk tomorrow #errands #Home",
+            title:    "Buy milk",
+            priority: "medium",
+            tags:     []string{"errands", "home"},
+            due:      dueOn(time.March, 13),
+        },
+        {
+            text:     "@sam fix login bug asap",
+            title:    "Fix login bug",
+            assignee: "sam",
+            priority: "high",
+        },
+        {
+            text:     "Write report, assigned to Jo, priority: low, due 2025-03-20",
+            title:    "Write report",
+            assignee: "Jo",
+            priority: "low",
+            due:      dueOn(time.March, 20),
+        },
+        {
+            text:     "remind me to call the dentist",
+            title:    "Call the dentist",
+            priority: "medium",
+        },
+        {
+            text:     "buy gift for mom",
+            title:    "Buy gift for mom",
+            priority: "medium",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.text, func(t *testing.T) {
+            draft := parseTaskRules(tt.text, parserNow)
+            if draft.Source != "rules" {
+                t.Errorf("source = %q, want rules", draft.Source)
+            }
+            if draft.Task.Title != tt.title {
+                t.Errorf("title = %q, want %q", draft.Task.Title, tt.title)
+            }
+            if draft.Assignee != tt.assignee {
+                t.Errorf("assignee = %q, want %q", draft.Assignee, tt.assignee)
+            }
+            if draft.Task.Priority != tt.priority {
+                t.Errorf("priority = %q, want %q", draft.Task.Priority, tt.priority)
+            }
+            if !reflect.DeepEqual(draft.Task.Tags, tt.tags) {
+                t.Errorf("tags = %q, want %q", draft.Task.Tags, tt.tags)
+            }
+            switch {
+            case tt.due == nil && draft.Task.DueDate != nil:
+                t.Errorf("due = %v, want none", draft.Task.DueDate)
+            case tt.due != nil && (draft.Task.DueDate == nil || !draft.Task.DueDate.Equal(*tt.due)):
+                t.Errorf("due = %v, want %v", draft.Task.DueDate, tt.due)
+            }
+        })
+    }
+}
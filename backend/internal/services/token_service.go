@@ -0,0 +1,296 @@
+package services
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "log"
+    "math/big"
+    "os"
+    "strings"
+    "github.com/golang-jwt/jwt/v4"
+)
+
+// SigningKey is one key known to the TokenService. Private is nil for keys
+// that are only kept to verify tokens signed before a rotation.
+type SigningKey struct {
+    ID        string
+    Algorithm string
+    Private   crypto.PrivateKey
+    Public    crypto.PublicKey
+}
+
+// TokenService signs and verifies every JWT the API issues. One key signs
+// new tokens while any number of older keys stay valid for verification, so
+// keys can be rotated without logging everyone out.
+type TokenService struct {
+    signing *SigningKey
+    keys    map[string]*SigningKey
+}
+
+var Tokens *TokenService
+
+func NewTokenService(signing *SigningKey, verification []*SigningKey) (*TokenService, error) {
+    if signing == nil || signing.Private == nil {
+        return nil, fmt.Errorf("a signing key is required")
+    }
+
+    keys := map[string]*SigningKey{signing.ID: signing}
+    for _, key := range verification {
+        if _, exists := keys[key.ID]; !exists {
+            keys[key.ID] = key
+        }
+    }
+
+    return &TokenService{
+        signing: signing,
+        keys:    keys,
+    }, nil
+}
+
+// InitTokenService configures the global Tokens from the environment.
+//
+// JWT_SIGNING_ALG selects HS256 (the default, keyed by JWT_SECRET), RS256 or
+// EdDSA. Asymmetric keys are read as PEM from JWT_PRIVATE_KEY_FILE; keys
+// being rotated out are listed in JWT_VERIFICATION_KEY_FILES, comma separated.
+func InitTokenService() {
+    algorithm := strings.ToUpper(os.Getenv("JWT_SIGNING_ALG"))
+    if algorithm == "" {
+        algorithm = "HS256"
+    }
+
+    var signing *SigningKey
+    switch algorithm {
+    case "HS256":
+        secret := os.Getenv("JWT_SECRET")
+        if secret == "" {
+            log.Fatal("JWT_SECRET not set in environment")
+        }
+        signing = &SigningKey{ID: "hs256", Algorithm: "HS256", Private: []byte(secret), Public: []byte(secret)}
+    case "RS256", "EDDSA":
+        keyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+        if keyFile == "" {
+            if os.Getenv("GO_ENV") == "production" {
+                log.Fatal("JWT_PRIVATE_KEY_FILE not set in environment")
+            }
+            log.Println("Warning: JWT_PRIVATE_KEY_FILE not set, generating a temporary signing key")
+            key, err := GenerateSigningKey(algorithm)
+            if err != nil {
+                log.Fatal("Failed to generate signing key:", err)
+            }
+            signing = key
+            break
+        }
+
+        key, err := LoadSigningKey(keyFile)
+        if err != nil {
+            log.Fatal("Failed to load signing key:", err)
+        }
+        if key.Private == nil {
+            log.Fatalf("%s does not contain a private key", keyFile)
+        }
+        if !strings.EqualFold(key.Algorithm, algorithm) {
+            log.Fatalf("%s holds a %s key but JWT_SIGNING_ALG is %s", keyFile, key.Algorithm, algorithm)
+        }
+        signing = key
+    default:
+        log.Fatalf("Unsupported JWT_SIGNING_ALG %q", algorithm)
+    }
+
+    var verification []*SigningKey
+    for _, file := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+        if file = strings.TrimSpace(file); file == "" {
+            continue
+        }
+        key, err := LoadSigningKey(file)
+        if err != nil {
+            log.Fatal("Failed to load verification key:", err)
+        }
+        verification = append(verification, key)
+    }
+
+    tokens, err := NewTokenService(signing, verification)
+    if err != nil {
+        log.Fatal("Failed to initialize token service:", err)
+    }
+    Tokens = tokens
+
+    log.Printf("Token service signing with %s key %s, %d verification key(s)", signing.Algorithm, signing.ID, len(tokens.keys))
+}
+
+func (s *TokenService) Sign(claims jwt.Claims) (string, error) {
+    var method jwt.SigningMethod
+    switch s.signing.Algorithm {
+    case "HS256":
+        method = jwt.SigningMethodHS256
+    case "RS256":
+        method = jwt.SigningMethodRS256
+    case "EdDSA":
+        method = jwt.SigningMethodEdDSA
+    default:
+        return "", fmt.Errorf("unsupported signing algorithm %s", s.signing.Algorithm)
+    }
+
+    token := jwt.NewWithClaims(method, claims)
+    token.Header["kid"] = s.signing.ID
+    return token.SignedString(s.signing.Private)
+}
+
+// Parse verifies tokenString into claims. The key is chosen by the kid
+// header and the token's alg must match that key, so a token can never pick
+// a weaker algorithm than the one its key was issued for.
+func (s *TokenService) Parse(tokenString string, claims jwt.Claims) error {
+    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        kid, _ := token.Header["kid"].(string)
+        key, ok := s.keys[kid]
+        if !ok {
+            return nil, fmt.Errorf("unknown signing key %q", kid)
+        }
+        if token.Method.Alg() != key.Algorithm {
+            return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+        }
+        return key.Public, nil
+    })
+    if err != nil {
+        return err
+    }
+    if !token.Valid {
+        return fmt.Errorf("invalid token")
+    }
+    return nil
+}
+
+// JWKS returns the public half of every asymmetric key in JSON Web Key Set
+// form. Symmetric keys are never published.
+func (s *TokenService) JWKS() map[string]interface{} {
+    keys := []map[string]string{}
+    for _, key := range s.keys {
+        if jwk := publicJWK(key); jwk != nil {
+            keys = append(keys, jwk)
+        }
+    }
+    return map[string]interface{}{"keys": keys}
+}
+
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+    switch strings.ToUpper(algorithm) {
+    case "RS256":
+        private, err := rsa.GenerateKey(rand.Reader, 2048)
+        if err != nil {
+            return nil, err
+        }
+        return newAsymmetricKey(private)
+    case "EDDSA":
+        _, private, err := ed25519.GenerateKey(rand.Reader)
+        if err != nil {
+            return nil, err
+        }
+        return newAsymmetricKey(private)
+    }
+    return nil, fmt.Errorf("cannot generate a key for %s", algorithm)
+}
+
+// LoadSigningKey reads an RSA or Ed25519 key from a PEM file. Public keys
+// are accepted for verification-only use.
+func LoadSigningKey(path string) (*SigningKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, fmt.Errorf("%s is not PEM encoded", path)
+    }
+
+    switch block.Type {
+    case "RSA PRIVATE KEY":
+        private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+        if err != nil {
+            return nil, fmt.Errorf("error parsing %s: %v", path, err)
+        }
+        return newAsymmetricKey(private)
+    case "PRIVATE KEY":
+        private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+        if err != nil {
+            return nil, fmt.Errorf("error parsing %s: %v", path, err)
+        }
+        return newAsymmetricKey(private)
+    case "PUBLIC KEY":
+        public, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+            return nil, fmt.Errorf("error parsing %s: %v", path, err)
+        }
+        return newAsymmetricKey(public)
+    }
+    return nil, fmt.Errorf("%s has unsupported PEM block %q", path, block.Type)
+}
+
+// newAsymmetricKey wraps a private or public key, deriving its kid from the
+// RFC 7638 thumbprint so every replica computes the same ID for a key.
+func newAsymmetricKey(key interface{}) (*SigningKey, error) {
+    signingKey := &SigningKey{}
+    switch k := key.(type) {
+    case *rsa.PrivateKey:
+        signingKey.Algorithm, signingKey.Private, signingKey.Public = "RS256", k, &k.PublicKey
+    case *rsa.PublicKey:
+        signingKey.Algorithm, signingKey.Public = "RS256", k
+    case ed25519.PrivateKey:
+        signingKey.Algorithm, signingKey.Private, signingKey.Public = "EdDSA", k, k.Public()
+    case ed25519.PublicKey:
+        signingKey.Algorithm, signingKey.Public = "EdDSA", k
+    default:
+        return nil, fmt.Errorf("unsupported key type %T", key)
+    }
+
+    jwk := publicJWK(signingKey)
+    var canonical []byte
+    if signingKey.Algorithm == "RS256" {
+        canonical, _ = json.Marshal(struct {
+            E   string `json:"e"`
+            Kty string `json:"kty"`
+            N   string `json:"n"`
+        }{jwk["e"], jwk["kty"], jwk["n"]})
+    } else {
+        canonical, _ = json.Marshal(struct {
+            Crv string `json:"crv"`
+            Kty string `json:"kty"`
+            X   string `json:"x"`
+        }{jwk["crv"], jwk["kty"], jwk["x"]})
+    }
+    sum := sha256.Sum256(canonical)
+    signingKey.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+
+    return signingKey, nil
+}
+
+func publicJWK(key *SigningKey) map[string]string {
+    switch public := key.Public.(type) {
+    case *rsa.PublicKey:
+        return map[string]string{
+            "kty": "RSA",
+            "use": "sig",
+            "alg": "RS256",
+            "kid": key.ID,
+            "n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+            "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+        }
+    case ed25519.PublicKey:
+        return map[string]string{
+            "kty": "OKP",
+            "crv": "Ed25519",
+            "use": "sig",
+            "alg": "EdDSA",
+            "kid": key.ID,
+            "x":   base64.RawURLEncoding.EncodeToString(public),
+        }
+    }
+    return nil
+}
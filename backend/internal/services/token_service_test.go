@@ -0,0 +1,187 @@
+package services
+
+import (
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/pem"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/golang-jwt/jwt/v4"
+)
+
+func newTestTokenService(t *testing.T, signing *SigningKey, verification ...*SigningKey) *TokenService {
+    t.Helper()
+    tokens, err := NewTokenService(signing, verification)
+    if err != nil {
+        t.Fatalf("creating token service: %v", err)
+    }
+    return tokens
+}
+
+func generateKey(t *testing.T, algorithm string) *SigningKey {
+    t.Helper()
+    key, err := GenerateSigningKey(algorithm)
+    if err != nil {
+        t.Fatalf("generating %s key: %v", algorithm, err)
+    }
+    return key
+}
+
+func testClaims() *jwt.RegisteredClaims {
+    return &jwt.RegisteredClaims{Subject: "user-1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func TestTokenServiceSignAndParse(t *testing.T) {
+    keys := map[string]*SigningKey{
+        "HS256": {ID: "hs256", Algorithm: "HS256", Private: []byte("secret"), Public: []byte("secret")},
+        "RS256": generateKey(t, "RS256"),
+        "EdDSA": generateKey(t, "EdDSA"),
+    }
+
+    for algorithm, key := range keys {
+        t.Run(algorithm, func(t *testing.T) {
+            tokens := newTestTokenService(t, key)
+            signed, err := tokens.Sign(testClaims())
+            if err != nil {
+                t.Fatalf("signing: %v", err)
+            }
+
+            parsed, _, err := new(jwt.Parser).ParseUnverified(signed, &jwt.RegisteredClaims{})
+            if err != nil {
+                t.Fatalf("decoding header: %v", err)
+            }
+            if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != algorithm {
+                t.Errorf("unexpected header %v", parsed.Header)
+            }
+
+            var claims jwt.RegisteredClaims
+            if err := tokens.Parse(signed, &claims); err != nil {
+                t.Fatalf("parsing: %v", err)
+            }
+            if claims.Subject != "user-1" {
+                t.Errorf("subject = %q", claims.Subject)
+            }
+        })
+    }
+}
+
+func TestTokenServiceRotation(t *testing.T) {
+    old, current := generateKey(t, "RS256"), generateKey(t, "EdDSA")
+    oldToken, _ := newTestTokenService(t, old).Sign(testClaims())
+
+    // The old key stays valid for verification after the rotation
+    rotated := newTestTokenService(t, current, &SigningKey{ID: old.ID, Algorithm: old.Algorithm, Public: old.Public})
+    if err := rotated.Parse(oldToken, &jwt.RegisteredClaims{}); err != nil {
+        t.Errorf("token from the previous key: %v", err)
+    }
+
+    // Once it's dropped, tokens it signed are rejected
+    if err := newTestTokenService(t, current).Parse(oldToken, &jwt.RegisteredClaims{}); err == nil {
+        t.Error("token from a removed key was accepted")
+    }
+}
+
+func TestTokenServiceRejectsForgedTokens(t *testing.T) {
+    key := generateKey(t, "RS256")
+    tokens := newTestTokenService(t, key)
+
+    t.Run("unknown kid", func(t *testing.T) {
+        other, _ := newTestTokenService(t, generateKey(t, "RS256")).Sign(testClaims())
+        if err := tokens.Parse(other, &jwt.RegisteredClaims{}); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+            t.Errorf("got %v, want an unknown key error", err)
+        }
+    })
+
+    // HS256 keyed with the published RSA public key must not pass for the
+    // RSA key named in kid
+    t.Run("algorithm confusion", func(t *testing.T) {
+        der, _ := x509.MarshalPKIXPublicKey(key.Public)
+        forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+        forged.Header["kid"] = key.ID
+        signed, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+        if err != nil {
+            t.Fatalf("signing: %v", err)
+        }
+        if err := tokens.Parse(signed, &jwt.RegisteredClaims{}); err == nil {
+            t.Error("forged HS256 token was accepted")
+        }
+    })
+}
+
+func TestNewTokenServiceRequiresPrivateKey(t *testing.T) {
+    key := generateKey(t, "EdDSA")
+    if _, err := NewTokenService(nil, nil); err == nil {
+        t.Error("missing signing key should fail")
+    }
+    if _, err := NewTokenService(&SigningKey{ID: key.ID, Algorithm: key.Algorithm, Public: key.Public}, nil); err == nil {
+        t.Error("public-only signing key should fail")
+    }
+}
+
+func TestJWKS(t *testing.T) {
+    rsaKey, edKey := generateKey(t, "RS256"), generateKey(t, "EdDSA")
+    hmacKey := &SigningKey{ID: "hs256", Algorithm: "HS256", Private: []byte("secret"), Public: []byte("secret")}
+    jwks := newTestTokenService(t, hmacKey, rsaKey, edKey).JWKS()
+
+    keys := jwks["keys"].([]map[string]string)
+    if len(keys) != 2 {
+        t.Fatalf("want the two asymmetric keys, got %v", keys)
+    }
+    for _, jwk := range keys {
+        if jwk["kid"] != rsaKey.ID && jwk["kid"] != edKey.ID {
+            t.Errorf("unexpected kid %q", jwk["kid"])
+        }
+        for _, private := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+            if _, ok := jwk[private]; ok {
+                t.Errorf("JWK %s exposes private member %q", jwk["kid"], private)
+            }
+        }
+    }
+}
+
+func TestLoadSigningKey(t *testing.T) {
+    dir := t.TempDir()
+    write := func(name, blockType string, der []byte) string {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+            t.Fatalf("writing %s: %v", name, err)
+        }
+        return path
+    }
+
+    rsaKey := generateKey(t, "RS256")
+    edKey := generateKey(t, "EdDSA")
+    pkcs8, _ := x509.MarshalPKCS8PrivateKey(edKey.Private)
+    public, _ := x509.MarshalPKIXPublicKey(rsaKey.Public)
+
+    tests := []struct {
+        path      string
+        want      *SigningKey
+        isPrivate bool
+    }{
+        {write("rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey.Private.(*rsa.PrivateKey))), rsaKey, true},
+        {write("ed25519.pem", "PRIVATE KEY", pkcs8), edKey, true},
+        {write("rsa.pub", "PUBLIC KEY", public), rsaKey, false},
+    }
+    for _, tt := range tests {
+        key, err := LoadSigningKey(tt.path)
+        if err != nil {
+            t.Fatalf("loading %s: %v", tt.path, err)
+        }
+        // The kid is a thumbprint of the public key, so it is the same
+        // however the key was stored
+        if key.ID != tt.want.ID || key.Algorithm != tt.want.Algorithm || (key.Private != nil) != tt.isPrivate {
+            t.Errorf("%s: got %s %s, want %s %s", filepath.Base(tt.path), key.Algorithm, key.ID, tt.want.Algorithm, tt.want.ID)
+        }
+    }
+
+    if _, err := LoadSigningKey(write("cert.pem", "CERTIFICATE", []byte("x"))); err == nil {
+        t.Error("unsupported PEM block should fail")
+    }
+    if _, err := GenerateSigningKey("HS256"); err == nil {
+        t.Error("HS256 keys can't be generated")
+    }
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+    "net/url"
+    "regexp"
+    "testing"
+    "time"
+)
+
+// The SHA-1 key from RFC 6238 appendix B, "12345678901234567890"
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+    tests := []struct {
+        name string
+        code string
+        at   int64
+        step int64
+        ok   bool
+    }{
+        {"RFC vector at 59", "287082", 59, 1, true},
+        {"RFC vector at 1111111109", "081804", 1111111109, 37037036, true},
+        {"spaces are ignored", "287 082", 59, 1, true},
+        {"previous step", "287082", 89, 1, true},
+        {"next step", "081804", 1111111109 - 30, 37037036, true},
+        {"outside the window", "287082", 120, 0, false},
+        {"wrong code", "287083", 59, 0, false},
+        {"wrong length", "94287082", 59, 0, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            step, ok := ValidateTOTP(rfcTOTPSecret, tt.code, time.Unix(tt.at, 0))
+            if ok != tt.ok || step != tt.step {
+                t.Errorf("ValidateTOTP(%q, %d) = %d, %v, want %d, %v", tt.code, tt.at, step, ok, tt.step, tt.ok)
+            }
+        })
+    }
+
+    if _, ok := ValidateTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+        t.Error("an invalid secret should never validate")
+    }
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+    secret, err := GenerateTOTPSecret()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    key, err := totpEncoding.DecodeString(secret)
+    if err != nil || len(key) != 20 {
+        t.Errorf("secret %q should be 20 bytes of unpadded base32", secret)
+    }
+
+    now := time.Now()
+    if _, ok := ValidateTOTP(secret, hotp(key, now.Unix()/totpPeriod), now); !ok {
+        t.Error("the current code for a new secret didn't validate")
+    }
+}
+
+func TestTOTPURI(t *testing.T) {
+    uri, err := url.Parse(TOTPURI("TaskAI", "sam@example.com", rfcTOTPSecret))
+    if err != nil {
+        t.Fatalf("invalid URI: %v", err)
+    }
+    if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/TaskAI:sam@example.com" {
+        t.Errorf("unexpected URI %s", uri)
+    }
+    q := uri.Query()
+    if q.Get("secret") != rfcTOTPSecret || q.Get("issuer") != "TaskAI" || q.Get("digits") != "6" || q.Get("period") != "30" {
+        t.Errorf("unexpected parameters %v", q)
+    }
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+    codes, hashes, err := GenerateRecoveryCodes()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+        t.Fatalf("got %d codes and %d hashes", len(codes), len(hashes))
+    }
+
+    format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+    seen := map[string]bool{}
+    for i, code := range codes {
+        if !format.MatchString(code) {
+            t.Errorf("code %q is not formatted as xxxx-xxxx-xxxx-xxxx", code)
+        }
+        if seen[code] {
+            t.Errorf("code %q generated twice", code)
+        }
+        seen[code] = true
+        if hashes[i] != HashRecoveryCode(code) {
+            t.Errorf("hash %d doesn't match its code", i)
+        }
+    }
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+    want := HashRecoveryCode("abcd-efgh-ijkl-mnop")
+    for _, code := range []string{"ABCD-EFGH-IJKL-MNOP", " abcdefghijklmnop ", "abcd-efghijkl-mnop"} {
+        if HashRecoveryCode(code) != want {
+            t.Errorf("%q should hash like the canonical form", code)
+        }
+    }
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+    "context"
+    "log"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+)
+
+const (
+    trashPurgeInterval  = time.Hour
+    trashPurgeBatchSize = 1000
+)
+
+// TrashRetention is how long deleted tasks stay restorable, configured by
+// TASK_TRASH_RETENTION and defaulting to 30 days.
+func TrashRetention() time.Duration {
+    return envDuration("TASK_TRASH_RETENTION", 30*24*time.Hour)
+}
+
+// RunTrashPurge permanently removes expired tasks from the trash until the
+// process exits. Purging is idempotent, so every replica can run it.
+func RunTrashPurge() {
+    ticker := time.NewTicker(trashPurgeInterval)
+    defer ticker.Stop()
+
+    for {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+        purged, err := PurgeTrash(ctx, time.Now().Add(-TrashRetention()))
+        cancel()
+        if err != nil {
+            log.Printf("Error purging trash: %v", err)
+        } else if purged > 0 {
+            log.Printf("Purged %d task(s) from the trash", purged)
+        }
+        <-ticker.C
+    }
+}
+
+// PurgeTrash deletes tasks trashed before cutoff along with their subtasks
+// and AI suggestions, and returns how many tasks were removed.
+func PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+    var purged int64
+
+    for {
+        ids, err := taskIDs(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}}, trashPurgeBatchSize)
+        if err != nil {
+            return purged, err
+        }
+        if len(ids) == 0 {
+            return purged, nil
+        }
+
+        removed, err := purgeTasks(ctx, ids, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+        purged += removed
+        if err != nil {
+            return purged, err
+        }
+
+        if len(ids) < trashPurgeBatchSize {
+            return purged, nil
+        }
+    }
+}
+
+// PurgeTasks permanently deletes the tasks matching filter along with their
+// subtasks and AI suggestions, and returns how many tasks were removed.
+func PurgeTasks(ctx context.Context, filter bson.M) (int64, error) {
+    ids, err := taskIDs(ctx, filter, 0)
+    if err != nil || len(ids) == 0 {
+        return 0, err
+    }
+    return purgeTasks(ctx, ids, filter)
+}
+
+// purgeTasks deletes the tasks in ids that still match filter, then works
+// down through their subtasks. Trashed subtasks go with their parent; ones
+// restored on their own are kept and moved to the top level. Suggestions
+// are only removed for tasks that were actually deleted.
+func purgeTasks(ctx context.Context, ids []primitive.ObjectID, filter bson.M) (int64, error) {
+    tasks := database.GetCollection("tasks")
+    var purged int64
+
+    for len(ids) > 0 {
+        // Re-check filter in case a task was restored in the meantime
+        query := bson.M{"_id": bson.M{"$in": ids}}
+        for key, value := range filter {
+            query[key] = value
+        }
+        result, err := tasks.DeleteMany(ctx, query)
+        if err != nil {
+            return purged, err
+        }
+        purged += result.DeletedCount
+
+        kept, err := taskIDs(ctx, bson.M{"_id": bson.M{"$in": ids}}, 0)
+        if err != nil {
+            return purged, err
+        }
+        deleted := withoutIDs(ids, kept)
+        if len(deleted) == 0 {
+            return purged, nil
+        }
+
+        if _, err := database.GetCollection("ai_suggestions").DeleteMany(ctx, bson.M{"task_id": bson.M{"$in": deleted}}); err != nil {
+            return purged, err
+        }
+        _, err = tasks.UpdateMany(ctx,
+            bson.M{"parent_id": bson.M{"$in": deleted}, "deleted_at": nil},
+            bson.M{"$unset": bson.M{"parent_id": ""}, "$set": bson.M{"updated_at": time.Now()}},
+        )
+        if err != nil {
+            return purged, err
+        }
+
+        ids, err = taskIDs(ctx, bson.M{"parent_id": bson.M{"$in": deleted}}, 0)
+        if err != nil {
+            return purged, err
+        }
+        filter = bson.M{"deleted_at": bson.M{"$ne": nil}}
+    }
+    return purged, nil
+}
+
+// TrashTasks moves the live tasks matching filter to the trash together
+// with their subtasks. Subtasks get the same deleted_at as their parent so
+// RestoreSubtasks can bring them back with it. It returns how many tasks
+// matched filter.
+func TrashTasks(ctx context.Context, filter bson.M, userID primitive.ObjectID) (int64, error) {
+    query := bson.M{"deleted_at": nil}
+    for key, value := range filter {
+        query[key] = value
+    }
+    ids, err := taskIDs(ctx, query, 0)
+    if err != nil || len(ids) == 0 {
+        return 0, err
+    }
+
+    tasks := database.GetCollection("tasks")
+    trash := bson.M{"$set": bson.M{"deleted_at": time.Now(), "deleted_by": userID}}
+    var trashed int64
+
+    for level := 0; len(ids) > 0; level++ {
+        result, err := tasks.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": nil}, trash)
+        if err != nil {
+            return trashed, err
+        }
+        if level == 0 {
+            trashed = result.ModifiedCount
+        }
+
+        ids, err = taskIDs(ctx, bson.M{"parent_id": bson.M{"$in": ids}, "deleted_at": nil}, 0)
+        if err != nil {
+            return trashed, err
+        }
+    }
+    return trashed, nil
+}
+
+// RestoreSubtasks takes the subtasks that were trashed along with parentID
+// at deletedAt back out of the trash.
+func RestoreSubtasks(ctx context.Context, parentID primitive.ObjectID, deletedAt time.Time) error {
+    tasks := database.GetCollection("tasks")
+    restore := bson.M{
+        "$set":   bson.M{"updated_at": time.Now()},
+        "$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+    }
+
+    parents := []primitive.ObjectID{parentID}
+    for len(parents) > 0 {
+        ids, err := taskIDs(ctx, bson.M{"parent_id": bson.M{"$in": parents}, "deleted_at": deletedAt}, 0)
+        if err != nil || len(ids) == 0 {
+            return err
+        }
+        if _, err := tasks.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": deletedAt}, restore); err != nil {
+            return err
+        }
+        parents = ids
+    }
+    return nil
+}
+
+// taskIDs returns the IDs of up to limit tasks matching filter, or all of
+// them when limit is 0.
+func taskIDs(ctx context.Context, filter bson.M, limit int64) ([]primitive.ObjectID, error) {
+    cursor, err := database.GetCollection("tasks").Find(ctx, filter,
+        options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(limit),
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    var docs []struct {
+        ID primitive.ObjectID `bson:"_id"`
+    }
+    if err := cursor.All(ctx, &docs); err != nil {
+        return nil, err
+    }
+
+    ids := make([]primitive.ObjectID, 0, len(docs))
+    for _, doc := range docs {
+        ids = append(ids, doc.ID)
+    }
+    return ids, nil
+}
+
+func withoutIDs(ids, remove []primitive.ObjectID) []primitive.ObjectID {
+    skip := make(map[primitive.ObjectID]bool, len(remove))
+    for _, id := range remove {
+        skip[id] = true
+    }
+
+    var kept []primitive.ObjectID
+    for _, id := range ids {
+        if !skip[id] {
+            kept = append(kept, id)
+        }
+    }
+    return kept
+}
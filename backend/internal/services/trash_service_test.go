@@ -0,0 +1,152 @@
+package services
+
+import (
+    "context"
+    "reflect"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+func TestWithoutIDs(t *testing.T) {
+    a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+    if got := withoutIDs([]primitive.ObjectID{a, b, c}, []primitive.ObjectID{b}); !reflect.DeepEqual(got, []primitive.ObjectID{a, c}) {
+        t.Errorf("got %v", got)
+    }
+    if got := withoutIDs([]primitive.ObjectID{a}, []primitive.ObjectID{a}); len(got) != 0 {
+        t.Errorf("got %v, want none", got)
+    }
+}
+
+func TestTrashRetention(t *testing.T) {
+    t.Setenv("TASK_TRASH_RETENTION", "")
+    if got := TrashRetention(); got != 30*24*time.Hour {
+        t.Errorf("default = %s", got)
+    }
+    t.Setenv("TASK_TRASH_RETENTION", "72h")
+    if got := TrashRetention(); got != 72*time.Hour {
+        t.Errorf("configured = %s", got)
+    }
+}
+
+// insertTaskTree stores a parent with a child and a grandchild, all created
+// by owner, and returns their IDs.
+func insertTaskTree(t *testing.T, owner primitive.ObjectID) (primitive.ObjectID, primitive.ObjectID, primitive.ObjectID) {
+    t.Helper()
+    parent, child, grandchild := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+    _, err := database.GetCollection("tasks").InsertMany(context.Background(), []interface{}{
+        models.Task{ID: parent, Title: "Parent", CreatedBy: owner},
+        models.Task{ID: child, Title: "Child", CreatedBy: owner, ParentID: &parent},
+        models.Task{ID: grandchild, Title: "Grandchild", CreatedBy: owner, ParentID: &child},
+    })
+    if err != nil {
+        t.Fatalf("inserting tasks: %v", err)
+    }
+    return parent, child, grandchild
+}
+
+func loadTask(t *testing.T, id primitive.ObjectID) *models.Task {
+    t.Helper()
+    var task models.Task
+    if err := database.GetCollection("tasks").FindOne(context.Background(), bson.M{"_id": id}).Decode(&task); err != nil {
+        return nil
+    }
+    return &task
+}
+
+func TestTrashAndRestoreSubtasks(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    owner := primitive.NewObjectID()
+    parent, child, grandchild := insertTaskTree(t, owner)
+
+    trashed, err := TrashTasks(ctx, bson.M{"_id": parent, "created_by": owner}, owner)
+    if err != nil || trashed != 1 {
+        t.Fatalf("trashing: %d, %v", trashed, err)
+    }
+
+    deletedAt := loadTask(t, parent).DeletedAt
+    for _, id := range []primitive.ObjectID{child, grandchild} {
+        task := loadTask(t, id)
+        if task.DeletedAt == nil || !task.DeletedAt.Equal(*deletedAt) || *task.DeletedBy != owner {
+            t.Errorf("%s was not trashed with its parent: %+v", task.Title, task)
+        }
+    }
+
+    if trashed, _ := TrashTasks(ctx, bson.M{"_id": parent}, owner); trashed != 0 {
+        t.Errorf("trashing a trashed task reported %d", trashed)
+    }
+
+    if err := RestoreSubtasks(ctx, parent, *deletedAt); err != nil {
+        t.Fatalf("restoring: %v", err)
+    }
+    for _, id := range []primitive.ObjectID{child, grandchild} {
+        if task := loadTask(t, id); task.DeletedAt != nil || task.DeletedBy != nil {
+            t.Errorf("%s is still in the trash", task.Title)
+        }
+    }
+}
+
+func TestRestoreSubtasksLeavesSeparatelyDeletedTasks(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    owner := primitive.NewObjectID()
+    parent, child, _ := insertTaskTree(t, owner)
+
+    TrashTasks(ctx, bson.M{"_id": child}, owner)
+    time.Sleep(10 * time.Millisecond)
+    TrashTasks(ctx, bson.M{"_id": parent}, owner)
+
+    if err := RestoreSubtasks(ctx, parent, *loadTask(t, parent).DeletedAt); err != nil {
+        t.Fatalf("restoring: %v", err)
+    }
+    if loadTask(t, child).DeletedAt == nil {
+        t.Error("a subtask deleted on its own earlier was restored with the parent")
+    }
+}
+
+func TestPurgeTrash(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    owner := primitive.NewObjectID()
+    parent, child, grandchild := insertTaskTree(t, owner)
+    recent := primitive.NewObjectID()
+
+    tasks := database.GetCollection("tasks")
+    tasks.InsertOne(ctx, models.Task{ID: recent, Title: "Recent", CreatedBy: owner})
+    TrashTasks(ctx, bson.M{"_id": bson.M{"$in": []primitive.ObjectID{parent, recent}}}, owner)
+
+    // The grandchild was restored on its own and must survive the purge
+    tasks.UpdateOne(ctx, bson.M{"_id": grandchild}, bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}})
+    expired := time.Now().Add(-48 * time.Hour)
+    tasks.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": []primitive.ObjectID{parent, child}}}, bson.M{"$set": bson.M{"deleted_at": expired}})
+
+    suggestions := database.GetCollection("ai_suggestions")
+    for _, id := range []primitive.ObjectID{parent, child, grandchild, recent} {
+        suggestions.InsertOne(ctx, bson.M{"task_id": id})
+    }
+
+    purged, err := PurgeTrash(ctx, time.Now().Add(-24*time.Hour))
+    if err != nil || purged != 2 {
+        t.Fatalf("purging: %d, %v", purged, err)
+    }
+
+    for _, id := range []primitive.ObjectID{parent, child} {
+        if loadTask(t, id) != nil {
+            t.Errorf("task %s was not purged", id.Hex())
+        }
+    }
+    if task := loadTask(t, grandchild); task == nil || task.ParentID != nil {
+        t.Errorf("restored subtask should be kept at the top level: %+v", task)
+    }
+    if loadTask(t, recent) == nil {
+        t.Error("a task inside the retention period was purged")
+    }
+
+    if n, _ := suggestions.CountDocuments(ctx, bson.M{}); n != 2 {
+        t.Errorf("want suggestions for the two remaining tasks, found %d", n)
+    }
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "log"
+    "os"
+    "strings"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// UserAccess is the slice of a user record that authorization decisions
+// need, loaded on every authenticated request.
+type UserAccess struct {
+    Role     string `bson:"role"`
+    Disabled bool   `bson:"disabled"`
+}
+
+func GetUserAccess(ctx context.Context, userID primitive.ObjectID) (*UserAccess, error) {
+    var access UserAccess
+    err := database.GetCollection("users").FindOne(ctx,
+        bson.M{"_id": userID},
+        options.FindOne().SetProjection(bson.M{"role": 1, "disabled": 1}),
+    ).Decode(&access)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrUserNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    // Accounts created before roles existed have no role field
+    if access.Role == "" {
+        access.Role = models.RoleUser
+    }
+    return &access, nil
+}
+
+// PromoteListedAdmin makes the user an admin when their address is listed in
+// ADMIN_EMAILS, which seeds the first administrators. Only verified addresses
+// qualify, so registering with a listed address is not enough on its own.
+func PromoteListedAdmin(ctx context.Context, userID primitive.ObjectID) error {
+    emails := adminEmails()
+    if len(emails) == 0 {
+        return nil
+    }
+
+    result, err := database.GetCollection("users").UpdateOne(ctx,
+        bson.M{
+            "_id":            userID,
+            "email":          bson.M{"$in": emails},
+            "email_verified": true,
+            "role":           bson.M{"$ne": models.RoleAdmin},
+        },
+        bson.M{"$set": bson.M{"role": models.RoleAdmin}},
+    )
+    if err != nil {
+        return err
+    }
+    if result.ModifiedCount > 0 {
+        log.Printf("Promoted user %s from ADMIN_EMAILS to admin", userID.Hex())
+    }
+    return nil
+}
+
+// EnsureAdmins promotes existing verified accounts listed in ADMIN_EMAILS at
+// startup.
+func EnsureAdmins() {
+    emails := adminEmails()
+    if len(emails) == 0 {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    result, err := database.GetCollection("users").UpdateMany(ctx,
+        bson.M{"email": bson.M{"$in": emails}, "email_verified": true, "role": bson.M{"$ne": models.RoleAdmin}},
+        bson.M{"$set": bson.M{"role": models.RoleAdmin}},
+    )
+    if err != nil {
+        log.Printf("Error promoting admin users: %v", err)
+        return
+    }
+    if result.ModifiedCount > 0 {
+        log.Printf("Promoted %d user(s) from ADMIN_EMAILS to admin", result.ModifiedCount)
+    }
+}
+
+func adminEmails() []string {
+    var emails []string
+    for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+        if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+            emails = append(emails, email)
+        }
+    }
+    return emails
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+    "context"
+    "reflect"
+    "testing"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+func TestAdminEmails(t *testing.T) {
+    t.Setenv("ADMIN_EMAILS", " Root@Example.com,, ops@example.com ")
+    want := []string{"root@example.com", "ops@example.com"}
+    if got := adminEmails(); !reflect.DeepEqual(got, want) {
+        t.Errorf("got %v, want %v", got, want)
+    }
+
+    t.Setenv("ADMIN_EMAILS", "")
+    if got := adminEmails(); len(got) != 0 {
+        t.Errorf("got %v, want none", got)
+    }
+}
+
+func TestGetUserAccess(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+
+    // Accounts from before roles were added have no role field at all
+    id := primitive.NewObjectID()
+    if _, err := database.GetCollection("users").InsertOne(ctx, bson.M{"_id": id, "email": "old@example.com", "disabled": true}); err != nil {
+        t.Fatalf("inserting user: %v", err)
+    }
+
+    access, err := GetUserAccess(ctx, id)
+    if err != nil {
+        t.Fatalf("loading access: %v", err)
+    }
+    if access.Role != models.RoleUser || !access.Disabled {
+        t.Errorf("got %+v", access)
+    }
+
+    if _, err := GetUserAccess(ctx, primitive.NewObjectID()); err != ErrUserNotFound {
+        t.Errorf("missing user: got %v, want ErrUserNotFound", err)
+    }
+}
+
+func TestPromoteListedAdmin(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    t.Setenv("ADMIN_EMAILS", "root@example.com,ops@example.com")
+
+    users := database.GetCollection("users")
+    verified, unverified := primitive.NewObjectID(), primitive.NewObjectID()
+    users.InsertOne(ctx, models.User{ID: verified, Email: "root@example.com", EmailVerified: true, Role: models.RoleUser})
+    users.InsertOne(ctx, models.User{ID: unverified, Email: "ops@example.com", Role: models.RoleUser})
+
+    for _, id := range []primitive.ObjectID{verified, unverified} {
+        if err := PromoteListedAdmin(ctx, id); err != nil {
+            t.Fatalf("promoting: %v", err)
+        }
+    }
+
+    if access, _ := GetUserAccess(ctx, verified); access.Role != models.RoleAdmin {
+        t.Errorf("verified listed address: role %q, want admin", access.Role)
+    }
+    if access, _ := GetUserAccess(ctx, unverified); access.Role != models.RoleUser {
+        t.Errorf("unverified address must not be promoted, role %q", access.Role)
+    }
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "task-management/internal/database"
+    "task-management/internal/models"
+)
+
+const userTokenCollection = "user_tokens"
+
+var ErrUserTokenInvalid = errors.New("invalid or expired token")
+
+// CreateUserToken issues a new single-use token for purpose and invalidates
+// any earlier unused ones, so only the most recent email link works.
+func CreateUserToken(ctx context.Context, userID primitive.ObjectID, purpose string, ttl time.Duration) (string, error) {
+    raw, err := GenerateOpaqueToken()
+    if err != nil {
+        return "", err
+    }
+
+    collection := database.GetCollection(userTokenCollection)
+    now := time.Now()
+
+    _, err = collection.UpdateMany(ctx,
+        bson.M{"user_id": userID, "purpose": purpose, "used_at": nil},
+        bson.M{"$set": bson.M{"used_at": now}},
+    )
+    if err != nil {
+        return "", fmt.Errorf("error invalidating previous tokens: %v", err)
+    }
+
+    _, err = collection.InsertOne(ctx, models.UserToken{
+        ID:        primitive.NewObjectID(),
+        UserID:    userID,
+        Purpose:   purpose,
+        TokenHash: HashToken(raw),
+        ExpiresAt: now.Add(ttl),
+        CreatedAt: now,
+    })
+    if err != nil {
+        return "", fmt.Errorf("error storing token: %v", err)
+    }
+    return raw, nil
+}
+
+// ConsumeUserToken marks the token used and returns it. A token can only be
+// consumed once, even by concurrent requests.
+func ConsumeUserToken(ctx context.Context, raw string, purpose string) (*models.UserToken, error) {
+    var token models.UserToken
+    err := database.GetCollection(userTokenCollection).FindOneAndUpdate(ctx,
+        bson.M{
+            "token_hash": HashToken(raw),
+            "purpose":    purpose,
+            "used_at":    nil,
+            "expires_at": bson.M{"$gt": time.Now()},
+        },
+        bson.M{"$set": bson.M{"used_at": time.Now()}},
+    ).Decode(&token)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrUserTokenInvalid
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &token, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/models"
+)
+
+func TestRenderAccountMail(t *testing.T) {
+    tests := []struct {
+        template string
+        data     map[string]string
+        link     string
+    }{
+        {"password_reset", map[string]string{"Name": "Sam", "ExpiresIn": "1 hour", "ResetURL": "http://app.test/reset-password?token=abc"}, "http://app.test/reset-password?token=abc"},
+        {"email_verification", map[string]string{"Name": "Sam", "Email": "sam@example.com", "ExpiresIn": "24 hours", "VerifyURL": "http://app.test/verify-email?token=abc"}, "http://app.test/verify-email?token=abc"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.template, func(t *testing.T) {
+            msg, err := RenderMail(tt.template, tt.data)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if !strings.Contains(msg.Text, tt.link) {
+                t.Errorf("plain text body is missing the link: %q", msg.Text)
+            }
+            if !strings.Contains(msg.HTML, `href="`+tt.link+`"`) {
+                t.Errorf("HTML body is missing the link: %q", msg.HTML)
+            }
+        })
+    }
+}
+
+func TestConsumeUserToken(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    userID := primitive.NewObjectID()
+
+    raw, err := CreateUserToken(ctx, userID, models.TokenPurposePasswordReset, time.Hour)
+    if err != nil {
+        t.Fatalf("creating token: %v", err)
+    }
+
+    if _, err := ConsumeUserToken(ctx, raw, models.TokenPurposeEmailVerification); err != ErrUserTokenInvalid {
+        t.Errorf("token used for another purpose: got %v, want ErrUserTokenInvalid", err)
+    }
+
+    token, err := ConsumeUserToken(ctx, raw, models.TokenPurposePasswordReset)
+    if err != nil {
+        t.Fatalf("consuming token: %v", err)
+    }
+    if token.UserID != userID {
+        t.Errorf("token belongs to %s, want %s", token.UserID.Hex(), userID.Hex())
+    }
+
+    if _, err := ConsumeUserToken(ctx, raw, models.TokenPurposePasswordReset); err != ErrUserTokenInvalid {
+        t.Errorf("second use: got %v, want ErrUserTokenInvalid", err)
+    }
+}
+
+func TestCreateUserTokenInvalidatesEarlierTokens(t *testing.T) {
+    useTestDatabase(t)
+    ctx := context.Background()
+    userID := primitive.NewObjectID()
+
+    first, _ := CreateUserToken(ctx, userID, models.TokenPurposeEmailVerification, time.Hour)
+    second, err := CreateUserToken(ctx, userID, models.TokenPurposeEmailVerification, time.Hour)
+    if err != nil {
+        t.Fatalf("creating token: %v", err)
+    }
+
+    if _, err := ConsumeUserToken(ctx, first, models.TokenPurposeEmailVerification); err != ErrUserTokenInvalid {
+        t.Errorf("earlier link: got %v, want ErrUserTokenInvalid", err)
+    }
+    if _, err := ConsumeUserToken(ctx, second, models.TokenPurposeEmailVerification); err != nil {
+        t.Errorf("latest link: %v", err)
+    }
+
+    expired, _ := CreateUserToken(ctx, userID, models.TokenPurposePasswordReset, -time.Minute)
+    if _, err := ConsumeUserToken(ctx, expired, models.TokenPurposePasswordReset); err != ErrUserTokenInvalid {
+        t.Errorf("expired token: got %v, want ErrUserTokenInvalid", err)
+    }
+}
@@ -2,18 +2,25 @@
 package services
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "log"
     "sync"
     "time"
     "github.com/gorilla/websocket"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "task-management/internal/models"
 )
 
 const (
     writeWait      = 10 * time.Second
     pongWait       = 60 * time.Second
     pingPeriod     = (pongWait * 9) / 10
-    maxMessageSize = 512
+    // Large enough for an ai_prompt message
+    maxMessageSize = 16 * 1024
+
+    maxAIStreamsPerClient = 3
 )
 
 type Client struct {
@@ -21,22 +28,35 @@ type Client struct {
     ID   string
     Conn *websocket.Conn
     Send chan []byte
+    // AllowAI is false for API tokens without the ai:use scope
+    AllowAI bool
+
+    streamsMu sync.Mutex
+    streams   map[string]context.CancelFunc
 }
 
 type Hub struct {
     Clients    map[*Client]bool
     Broadcast  chan []byte
+    Direct     chan UserMessage
     Register   chan *Client
     Unregister chan *Client
     mutex      sync.RWMutex
 }
 
+// UserMessage is delivered to every connection of one user.
+type UserMessage struct {
+    UserID  string
+    Message []byte
+}
+
 var WebsocketHub = NewHub()
 
 func NewHub() *Hub {
     return &Hub{
         Clients:    make(map[*Client]bool),
         Broadcast:  make(chan []byte),
+        Direct:     make(chan UserMessage),
         Register:   make(chan *Client),
         Unregister: make(chan *Client),
     }
@@ -61,7 +81,7 @@ func (h *Hub) Run() {
             log.Printf("Client unregistered: %s", client.ID)
 
         case message := <-h.Broadcast:
-            h.mutex.RLock()
+            h.mutex.Lock()
             for client := range h.Clients {
                 select {
                 case client.Send <- message:
@@ -70,13 +90,48 @@ func (h *Hub) Run() {
                     delete(h.Clients, client)
                 }
             }
-            h.mutex.RUnlock()
+            h.mutex.Unlock()
+
+        case direct := <-h.Direct:
+            h.mutex.Lock()
+            for client := range h.Clients {
+                if client.ID != direct.UserID {
+                    continue
+                }
+                select {
+                case client.Send <- direct.Message:
+                default:
+                    close(client.Send)
+                    delete(h.Clients, client)
+                }
+            }
+            h.mutex.Unlock()
         }
     }
 }
 
+// sendTo queues a message for one client from outside the hub goroutine. It
+// returns false when the client is gone or not keeping up.
+func (h *Hub) sendTo(client *Client, message []byte) bool {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    if !h.Clients[client] {
+        return false
+    }
+    select {
+    case client.Send <- message:
+        return true
+    default:
+        return false
+    }
+}
+
 func (c *Client) ReadPump() {
+    // Cancels any AI responses still streaming to this connection
+    ctx, cancel := context.WithCancel(context.Background())
     defer func() {
+        cancel()
         c.Hub.Unregister <- c
         c.Conn.Close()
     }()
@@ -110,6 +165,17 @@ func (c *Client) ReadPump() {
             case "ping":
                 
                 c.Send <- []byte(`{"type": "pong"}`)
+            case "ai_prompt":
+                id, _ := msg["id"].(string)
+                prompt, _ := msg["prompt"].(string)
+                streamCtx := ctx
+                if noCache, _ := msg["no_cache"].(bool); noCache {
+                    streamCtx = WithoutAICache(ctx)
+                }
+                c.startAIStream(streamCtx, id, prompt)
+            case "ai_cancel":
+                id, _ := msg["id"].(string)
+                c.cancelAIStream(id)
             default:
                 log.Printf("Received message of type %s from client %s", msgType, c.ID)
             }
@@ -152,18 +218,116 @@ func (c *Client) WritePump() {
     }
 }
 
-func BroadcastMessage(messageType string, data interface{}) {
-    message := map[string]interface{}{
+// startAIStream generates a reply to prompt and sends it to the client as
+// ai_delta messages followed by ai_done or ai_error, all tagged with id.
+// The client can stop it with an ai_cancel message carrying the same id.
+func (c *Client) startAIStream(ctx context.Context, id string, prompt string) {
+    fail := func(message string) {
+        c.sendAIMessage("ai_error", map[string]interface{}{"id": id, "error": message})
+    }
+
+    switch {
+    case id == "" || prompt == "":
+        fail("id and prompt are required")
+        return
+    case !c.AllowAI:
+        fail("API token is missing the ai:use scope")
+        return
+    case AI == nil:
+        fail("AI provider not configured")
+        return
+    }
+
+    userID, _ := primitive.ObjectIDFromHex(c.ID)
+    ctx = WithAIUsage(ctx, userID, models.AIFeatureChat)
+    if CheckAIQuota(ctx) != nil {
+        fail("Daily AI quota exceeded")
+        return
+    }
+
+    c.streamsMu.Lock()
+    if c.streams == nil {
+        c.streams = map[string]context.CancelFunc{}
+    }
+    if _, exists := c.streams[id]; exists || len(c.streams) >= maxAIStreamsPerClient {
+        c.streamsMu.Unlock()
+        fail("Too many AI requests in progress")
+        return
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    c.streams[id] = cancel
+    c.streamsMu.Unlock()
+
+    go func() {
+        defer c.cancelAIStream(id)
+
+        suggestions, err := AI.StreamResponse(ctx, prompt, func(delta string) error {
+            if !c.sendAIMessage("ai_delta", map[string]interface{}{"id": id, "text": delta}) {
+                return context.Canceled
+            }
+            return nil
+        })
+        if ctx.Err() != nil {
+            return
+        }
+        if errors.Is(err, ErrAIQuotaExceeded) || errors.Is(err, ErrLLMUnavailable) {
+            fail(err.Error())
+            return
+        }
+        if err != nil {
+            log.Printf("Error streaming AI response to %s: %v", c.ID, err)
+            fail("Failed to generate suggestions")
+            return
+        }
+        c.sendAIMessage("ai_done", map[string]interface{}{"id": id, "suggestions": suggestions})
+    }()
+}
+
+func (c *Client) cancelAIStream(id string) {
+    c.streamsMu.Lock()
+    defer c.streamsMu.Unlock()
+    if cancel, ok := c.streams[id]; ok {
+        cancel()
+        delete(c.streams, id)
+    }
+}
+
+func (c *Client) sendAIMessage(messageType string, data interface{}) bool {
+    jsonMessage, err := marshalMessage(messageType, data)
+    if err != nil {
+        log.Printf("Error marshaling message: %v", err)
+        return false
+    }
+    return c.Hub.sendTo(c, jsonMessage)
+}
+
+func marshalMessage(messageType string, data interface{}) ([]byte, error) {
+    return json.Marshal(map[string]interface{}{
         "type":      messageType,
         "data":      data,
         "timestamp": time.Now(),
-    }
+    })
+}
 
-    jsonMessage, err := json.Marshal(message)
+func BroadcastMessage(messageType string, data interface{}) {
+    jsonMessage, err := marshalMessage(messageType, data)
     if err != nil {
         log.Printf("Error marshaling message: %v", err)
         return
     }
 
     WebsocketHub.Broadcast <- jsonMessage
+}
+
+// SendToUser pushes a message to the user's open connections on this
+// instance. Clients on other replicas won't receive it, so anything sent this
+// way must also be retrievable over the REST API.
+func SendToUser(userID string, messageType string, data interface{}) {
+    jsonMessage, err := marshalMessage(messageType, data)
+    if err != nil {
+        log.Printf("Error marshaling message: %v", err)
+        return
+    }
+
+    WebsocketHub.Direct <- UserMessage{UserID: userID, Message: jsonMessage}
 }
\ No newline at end of file
@@ -22,9 +22,11 @@ interface LoginFormData {
 
 export default function LoginPage() {
     const router = useRouter();
-    const { login, user, isLoading: authLoading } = useAuth();
+    const { login, completeTwoFactor, user, isLoading: authLoading } = useAuth();
     const [isLoading, setIsLoading] = useState(false);
     const [showPassword, setShowPassword] = useState(false);
+    const [twoFactorRequired, setTwoFactorRequired] = useState(false);
+    const [code, setCode] = useState('');
     const [formData, setFormData] = useState<LoginFormData>({
         email: '',
         password: '',
@@ -63,7 +65,7 @@ export default function LoginPage() {
       setIsLoading(true);
   
       try {
-          await login(formData.email, formData.password);
+          setTwoFactorRequired(await login(formData.email, formData.password));
           
       } catch (error: any) {
           console.error('Login error:', error);
@@ -72,6 +74,25 @@ export default function LoginPage() {
           setIsLoading(false);
       }
   };
+
+    const handleCodeSubmit = async (e: React.FormEvent) => {
+        e.preventDefault();
+
+        setIsLoading(true);
+
+        try {
+            await completeTwoFactor(code.trim());
+        } catch (error: any) {
+            console.error('Two-factor error:', error);
+            setCode('');
+            // An expired challenge needs the password again
+            if (error.response?.data?.error === 'Invalid or expired challenge') {
+                setTwoFactorRequired(false);
+            }
+        } finally {
+            setIsLoading(false);
+        }
+    };
     const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
         const { name, value } = e.target;
         setFormData(prev => ({
@@ -127,7 +148,59 @@ export default function LoginPage() {
                     </p>
                 </div>
 
-                
+                {twoFactorRequired ? (
+                <form className="mt-8 space-y-6" onSubmit={handleCodeSubmit}>
+                    <div>
+                        <label htmlFor="code" className="block text-sm font-medium text-gray-700">
+                            Authentication code
+                        </label>
+                        <p className="mt-1 text-sm text-gray-500">
+                            Enter the code from your authenticator app, or one of your recovery codes.
+                        </p>
+                        <div className="mt-2 relative rounded-md shadow-sm">
+                            <div className="absolute inset-y-0 left-0 pl-3 flex items-center pointer-events-none">
+                                <LockClosedIcon className="h-5 w-5 text-gray-400" />
+                            </div>
+                            <input
+                                id="code"
+                                name="code"
+                                type="text"
+                                inputMode="text"
+                                autoComplete="one-time-code"
+                                autoFocus
+                                required
+                                value={code}
+                                onChange={(e) => setCode(e.target.value)}
+                                className="block w-full pl-10 pr-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                                placeholder="123456"
+                            />
+                        </div>
+                    </div>
+
+                    <div>
+                        <button
+                            type="submit"
+                            disabled={isLoading || !code.trim()}
+                            className="group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-lg text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:bg-blue-300 disabled:cursor-not-allowed transition-colors"
+                        >
+                            {isLoading ? 'Verifying...' : 'Verify'}
+                        </button>
+                    </div>
+
+                    <div className="text-center text-sm">
+                        <button
+                            type="button"
+                            onClick={() => {
+                                setTwoFactorRequired(false);
+                                setCode('');
+                            }}
+                            className="font-medium text-blue-600 hover:text-blue-500"
+                        >
+                            Use a different account
+                        </button>
+                    </div>
+                </form>
+                ) : (
                 <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
                     
                     <div>
@@ -251,6 +324,7 @@ export default function LoginPage() {
                         </button>
                     </div>
                 </form>
+                )}
 
                
                 <div className="mt-4 text-center">
@@ -3,8 +3,8 @@
 
 import { createContext, useContext, useState, useEffect, ReactNode } from 'react';
 import { useRouter } from 'next/navigation';
-import axios from 'axios';
 import { toast } from 'react-hot-toast';
+import { api, authApi, tokenStorage } from '@/services/api';
 
 interface User {
     id: string;
@@ -15,39 +15,38 @@ interface User {
 interface AuthContextType {
     user: User | null;
     isLoading: boolean;
-    login: (email: string, password: string) => Promise<void>;
+    // Resolves to true when the account needs a second factor, which is
+    // then passed to completeTwoFactor
+    login: (email: string, password: string) => Promise<boolean>;
+    completeTwoFactor: (code: string) => Promise<void>;
     register: (name: string, email: string, password: string) => Promise<void>;
     logout: () => Promise<void>;
 }
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
 
-const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
-
 export function AuthProvider({ children }: { children: ReactNode }) {
     const [user, setUser] = useState<User | null>(null);
     const [isLoading, setIsLoading] = useState(true);
+    const [challengeToken, setChallengeToken] = useState<string | null>(null);
     const router = useRouter();
 
     useEffect(() => {
-        const token = localStorage.getItem('token');
-        if (token) {
-            axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
-        }
         checkAuth();
     }, []);
 
+    // The api client refreshes an expired access token before giving up
     const checkAuth = async () => {
         try {
-            const token = localStorage.getItem('token');
+            const token = tokenStorage.getToken();
             if (token) {
-                const response = await axios.get(`${API_URL}/api/me`);
+                const response = await api.get('/api/me');
                 setUser(response.data.user);
                 router.push('/dashboard');
             }
         } catch (error) {
             console.error('Auth check error:', error);
-            localStorage.removeItem('token');
+            tokenStorage.clear();
             setUser(null);
             router.push('/login');
         } finally {
@@ -57,15 +56,14 @@ export function AuthProvider({ children }: { children: ReactNode }) {
 
     const register = async (name: string, email: string, password: string) => {
         try {
-            const response = await axios.post(`${API_URL}/api/register`, {
+            const response = await api.post('/api/register', {
                 name,
                 email,
                 password
             });
 
-            const { token, user } = response.data;
-            localStorage.setItem('token', token);
-            axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
+            const { token, refresh_token, user } = response.data;
+            tokenStorage.setTokens(token, refresh_token);
             setUser(user);
             toast.success('Registration successful!');
             await router.push('/dashboard');
@@ -76,19 +74,24 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         }
     };
 
+    const finishLogin = async (data: { token: string; refresh_token: string; user: User }) => {
+        tokenStorage.setTokens(data.token, data.refresh_token);
+        setChallengeToken(null);
+        setUser(data.user);
+        toast.success('Login successful!');
+        await router.push('/dashboard');
+    };
+
     const login = async (email: string, password: string) => {
         try {
-            const response = await axios.post(`${API_URL}/api/login`, {
-                email,
-                password
-            });
+            const data = await authApi.login({ email, password });
+            if (data.two_factor_required) {
+                setChallengeToken(data.challenge_token);
+                return true;
+            }
 
-            const { token, user } = response.data;
-            localStorage.setItem('token', token);
-            axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
-            setUser(user);
-            toast.success('Login successful!');
-            await router.push('/dashboard');
+            await finishLogin(data);
+            return false;
         } catch (error: any) {
             const errorMessage = error.response?.data?.error || 'Login failed';
             toast.error(errorMessage);
@@ -96,22 +99,39 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         }
     };
 
+    const completeTwoFactor = async (code: string) => {
+        if (!challengeToken) {
+            throw new Error('No login in progress');
+        }
+        try {
+            const data = await authApi.loginTwoFactor({ challenge_token: challengeToken, code });
+            await finishLogin(data);
+        } catch (error: any) {
+            // The challenge expires; an expired one means starting over
+            if (error.response?.data?.error === 'Invalid or expired challenge') {
+                setChallengeToken(null);
+            }
+            const errorMessage = error.response?.data?.error || 'Verification failed';
+            toast.error(errorMessage);
+            throw error;
+        }
+    };
+
     const logout = async () => {
         try {
-            await axios.post(`${API_URL}/api/logout`);
+            await authApi.logout();
             toast.success('Logged out successfully');
         } catch (error) {
             console.error('Logout error:', error);
         } finally {
-            localStorage.removeItem('token');
-            delete axios.defaults.headers.common['Authorization'];
+            tokenStorage.clear();
             setUser(null);
             router.push('/login');
         }
     };
 
     return (
-        <AuthContext.Provider value={{ user, isLoading, login, register, logout }}>
+        <AuthContext.Provider value={{ user, isLoading, login, completeTwoFactor, register, logout }}>
             {children}
         </AuthContext.Provider>
     );
@@ -1,14 +1,61 @@
-import axios from 'axios';
+import axios, { InternalAxiosRequestConfig } from 'axios';
 import { Task } from '@/types';
 
+const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
 
-const api = axios.create({
-    baseURL: process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080'
+export const api = axios.create({
+    baseURL: API_URL
 });
 
+export const tokenStorage = {
+    getToken: () => localStorage.getItem('token'),
+    getRefreshToken: () => localStorage.getItem('refresh_token'),
+    setTokens: (token: string, refreshToken: string) => {
+        localStorage.setItem('token', token);
+        localStorage.setItem('refresh_token', refreshToken);
+    },
+    clear: () => {
+        localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
+    },
+};
+
+// Refresh tokens are single use and presenting a spent one signs the user
+// out everywhere. Requests failing together share one refresh, and since
+// tabs share the tokens through localStorage they take turns with a Web
+// Lock; a tab that waited finds the tokens already rotated and uses them.
+let refreshRequest: Promise<string> | null = null;
+
+const rotateTokens = async (expiredToken: string | null): Promise<string> => {
+    const current = tokenStorage.getToken();
+    if (current && current !== expiredToken) {
+        return current;
+    }
+
+    const refreshToken = tokenStorage.getRefreshToken();
+    if (!refreshToken) {
+        throw new Error('No refresh token');
+    }
+    const response = await axios.post(`${API_URL}/api/token/refresh`, { refresh_token: refreshToken });
+    tokenStorage.setTokens(response.data.token, response.data.refresh_token);
+    return response.data.token as string;
+};
+
+const refreshAccessToken = (expiredToken: string | null): Promise<string> => {
+    if (!refreshRequest) {
+        const rotate = () => rotateTokens(expiredToken);
+        refreshRequest = (navigator.locks ? navigator.locks.request('token-refresh', rotate) : rotate()).finally(() => {
+            refreshRequest = null;
+        });
+    }
+    return refreshRequest;
+};
+
+// A 401 from these means bad credentials, not an expired access token
+const AUTH_ENDPOINTS = ['/api/login', '/api/register', '/api/logout', '/api/token/refresh'];
 
 api.interceptors.request.use((config) => {
-    const token = localStorage.getItem('token');
+    const token = tokenStorage.getToken();
     if (token) {
         config.headers.Authorization = `Bearer ${token}`;
     }
@@ -18,11 +65,26 @@ api.interceptors.request.use((config) => {
 
 api.interceptors.response.use(
     (response) => response,
-    (error) => {
-        if (error.response?.status === 401) {
-            localStorage.removeItem('token');
-            window.location.href = '/login';
+    async (error) => {
+        const request = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+        if (error.response?.status !== 401 || !request || AUTH_ENDPOINTS.some((path) => request.url?.startsWith(path))) {
+            return Promise.reject(error);
         }
+
+        if (!request._retried) {
+            request._retried = true;
+            try {
+                const sent = String(request.headers.Authorization ?? '').replace(/^Bearer /, '');
+                const token = await refreshAccessToken(sent || null);
+                request.headers.Authorization = `Bearer ${token}`;
+                return api(request);
+            } catch (refreshError) {
+                console.error('Token refresh error:', refreshError);
+            }
+        }
+
+        tokenStorage.clear();
+        window.location.href = '/login';
         return Promise.reject(error);
     }
 );
@@ -72,8 +134,22 @@ export const authApi = {
       return response.data;
   },
 
+  // Completes a login answered with two_factor_required, using a TOTP or
+  // recovery code
+  loginTwoFactor: async (data: { challenge_token: string; code: string }) => {
+      const response = await api.post('/api/login/2fa', data);
+      return response.data;
+  },
+
   verifyToken: async () => {
       const response = await api.get('/api/verify-token');
       return response.data;
   },
+
+  logout: async () => {
+      const refreshToken = tokenStorage.getRefreshToken();
+      if (refreshToken) {
+          await api.post('/api/logout', { refresh_token: refreshToken });
+      }
+  },
 };
\ No newline at end of file